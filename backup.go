@@ -0,0 +1,130 @@
+package skv_go
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"skv-go/data"
+	"skv-go/fio"
+)
+
+// backupFile 备份时需要拷贝的文件
+type backupFile struct {
+	file *os.File
+	//目标文件名
+	name string
+	//需要拷贝的大小，为-1表示拷贝整个文件
+	size int64
+}
+
+// Backup 将数据库备份到指定目录，备份得到的目录可以直接使用Open打开
+// 目录不存在时会被创建，已经存在时必须为空，否则其中旧的数据文件会混入备份
+// 只在确定需要拷贝的文件时短暂加锁，拷贝数据时不会阻塞读写
+func (db *DB) Backup(dir string) error {
+	dataDir, err := filepath.Abs(db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	backupDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if dataDir == backupDir {
+		return ErrBackupDirIsDataDir
+	}
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
+		return err
+	}
+	dirEntries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return err
+	}
+	if len(dirEntries) > 0 {
+		return ErrBackupDirNotEmpty
+	}
+
+	files, err := db.openBackupFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			_ = f.file.Close()
+		}
+	}()
+	for _, f := range files {
+		if err := copyBackupFile(f, filepath.Join(backupDir, f.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openBackupFiles 加锁打开所有需要拷贝的文件
+// 文件打开之后即使被merge删除或者替换，仍然可以读取到打开时的内容
+func (db *DB) openBackupFiles() ([]*backupFile, error) {
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	if db.activeFile == nil {
+		return nil, nil
+	}
+	//先持久化活跃文件，备份只拷贝到当前的写入偏移量，保证是一个一致的时间点
+	if err := db.activeFile.Sync(); err != nil {
+		return nil, err
+	}
+
+	var files []*backupFile
+	openFile := func(fileName string, size int64) error {
+		file, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		files = append(files, &backupFile{file: file, name: filepath.Base(fileName), size: size})
+		return nil
+	}
+	closeFiles := func() {
+		for _, f := range files {
+			_ = f.file.Close()
+		}
+	}
+	for fileId := range db.olderFiles {
+		if err := openFile(data.GetDataFileName(db.options.DirPath, fileId), -1); err != nil {
+			closeFiles()
+			return nil, err
+		}
+		//hint文件不是必须的，不存在时打开数据库会从数据文件中加载索引
+		hintFileName := data.GetHintFileName(db.options.DirPath, fileId)
+		if err := openFile(hintFileName, -1); err != nil && !os.IsNotExist(err) {
+			closeFiles()
+			return nil, err
+		}
+	}
+	if err := openFile(data.GetDataFileName(db.options.DirPath, db.activeFile.FileId), db.activeFile.WriteOff); err != nil {
+		closeFiles()
+		return nil, err
+	}
+	return files, nil
+}
+
+// copyBackupFile 拷贝文件并持久化
+func copyBackupFile(f *backupFile, destPath string) error {
+	dest, err := os.OpenFile(destPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fio.DataFilePerm)
+	if err != nil {
+		return err
+	}
+	if f.size < 0 {
+		_, err = io.Copy(dest, f.file)
+	} else {
+		_, err = io.CopyN(dest, f.file, f.size)
+	}
+	if err != nil {
+		_ = dest.Close()
+		return err
+	}
+	if err := dest.Sync(); err != nil {
+		_ = dest.Close()
+		return err
+	}
+	return dest.Close()
+}
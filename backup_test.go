@@ -0,0 +1,71 @@
+package skv_go
+
+import (
+	"os"
+	"path/filepath"
+	"skv-go/utils"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Backup(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-backup")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrBackupDirIsDataDir, db.Backup(dir))
+
+	for i := 0; i < 3000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	for i := 0; i < 500; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+
+	// Writers keep going while the backup is taken
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 3000; i < 4000; i++ {
+			assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+		}
+	}()
+	backupDir, _ := os.MkdirTemp("", "test-backup-dest")
+	defer os.RemoveAll(backupDir)
+	assert.NoError(t, db.Backup(backupDir))
+	wg.Wait()
+	// Files of an earlier backup would mix with the new one
+	assert.Equal(t, ErrBackupDirNotEmpty, db.Backup(backupDir))
+
+	_, err = os.Stat(filepath.Join(backupDir, fileLockName))
+	assert.True(t, os.IsNotExist(err))
+
+	backupOptions := options
+	backupOptions.DirPath = backupDir
+	backupDB, err := Open(backupOptions)
+	assert.NoError(t, err)
+	defer backupDB.Close()
+	keys := backupDB.ListKeys()
+	assert.GreaterOrEqual(t, len(keys), 2500)
+	assert.LessOrEqual(t, len(keys), 3500)
+	for i := 0; i < 500; i++ {
+		_, err := backupDB.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+	// Every key in the backup has the value it had in the source
+	for _, key := range keys {
+		value, err := backupDB.Get(key)
+		assert.NoError(t, err)
+		expected, err := db.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+}
@@ -0,0 +1,173 @@
+package skv_go
+
+import (
+	"skv-go/data"
+	"sort"
+	"sync"
+)
+
+// 不属于任何事务的记录的序列号
+const nonTransactionSeqNo uint64 = 0
+
+// 事务完成标识记录的key
+var txnFinKey = []byte("txn-fin")
+
+// WriteBatch 原子批量写，批次中的所有数据要么全部生效，要么全部不生效
+type WriteBatch struct {
+	options WriteBatchOptions
+	mu      *sync.Mutex
+	db      *DB
+	//暂存用户写入的数据
+	pendingWrites map[string]*data.LogRecord
+}
+
+// NewWriteBatch 创建一个批量写
+func (db *DB) NewWriteBatch(opts WriteBatchOptions) *WriteBatch {
+	return &WriteBatch{
+		options:       opts,
+		mu:            new(sync.Mutex),
+		db:            db,
+		pendingWrites: make(map[string]*data.LogRecord),
+	}
+}
+
+// Put 批量写入数据
+func (wb *WriteBatch) Put(key []byte, value []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	//暂存LogRecord
+	logRecord := &data.LogRecord{Key: key, Value: value, Type: data.LogRecordNormal}
+	wb.pendingWrites[string(key)] = logRecord
+	return nil
+}
+
+// Delete 批量删除数据
+func (wb *WriteBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	//数据不存在则直接返回，同时丢弃之前暂存的写入
+	if wb.db.index.Get(key) == nil {
+		delete(wb.pendingWrites, string(key))
+		return nil
+	}
+
+	//暂存LogRecord
+	logRecord := &data.LogRecord{Key: key, Type: data.LogRecordDelete}
+	wb.pendingWrites[string(key)] = logRecord
+	return nil
+}
+
+// Commit 提交批次，将暂存的数据全部写到数据文件中，并更新内存索引
+func (wb *WriteBatch) Commit() error {
+	wb.mu.Lock()
+	defer wb.mu.Unlock()
+
+	if len(wb.pendingWrites) == 0 {
+		return nil
+	}
+	if uint(len(wb.pendingWrites)) > wb.options.MaxBatchNum {
+		return ErrExceedMaxBatchNum
+	}
+
+	//加锁保证批次之间串行提交
+	wb.db.rw.Lock()
+	defer wb.db.rw.Unlock()
+	if err := wb.db.commitRecords(wb.pendingWrites, wb.options.SyncWrites); err != nil {
+		return err
+	}
+
+	//清空暂存数据
+	wb.pendingWrites = make(map[string]*data.LogRecord)
+	return nil
+}
+
+// commitRecords 使用同一个序列号写入一组记录和事务完成标识，然后更新内存索引，
+// 重放数据文件时只有事务完成标识存在的记录才会生效，使用该方法需要加锁
+func (db *DB) commitRecords(records map[string]*data.LogRecord, sync bool) error {
+	if db.readOnly {
+		return ErrReadOnlyReplica
+	}
+	//获取最新的序列号
+	db.seqNo++
+	seqNo := db.seqNo
+	//提交完成之前活跃文件转换为旧文件时，重启后需要从批次的第一个文件开始重放
+	db.committing = true
+	if db.activeFile != nil {
+		db.commitFid = db.activeFile.FileId
+	} else {
+		db.commitFid = 0
+	}
+	defer func() {
+		db.committing = false
+	}()
+
+	//写数据到数据文件中
+	positions := make(map[string]*data.LogRecordPos)
+	for _, record := range records {
+		record.SeqNo = seqNo
+		logRecordPos, err := db.appendLogRecord(record)
+		if err != nil {
+			return err
+		}
+		positions[string(record.Key)] = logRecordPos
+	}
+
+	//写一条标识事务完成的数据
+	finishedRecord := &data.LogRecord{
+		Key:   txnFinKey,
+		Type:  data.LogRecordTxnFinished,
+		SeqNo: seqNo,
+	}
+	finishedPos, err := db.appendLogRecord(finishedRecord)
+	if err != nil {
+		return err
+	}
+	db.reclaimSize += int64(finishedPos.Size)
+
+	//根据配置决定是否持久化
+	if sync && db.activeFile != nil {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+	}
+
+	//更新内存索引
+	for _, record := range records {
+		pos := positions[string(record.Key)]
+		oldPos := db.index.Get(record.Key)
+		if record.Type == data.LogRecordNormal {
+			db.index.Put(record.Key, pos)
+		}
+		if record.Type == data.LogRecordDelete {
+			db.index.Delete(record.Key)
+			db.reclaimSize += int64(pos.Size)
+		}
+		if oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
+		}
+	}
+
+	//按照写入数据文件的顺序发送变更事件
+	if len(db.watchers) > 0 {
+		sorted := make([]*data.LogRecord, 0, len(records))
+		for _, record := range records {
+			sorted = append(sorted, record)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			a, b := positions[string(sorted[i].Key)], positions[string(sorted[j].Key)]
+			return a.Fid < b.Fid || (a.Fid == b.Fid && a.Offset < b.Offset)
+		})
+		for _, record := range sorted {
+			db.emitEvent(record, positions[string(record.Key)])
+		}
+	}
+	return nil
+}
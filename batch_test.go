@@ -0,0 +1,175 @@
+package skv_go
+
+import (
+	"os"
+	"skv-go/data"
+	"skv-go/index"
+	"skv-go/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteBatch_Commit(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-batch")
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	// Data is invisible before commit
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put(utils.GetTestKey(1), utils.RandomValue(10)))
+	assert.NoError(t, wb.Delete(utils.GetTestKey(2)))
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Data is visible after commit
+	assert.NoError(t, wb.Commit())
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.NoError(t, err)
+
+	// Delete in a batch
+	wb2 := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb2.Delete(utils.GetTestKey(1)))
+	assert.NoError(t, wb2.Put(utils.GetTestKey(3), []byte("Hello")))
+	assert.NoError(t, wb2.Commit())
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Restart and check the data again
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.Get(utils.GetTestKey(3))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Hello"), value)
+	assert.Equal(t, uint64(2), db.seqNo)
+}
+
+func TestWriteBatch_Uncommitted(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-batch")
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put(utils.GetTestKey(1), []byte("committed")))
+	assert.NoError(t, wb.Commit())
+
+	// Simulate a crash in the middle of a commit, the finished record is missing
+	_, err = db.appendLogRecordWithLock(&data.LogRecord{Key: utils.GetTestKey(1), Value: []byte("lost"), SeqNo: 2})
+	assert.NoError(t, err)
+	_, err = db.appendLogRecordWithLock(&data.LogRecord{Key: utils.GetTestKey(2), Value: []byte("lost"), SeqNo: 2})
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	value, err := db.Get(utils.GetTestKey(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("committed"), value)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// A new batch must not reuse the sequence number of the incomplete one
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put(utils.GetTestKey(3), []byte("new")))
+	assert.NoError(t, wb.Commit())
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get(utils.GetTestKey(3))
+	assert.NoError(t, err)
+}
+
+func TestWriteBatch_SpanFiles_BPlusTree(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-batch")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 200
+	options.IndexType = index.BPlusTreeIndex
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("first"), utils.RandomValue(40)))
+
+	// The batch starts in one data file and its finished record lands in the next one
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	assert.NoError(t, wb.Commit())
+	assert.Equal(t, 1, len(db.olderFiles))
+
+	// Simulate a crash after the finished record was written but before the index was updated
+	for i := 0; i < 5; i++ {
+		db.index.Delete(utils.GetTestKey(i))
+	}
+	assert.NoError(t, db.index.Close())
+	assert.NoError(t, db.activeFile.Close())
+	for _, dataFile := range db.olderFiles {
+		assert.NoError(t, dataFile.Close())
+	}
+	assert.NoError(t, db.fileLock.Unlock())
+
+	db, err = Open(options)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err := db.Get(utils.GetTestKey(i))
+		assert.NoError(t, err)
+	}
+	_, err = db.Get([]byte("first"))
+	assert.NoError(t, err)
+}
+
+func TestWriteBatch_ExceedMaxBatchNum(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-batch")
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	wbOptions := DefaultWriteBatchOptions
+	wbOptions.MaxBatchNum = 10
+	wb := db.NewWriteBatch(wbOptions)
+	for i := 0; i < 11; i++ {
+		assert.NoError(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	assert.Equal(t, ErrExceedMaxBatchNum, wb.Commit())
+}
+
+func TestWriteBatch_Merge(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-batch")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, wb.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	assert.NoError(t, wb.Commit())
+	assert.NoError(t, db.Merge())
+
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2000, len(db.ListKeys()))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	skv "skv-go"
+	"skv-go/httpserver"
+	"syscall"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	dir := flag.String("dir", "", "data directory of the database")
+	flag.Parse()
+
+	options := skv.DefaultOptions
+	if *dir != "" {
+		options.DirPath = *dir
+	}
+	db, err := skv.Open(options)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+
+	server := &http.Server{Addr: *addr, Handler: httpserver.NewServer(db)}
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		_ = server.Shutdown(context.Background())
+	}()
+
+	log.Printf("http server listening on %s", *addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("http server stopped: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Fatalf("failed to close database: %v", err)
+	}
+}
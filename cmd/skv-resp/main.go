@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	skv "skv-go"
+	"skv-go/resp"
+	"syscall"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6380", "address to listen on")
+	dir := flag.String("dir", "", "data directory of the database")
+	flag.Parse()
+
+	options := skv.DefaultOptions
+	if *dir != "" {
+		options.DirPath = *dir
+	}
+	db, err := skv.Open(options)
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+
+	server := resp.NewServer(db)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		_ = server.Close()
+	}()
+
+	log.Printf("resp server listening on %s", *addr)
+	if err := server.ListenAndServe(*addr); err != nil && err != resp.ErrServerClosed {
+		log.Printf("resp server stopped: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		log.Fatalf("failed to close database: %v", err)
+	}
+}
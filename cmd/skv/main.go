@@ -0,0 +1,364 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	skv "skv-go"
+	"skv-go/data"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const usage = `usage: skv [-dir path] [-key key] <command> [arguments]
+
+commands:
+  get <key>                  print the value of a key
+  put <key> <value>          write a key
+  del <key>                  delete a key
+  scan [--prefix p] [--reverse] [--limit n]
+                             list keys and values
+  stat                       print database statistics
+  verify                     check every record of every data file
+  dump-file <id>             print every record of a data file
+  upgrade                    add the format header to legacy data files
+`
+
+var (
+	// errVerifyFailed verify发现了损坏的数据
+	errVerifyFailed = errors.New("verify failed")
+	// errEncryptionKeyRequired 数据文件中有加密的记录，但是没有给出密钥
+	errEncryptionKeyRequired = errors.New("the data files are encrypted, give the encryption key with -key")
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if err != errVerifyFailed {
+			fmt.Fprintln(os.Stderr, "skv:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run 解析参数并执行子命令，输出写入到out中
+func run(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("skv", flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.Usage = func() { fmt.Fprint(out, usage) }
+	dir := flags.String("dir", skv.DefaultOptions.DirPath, "data directory of the database")
+	key := flags.String("key", "", "encryption key of the database, 16, 24 or 32 bytes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+
+	switch args[0] {
+	case "get":
+		return withDB(*dir, *key, func(db *skv.DB) error { return get(db, args[1:], out) })
+	case "put":
+		return withDB(*dir, *key, func(db *skv.DB) error { return put(db, args[1:]) })
+	case "del":
+		return withDB(*dir, *key, func(db *skv.DB) error { return del(db, args[1:]) })
+	case "scan":
+		return withDB(*dir, *key, func(db *skv.DB) error { return scan(db, args[1:], out) })
+	case "stat":
+		return withDB(*dir, *key, func(db *skv.DB) error { return stat(db, out) })
+	case "verify":
+		return verify(*dir, *key, out)
+	case "dump-file":
+		return dumpFile(*dir, *key, args[1:], out)
+	case "upgrade":
+		return upgrade(*dir, *key, out)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// newOptions 获取打开数据目录使用的配置项
+func newOptions(dir, key string) skv.Options {
+	options := skv.DefaultOptions
+	options.DirPath = dir
+	options.ExpireSweepInterval = 0
+	if key != "" {
+		options.EncryptionKey = []byte(key)
+	}
+	return options
+}
+
+// withDB 打开数据库执行操作，执行完成后关闭
+func withDB(dir, key string, fn func(db *skv.DB) error) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	db, err := skv.Open(newOptions(dir, key))
+	if err != nil {
+		return err
+	}
+	if err := fn(db); err != nil {
+		_ = db.Close()
+		return err
+	}
+	return db.Close()
+}
+
+func get(db *skv.DB, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: get <key>")
+	}
+	value, err := db.Get([]byte(args[0]))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", value)
+	return err
+}
+
+func put(db *skv.DB, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: put <key> <value>")
+	}
+	return db.Put([]byte(args[0]), []byte(args[1]))
+}
+
+func del(db *skv.DB, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: del <key>")
+	}
+	return db.Delete([]byte(args[0]))
+}
+
+func scan(db *skv.DB, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	flags.SetOutput(out)
+	prefix := flags.String("prefix", "", "only list keys with the prefix")
+	reverse := flags.Bool("reverse", false, "list keys in reverse order")
+	limit := flags.Int("limit", 0, "maximum number of keys to list, 0 means no limit")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	options := skv.DefaultIteratorOptions
+	options.Prefix = []byte(*prefix)
+	options.Reverse = *reverse
+	iter := db.NewIterator(options)
+	defer iter.Close()
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		if *limit > 0 && count == *limit {
+			break
+		}
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(out, "%q\t%q\n", iter.Key(), value); err != nil {
+			return err
+		}
+		count++
+	}
+	return nil
+}
+
+func stat(db *skv.DB, out io.Writer) error {
+	stat, err := db.Stat()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "keys:             %d\ndata files:       %d\ndisk size:        %d\nreclaimable size: %d\n",
+		stat.KeyNum, stat.DataFileNum, stat.DiskSize, stat.ReclaimableSize)
+	return err
+}
+
+// verify 检查所有数据文件中的记录，活跃文件末尾不完整的记录会在打开数据库时被截断
+func verify(dir, key string, out io.Writer) error {
+	fileIds, err := listDataFiles(dir)
+	if err != nil {
+		return err
+	}
+	dataCipher, err := newCipher(key)
+	if err != nil {
+		return err
+	}
+	fileLock, err := skv.LockDataDir(dir)
+	if err != nil {
+		return err
+	}
+	defer fileLock.Unlock()
+
+	var corrupted bool
+	for i, fileId := range fileIds {
+		records, offset, last, readErr := readAll(dir, fileId, dataCipher, nil)
+		switch {
+		case readErr == nil:
+			fmt.Fprintf(out, "%s: ok, %d records\n", dataFileName(fileId), records)
+		case readErr == errEncryptionKeyRequired:
+			return readErr
+		case i == len(fileIds)-1 && last && (readErr == io.ErrUnexpectedEOF || readErr == data.ErrInvalidCRC):
+			fmt.Fprintf(out, "%s: %d valid records, torn tail at offset %d: %v\n", dataFileName(fileId), records, offset, readErr)
+		default:
+			corrupted = true
+			fmt.Fprintf(out, "%s: %d valid records, corrupted at offset %d: %v\n", dataFileName(fileId), records, offset, readErr)
+		}
+	}
+	if corrupted {
+		return errVerifyFailed
+	}
+	return nil
+}
+
+// dumpFile 打印数据文件中的每一条记录
+func dumpFile(dir, key string, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: dump-file <id>")
+	}
+	fileId, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid file id %q", args[0])
+	}
+	if _, err := os.Stat(data.GetDataFileName(dir, uint32(fileId))); err != nil {
+		return err
+	}
+	dataCipher, err := newCipher(key)
+	if err != nil {
+		return err
+	}
+	fileLock, err := skv.LockDataDir(dir)
+	if err != nil {
+		return err
+	}
+	defer fileLock.Unlock()
+
+	_, offset, _, readErr := readAll(dir, uint32(fileId), dataCipher, func(offset int64, logRecord *data.LogRecord, size int64, crcErr error) {
+		crcStatus := "ok"
+		if crcErr != nil {
+			crcStatus = "mismatch"
+		}
+		fmt.Fprintf(out, "offset=%d size=%d type=%s key_size=%d value_size=%d seq_no=%d expire=%d crc=%s key=%q\n",
+			offset, size, recordTypeName(logRecord.Type), len(logRecord.Key), len(logRecord.Value),
+			logRecord.SeqNo, logRecord.Expire, crcStatus, logRecord.Key)
+	})
+	if readErr == errEncryptionKeyRequired {
+		return readErr
+	}
+	if readErr != nil {
+		fmt.Fprintf(out, "first error at offset=%d: %v\n", offset, readErr)
+	}
+	return nil
+}
+
+// upgrade 为没有文件头部的旧数据文件加上头部
+func upgrade(dir, key string, out io.Writer) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	upgraded, err := skv.UpgradeDataFiles(newOptions(dir, key))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%d data files upgraded\n", upgraded)
+	return err
+}
+
+// newCipher 根据命令行给出的密钥创建加密器，没有给出密钥时返回nil
+func newCipher(key string) (*data.Cipher, error) {
+	if key == "" {
+		return nil, nil
+	}
+	return data.NewCipher([]byte(key))
+}
+
+// readAll 以只读方式读取数据文件中的所有记录，返回有效记录的数量以及遇到的第一个错误和它所在的偏移量，
+// 以及出错的记录是否是文件中的最后一条记录，没有错误时返回文件末尾的偏移量。
+// 校验失败的记录会交给fn处理后继续读取，其他错误会停止读取
+func readAll(dir string, fileId uint32, dataCipher *data.Cipher, fn func(int64, *data.LogRecord, int64, error)) (int, int64, bool, error) {
+	dataFile, err := data.OpenDataFileReadOnly(dir, fileId)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer dataFile.Close()
+	dataFile.Cipher = dataCipher
+
+	var records int
+	var errOffset int64
+	var firstErr error
+	var last bool
+	offset := dataFile.HeaderSize
+	for {
+		logRecord, size, err := dataFile.Read(offset)
+		if err == io.EOF {
+			break
+		}
+		if err == data.ErrEncryptionKeyRequired {
+			return records, offset, false, errEncryptionKeyRequired
+		}
+		//出错的记录之后还能读到记录时，说明损坏不在文件末尾
+		last = firstErr == nil
+		if err != nil && firstErr == nil {
+			firstErr, errOffset = err, offset
+		}
+		if err != nil && err != data.ErrInvalidCRC {
+			break
+		}
+		if fn != nil {
+			fn(offset, logRecord, size, err)
+		}
+		if err == nil {
+			records++
+		}
+		offset += size
+	}
+	if firstErr != nil {
+		return records, errOffset, last, firstErr
+	}
+	return records, offset, false, nil
+}
+
+// listDataFiles 获取目录中所有数据文件的id
+func listDataFiles(dir string) ([]uint32, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var fileIds []uint32
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, data.DataFileSuffix) {
+			continue
+		}
+		fileId, err := strconv.ParseUint(strings.TrimSuffix(name, data.DataFileSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		fileIds = append(fileIds, uint32(fileId))
+	}
+	sort.Slice(fileIds, func(i, j int) bool { return fileIds[i] < fileIds[j] })
+	return fileIds, nil
+}
+
+func dataFileName(fileId uint32) string {
+	return filepath.Base(data.GetDataFileName("", fileId))
+}
+
+func recordTypeName(typ data.LogRecordType) string {
+	switch typ {
+	case data.LogRecordNormal:
+		return "normal"
+	case data.LogRecordDelete:
+		return "delete"
+	case data.LogRecordTxnFinished:
+		return "txn-finished"
+	case data.LogRecordRangeDelete:
+		return "range-delete"
+	default:
+		return fmt.Sprintf("unknown(%d)", typ)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	skv "skv-go"
+	"skv-go/data"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runCommand(t *testing.T, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := run(args, &out)
+	return out.String(), err
+}
+
+func TestRun_KV(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-skv-cli")
+	defer os.RemoveAll(dir)
+
+	_, err := runCommand(t, "-dir", dir, "put", "user:1", "alice")
+	assert.NoError(t, err)
+	_, err = runCommand(t, "-dir", dir, "put", "user:2", "bob")
+	assert.NoError(t, err)
+	_, err = runCommand(t, "-dir", dir, "put", "order:1", "book")
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "-dir", dir, "get", "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice\n", out)
+
+	out, err = runCommand(t, "-dir", dir, "scan", "--prefix", "user:", "--reverse")
+	assert.NoError(t, err)
+	assert.Equal(t, "\"user:2\"\t\"bob\"\n\"user:1\"\t\"alice\"\n", out)
+
+	_, err = runCommand(t, "-dir", dir, "del", "user:1")
+	assert.NoError(t, err)
+	_, err = runCommand(t, "-dir", dir, "get", "user:1")
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+
+	out, err = runCommand(t, "-dir", dir, "stat")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "keys:             2\n")
+
+	_, err = runCommand(t, "-dir", dir, "unknown")
+	assert.Error(t, err)
+	_, err = runCommand(t, "-dir", dir, "get")
+	assert.Error(t, err)
+}
+
+func TestRun_VerifyAndDumpFile(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-skv-cli")
+	defer os.RemoveAll(dir)
+
+	_, err := runCommand(t, "-dir", dir, "put", "key", "value")
+	assert.NoError(t, err)
+	_, err = runCommand(t, "-dir", dir, "del", "key")
+	assert.NoError(t, err)
+
+	out, err := runCommand(t, "-dir", dir, "verify")
+	assert.NoError(t, err)
+	assert.Equal(t, "000000000.data: ok, 2 records\n", out)
+
+	// A record with a bad checksum at the end of the active file is a torn tail
+	fileName := data.GetDataFileName(dir, 0)
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: []byte("torn"), Value: []byte("value")})
+	encRecord[0] ^= 0xff
+	assert.NoError(t, os.WriteFile(fileName, append(content, encRecord...), 0644))
+	out, err = runCommand(t, "-dir", dir, "verify")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("000000000.data: 2 valid records, torn tail at offset %d: invalid crc\n", len(content)), out)
+
+	// Corrupt the value of the first record
+	content[data.FileHeaderSize+10] ^= 0xff
+	assert.NoError(t, os.WriteFile(fileName, content, 0644))
+
+	out, err = runCommand(t, "-dir", dir, "dump-file", "0")
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "offset=16 "))
+	assert.Contains(t, lines[0], "type=normal key_size=3 value_size=5")
+	assert.Contains(t, lines[0], "crc=mismatch")
+	assert.Contains(t, lines[1], "type=delete")
+	assert.Contains(t, lines[1], "crc=ok")
+	assert.Equal(t, "first error at offset=16: invalid crc", lines[2])
+
+	// A corrupted record followed by valid records is not a torn tail
+	out, err = runCommand(t, "-dir", dir, "verify")
+	assert.Equal(t, errVerifyFailed, err)
+	assert.Equal(t, "000000000.data: 1 valid records, corrupted at offset 16: invalid crc\n", out)
+
+	_, err = runCommand(t, "-dir", dir, "dump-file", "7")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRun_VerifyReadOnly(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-skv-cli")
+	defer os.RemoveAll(dir)
+
+	_, err := runCommand(t, "-dir", dir, "put", "key", "value")
+	assert.NoError(t, err)
+
+	// A data file with an incomplete header is read without being rewritten
+	fileName := data.GetDataFileName(dir, 1)
+	assert.NoError(t, os.WriteFile(fileName, []byte("SKV"), 0644))
+	_, err = runCommand(t, "-dir", dir, "verify")
+	assert.NoError(t, err)
+	_, err = runCommand(t, "-dir", dir, "dump-file", "1")
+	assert.NoError(t, err)
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("SKV"), content)
+	assert.NoError(t, os.Remove(fileName))
+
+	// The data directory is locked by an open database
+	options := skv.DefaultOptions
+	options.DirPath = dir
+	db, err := skv.Open(options)
+	assert.NoError(t, err)
+	_, err = runCommand(t, "-dir", dir, "verify")
+	assert.Equal(t, skv.ErrDatabaseIsUsing, err)
+	_, err = runCommand(t, "-dir", dir, "dump-file", "0")
+	assert.Equal(t, skv.ErrDatabaseIsUsing, err)
+	assert.NoError(t, db.Close())
+}
+
+func TestRun_VerifyEncrypted(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-skv-cli")
+	defer os.RemoveAll(dir)
+
+	key := "0123456789abcdef"
+	_, err := runCommand(t, "-dir", dir, "-key", key, "put", "key", "value")
+	assert.NoError(t, err)
+
+	_, err = runCommand(t, "-dir", dir, "verify")
+	assert.Equal(t, errEncryptionKeyRequired, err)
+	_, err = runCommand(t, "-dir", dir, "dump-file", "0")
+	assert.Equal(t, errEncryptionKeyRequired, err)
+
+	out, err := runCommand(t, "-dir", dir, "-key", key, "verify")
+	assert.NoError(t, err)
+	assert.Equal(t, "000000000.data: ok, 1 records\n", out)
+	out, err = runCommand(t, "-dir", dir, "-key", key, "dump-file", "0")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "crc=ok key=\"key\"")
+	out, err = runCommand(t, "-dir", dir, "-key", key, "get", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value\n", out)
+}
+
+func TestRun_Upgrade(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-skv-cli")
+	defer os.RemoveAll(dir)
+
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: []byte("key"), Value: []byte("value")})
+	assert.NoError(t, os.WriteFile(data.GetDataFileName(dir, 0), encRecord, 0644))
+
+	out, err := runCommand(t, "-dir", dir, "upgrade")
+	assert.NoError(t, err)
+	assert.Equal(t, "1 data files upgraded\n", out)
+	out, err = runCommand(t, "-dir", dir, "get", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value\n", out)
+}
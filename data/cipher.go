@@ -0,0 +1,79 @@
+package data
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// 记录头部中密钥标识的长度
+const keyIdSize = 4
+
+// Cipher 使用AES-GCM加密记录中的key和value，每条记录的头部保存加密使用的密钥标识，
+// 读取时根据标识选择密钥，旧密钥只用于解密，新的记录始终使用当前密钥加密
+type Cipher struct {
+	//当前密钥的标识
+	keyId uint32
+	//密钥标识到加密算法的映射
+	aeads map[uint32]cipher.AEAD
+}
+
+// NewCipher 创建加密器，key为当前使用的密钥，previousKeys为轮换之前使用过的密钥，
+// 密钥的长度必须为16，24或32字节，分别对应AES-128，AES-192和AES-256
+func NewCipher(key []byte, previousKeys ...[]byte) (*Cipher, error) {
+	c := &Cipher{keyId: getKeyId(key), aeads: make(map[uint32]cipher.AEAD)}
+	for _, k := range append([][]byte{key}, previousKeys...) {
+		block, err := aes.NewCipher(k)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.aeads[getKeyId(k)] = aead
+	}
+	return c, nil
+}
+
+// getKeyId 根据密钥计算密钥标识，不会泄露密钥本身
+func getKeyId(key []byte) uint32 {
+	sum := sha256.Sum256(append([]byte("skv-encryption-key:"), key...))
+	return binary.LittleEndian.Uint32(sum[:keyIdSize])
+}
+
+// sealedSize 获取加密后的数据大小
+func (c *Cipher) sealedSize(plainSize int) int {
+	aead := c.aeads[c.keyId]
+	return aead.NonceSize() + plainSize + aead.Overhead()
+}
+
+// seal 使用当前密钥加密数据，结果由随机的nonce和密文组成，additionalData会参与认证但不会被加密
+func (c *Cipher) seal(dst, plaintext, additionalData []byte) []byte {
+	aead := c.aeads[c.keyId]
+	nonce := dst[:aead.NonceSize()]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		panic(err)
+	}
+	return aead.Seal(dst[:len(nonce)], nonce, plaintext, additionalData)
+}
+
+// open 使用指定标识的密钥解密数据
+func (c *Cipher) open(keyId uint32, sealed, additionalData []byte) ([]byte, error) {
+	aead, ok := c.aeads[keyId]
+	if !ok {
+		return nil, ErrEncryptionKeyMismatch
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrDecryptFailed
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecryptFailed
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,116 @@
+package data
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// CompressionType value的压缩算法，写入到记录头部中，读取时根据它选择解压算法
+type CompressionType = byte
+
+const (
+	// NoCompression 不压缩
+	NoCompression CompressionType = iota
+	// DeflateCompression 使用标准库的deflate算法压缩
+	DeflateCompression
+)
+
+// Compressor 压缩算法，实现需要是并发安全的
+type Compressor interface {
+	// Compress 压缩数据
+	Compress(src []byte) ([]byte, error)
+	// Decompress 解压数据
+	Decompress(src []byte) ([]byte, error)
+}
+
+var (
+	compressorsLock = new(sync.RWMutex)
+	compressors     = map[CompressionType]Compressor{
+		DeflateCompression: newDeflateCompressor(flate.BestSpeed),
+	}
+)
+
+// RegisterCompressor 注册压缩算法，已经写入数据文件的记录依赖对应的算法，注册之后不能再更换
+func RegisterCompressor(typ CompressionType, compressor Compressor) {
+	if typ == NoCompression {
+		panic("can not register compressor for NoCompression")
+	}
+	compressorsLock.Lock()
+	defer compressorsLock.Unlock()
+	compressors[typ] = compressor
+}
+
+// GetCompressor 获取压缩算法，不存在时返回nil
+func GetCompressor(typ CompressionType) Compressor {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+	return compressors[typ]
+}
+
+// compressValue 压缩value，压缩失败或者压缩后没有变小时返回false
+func compressValue(typ CompressionType, value []byte) ([]byte, bool) {
+	if typ == NoCompression || len(value) == 0 {
+		return nil, false
+	}
+	compressor := GetCompressor(typ)
+	if compressor == nil {
+		return nil, false
+	}
+	compressed, err := compressor.Compress(value)
+	if err != nil || len(compressed) >= len(value) {
+		return nil, false
+	}
+	return compressed, true
+}
+
+// decompressValue 解压value
+func decompressValue(typ CompressionType, value []byte) ([]byte, error) {
+	compressor := GetCompressor(typ)
+	if compressor == nil {
+		return nil, ErrUnknownCompression
+	}
+	return compressor.Decompress(value)
+}
+
+// deflateCompressor deflate压缩算法，复用压缩和解压使用的对象
+type deflateCompressor struct {
+	writers *sync.Pool
+	readers *sync.Pool
+}
+
+func newDeflateCompressor(level int) *deflateCompressor {
+	return &deflateCompressor{
+		writers: &sync.Pool{New: func() any {
+			w, _ := flate.NewWriter(nil, level)
+			return w
+		}},
+		readers: &sync.Pool{New: func() any {
+			return flate.NewReader(nil)
+		}},
+	}
+}
+
+func (dc *deflateCompressor) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := dc.writers.Get().(*flate.Writer)
+	defer dc.writers.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (dc *deflateCompressor) Decompress(src []byte) ([]byte, error) {
+	r := dc.readers.Get().(io.ReadCloser)
+	defer dc.readers.Put(r)
+	if err := r.(flate.Resetter).Reset(bytes.NewReader(src), nil); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
@@ -2,12 +2,18 @@ package data
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
+	"os"
 	"path/filepath"
 	"skv-go/fio"
 )
 
-const DataFileSuffix = ".data"
+const (
+	DataFileSuffix        = ".data"
+	HintFileSuffix        = ".hint"
+	MergeFinishedFileName = "merge-finished"
+)
 
 // DataFile 数据文件
 type DataFile struct {
@@ -16,11 +22,95 @@ type DataFile struct {
 	//文件写到的位置
 	WriteOff  int64
 	IOManager fio.IOManager
+	//用于解密记录，为nil时遇到加密的记录会返回ErrEncryptionKeyRequired
+	Cipher *Cipher
+	//文件头部的大小，也就是第一条记录的偏移量，没有头部的旧文件为0
+	HeaderSize int64
+	//文件格式版本，没有头部的旧文件为0
+	Version uint16
+	//文件的创建时间，单位为纳秒的unix时间戳
+	CreatedAt int64
+}
+
+// OpenDataFile 打开数据文件，新的数据文件会先写入文件头部，已有的数据文件会校验头部
+func OpenDataFile(dirPath string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
+	fileName := GetDataFileName(dirPath, fileId)
+	if err := prepareFileHeader(fileName); err != nil {
+		return nil, err
+	}
+	dataFile, err := newDataFile(fileName, fileId, ioType)
+	if err != nil {
+		return nil, err
+	}
+	if err := dataFile.readFileHeader(); err != nil {
+		_ = dataFile.Close()
+		return nil, err
+	}
+	dataFile.WriteOff = dataFile.HeaderSize
+	return dataFile, nil
 }
 
-func OpenDataFile(dirPath string, fileId uint32) (*DataFile, error) {
-	fileName := filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+DataFileSuffix)
-	ioManager, err := fio.NewIOManager(fileName)
+// OpenDataFileReadOnly 以只读方式打开已有的数据文件，不会写入或修复文件头部，用于离线检查数据文件
+func OpenDataFileReadOnly(dirPath string, fileId uint32) (*DataFile, error) {
+	ioManager, err := fio.NewReadOnlyFileIOManager(GetDataFileName(dirPath, fileId))
+	if err != nil {
+		return nil, err
+	}
+	dataFile := &DataFile{FileId: fileId, IOManager: ioManager}
+	if err := dataFile.readFileHeader(); err != nil {
+		_ = dataFile.Close()
+		return nil, err
+	}
+	dataFile.WriteOff = dataFile.HeaderSize
+	return dataFile, nil
+}
+
+// OpenMergeFinishedFile 打开标识merge完成的文件
+func OpenMergeFinishedFile(dirPath string) (*DataFile, error) {
+	fileName := filepath.Join(dirPath, MergeFinishedFileName)
+	return newDataFile(fileName, 0, fio.StandardFIO)
+}
+
+// OpenHintFile 打开数据文件对应的hint文件
+func OpenHintFile(dirPath string, fileId uint32) (*DataFile, error) {
+	fileName := GetHintFileName(dirPath, fileId)
+	return newDataFile(fileName, fileId, fio.StandardFIO)
+}
+
+// WriteHintFile 写入数据文件对应的hint文件，先写临时文件再重命名，保证hint文件存在时一定是完整的
+func WriteHintFile(dirPath string, fileId uint32, hints []byte) error {
+	fileName := GetHintFileName(dirPath, fileId)
+	tmpFileName := fileName + ".tmp"
+	file, err := os.OpenFile(tmpFileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fio.DataFilePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(hints); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
+
+// GetHintFileName 获取hint文件的完整路径
+func GetHintFileName(dirPath string, fileId uint32) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+HintFileSuffix)
+}
+
+// GetDataFileName 获取数据文件的完整路径
+func GetDataFileName(dirPath string, fileId uint32) string {
+	return filepath.Join(dirPath, fmt.Sprintf("%09d", fileId)+DataFileSuffix)
+}
+
+func newDataFile(fileName string, fileId uint32, ioType fio.FileIOType) (*DataFile, error) {
+	ioManager, err := fio.NewIOManager(fileName, ioType)
 	if err != nil {
 		return nil, err
 	}
@@ -32,10 +122,63 @@ func OpenDataFile(dirPath string, fileId uint32) (*DataFile, error) {
 }
 
 func (df *DataFile) Read(offset int64) (*LogRecord, int64, error) {
-	fileSize, err := df.IOManager.Size()
+	header, headerBuf, recordSize, err := df.readLogRecordHeader(offset)
 	if err != nil {
 		return nil, 0, err
 	}
+	headerSize := int64(len(headerBuf))
+	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
+	logRecord := &LogRecord{Type: header.typ, SeqNo: header.seqNo, Expire: header.expire}
+	var kvBuf []byte
+	if keySize > 0 || valueSize > 0 {
+		//读取出头部后面的实际的数据
+		kvBuf, err = df.readNBytes(keySize+valueSize, offset+headerSize)
+		if err != nil {
+			return nil, 0, err
+		}
+		//取出key和value
+		logRecord.Key = kvBuf[:keySize]
+		logRecord.Value = kvBuf[keySize:]
+	}
+	//校验失败时仍然返回解析出的记录和大小，便于排查问题
+	crc := getLogRecordCRC(logRecord, headerBuf)
+	if crc != header.crc {
+		return logRecord, recordSize, ErrInvalidCRC
+	}
+	if header.encrypted {
+		if df.Cipher == nil {
+			return nil, 0, ErrEncryptionKeyRequired
+		}
+		plaintext, err := df.Cipher.open(header.keyId, kvBuf, headerBuf[crc32.Size:])
+		if err != nil {
+			return nil, 0, err
+		}
+		logRecord.Key = plaintext[:keySize]
+		logRecord.Value = plaintext[keySize:]
+	}
+	if header.compression != NoCompression {
+		value, err := decompressValue(header.compression, logRecord.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		logRecord.Value = value
+		logRecord.Compression = header.compression
+	}
+	return logRecord, recordSize, nil
+}
+
+// ReadRecordSize 只解析头部获取记录在文件中占据的大小，不校验CRC，也不读取和解密key和value
+func (df *DataFile) ReadRecordSize(offset int64) (int64, error) {
+	_, _, recordSize, err := df.readLogRecordHeader(offset)
+	return recordSize, err
+}
+
+// readLogRecordHeader 读取并解析记录的头部，返回头部，头部的原始字节和整条记录的大小
+func (df *DataFile) readLogRecordHeader(offset int64) (*logRecordHeader, []byte, int64, error) {
+	fileSize, err := df.IOManager.Size()
+	if err != nil {
+		return nil, nil, 0, err
+	}
 	headerByteSize := int64(maxLogRecordHeaderSize)
 	if offset+maxLogRecordHeaderSize > fileSize {
 		headerByteSize = fileSize - offset
@@ -43,34 +186,26 @@ func (df *DataFile) Read(offset int64) (*LogRecord, int64, error) {
 	//按头部最大长度读取头部
 	headerBuf, err := df.readNBytes(headerByteSize, offset)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, 0, err
 	}
 	//解析头部，注意这里面要忽略掉多读的字节
 	header, headerSize := decodeLogRecordHeader(headerBuf)
 	if header == nil {
-		return nil, 0, io.EOF
+		//文件末尾只有不完整的头部，说明写入时发生了中断
+		if len(headerBuf) > 0 {
+			return nil, nil, 0, io.ErrUnexpectedEOF
+		}
+		return nil, nil, 0, io.EOF
 	}
 	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
-		return nil, 0, io.EOF
+		return nil, nil, 0, io.EOF
 	}
-	keySize, valueSize := int64(header.keySize), int64(header.valueSize)
-	var recordSize = headerSize + keySize + valueSize
-	logRecord := &LogRecord{Type: header.typ}
-	if keySize > 0 || valueSize > 0 {
-		//读取出头部后面的实际的数据
-		kvBuf, err := df.readNBytes(keySize+valueSize, offset+headerSize)
-		if err != nil {
-			return nil, 0, err
-		}
-		//取出key和value
-		logRecord.Key = kvBuf[:keySize]
-		logRecord.Value = kvBuf[keySize:]
+	var recordSize = headerSize + int64(header.keySize) + int64(header.valueSize)
+	//记录超出了文件末尾，可能是写入中断，也可能是头部损坏读到了错误的长度
+	if offset+recordSize > fileSize {
+		return nil, nil, 0, io.ErrUnexpectedEOF
 	}
-	crc := getLogRecordCRC(logRecord, headerBuf[:headerSize])
-	if crc != header.crc {
-		return nil, 0, ErrInvalidCRC
-	}
-	return logRecord, recordSize, nil
+	return header, headerBuf[:headerSize], recordSize, nil
 }
 
 func (df *DataFile) Write(bytes []byte) error {
@@ -96,6 +231,28 @@ func (df *DataFile) Close() error {
 	return nil
 }
 
+// Truncate 将数据文件截断到指定大小，并更新写入偏移量
+func (df *DataFile) Truncate(size int64) error {
+	if err := df.IOManager.Truncate(size); err != nil {
+		return err
+	}
+	df.WriteOff = size
+	return nil
+}
+
+// SetIOManager 切换数据文件的IO类型
+func (df *DataFile) SetIOManager(dirPath string, ioType fio.FileIOType) error {
+	if err := df.IOManager.Close(); err != nil {
+		return err
+	}
+	ioManager, err := fio.NewIOManager(GetDataFileName(dirPath, df.FileId), ioType)
+	if err != nil {
+		return err
+	}
+	df.IOManager = ioManager
+	return nil
+}
+
 func (df *DataFile) readNBytes(n int64, offset int64) (b []byte, err error) {
 	b = make([]byte, n)
 	_, err = df.IOManager.Read(b, offset)
@@ -1,7 +1,12 @@
 package data
 
 import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
 	"os"
+	"skv-go/fio"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,7 +16,7 @@ func TestWrite(t *testing.T) {
 	dir, _ := os.MkdirTemp("", "test")
 	defer os.RemoveAll(dir)
 
-	df, _ := OpenDataFile(dir, 1)
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
 	defer df.Close()
 
 	// Write a log record
@@ -29,7 +34,7 @@ func TestRead(t *testing.T) {
 	dir, _ := os.MkdirTemp("", "test")
 	defer os.RemoveAll(dir)
 
-	df, _ := OpenDataFile(dir, 1)
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
 	defer df.Close()
 
 	// Write a log record
@@ -43,7 +48,7 @@ func TestRead(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Read the log record
-	readLogRecord, _, err := df.Read(0)
+	readLogRecord, _, err := df.Read(df.HeaderSize)
 	assert.NoError(t, err)
 
 	// Verify the log record
@@ -56,7 +61,7 @@ func TestSync(t *testing.T) {
 	dir, _ := os.MkdirTemp("", "test")
 	defer os.RemoveAll(dir)
 
-	df, _ := OpenDataFile(dir, 1)
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
 	defer df.Close()
 
 	// Sync the data file
@@ -68,7 +73,7 @@ func TestClose(t *testing.T) {
 	dir, _ := os.MkdirTemp("", "test")
 	defer os.RemoveAll(dir)
 
-	df, _ := OpenDataFile(dir, 1)
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
 
 	// Close the data file
 	err := df.Close()
@@ -79,7 +84,7 @@ func TestIntegration(t *testing.T) {
 	dir, _ := os.MkdirTemp("", "test")
 	defer os.RemoveAll(dir)
 
-	df, _ := OpenDataFile(dir, 1)
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
 
 	// Write a log record
 	logRecord := &LogRecord{
@@ -92,7 +97,7 @@ func TestIntegration(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Read the log record
-	readLogRecord, _, err := df.Read(0)
+	readLogRecord, _, err := df.Read(df.HeaderSize)
 	assert.NoError(t, err)
 
 	// Verify the log record
@@ -109,11 +114,11 @@ func TestIntegration(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Reopen the data file
-	df, _ = OpenDataFile(dir, 1)
+	df, _ = OpenDataFile(dir, 1, fio.StandardFIO)
 	defer df.Close()
 
 	// Read the log record again
-	readLogRecordAgain, _, err := df.Read(0)
+	readLogRecordAgain, _, err := df.Read(df.HeaderSize)
 	assert.NoError(t, err)
 
 	// Verify the log record again
@@ -121,3 +126,248 @@ func TestIntegration(t *testing.T) {
 	assert.Equal(t, logRecord.Value, readLogRecordAgain.Value)
 	assert.Equal(t, logRecord.Type, readLogRecordAgain.Type)
 }
+
+func TestHintFile(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	logRecord := &LogRecord{Key: []byte("Hello"), Value: []byte("world"), Type: LogRecordNormal}
+	pos := &LogRecordPos{Fid: 1, Offset: 100}
+	err := WriteHintFile(dir, 1, EncodeHintRecord(logRecord, pos, nil))
+	assert.NoError(t, err)
+
+	hintFile, err := OpenHintFile(dir, 1)
+	assert.NoError(t, err)
+	defer hintFile.Close()
+
+	// The hint record keeps the key, type and position but not the value
+	hintRecord, _, err := hintFile.Read(0)
+	assert.NoError(t, err)
+	assert.Equal(t, logRecord.Key, hintRecord.Key)
+	assert.Equal(t, logRecord.Type, hintRecord.Type)
+	assert.Equal(t, pos, DecodeLogRecordPos(hintRecord.Value))
+}
+
+func TestDataFile_SetIOManager(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	df, err := OpenDataFile(dir, 1, fio.StandardFIO)
+	assert.NoError(t, err)
+	logRecord := &LogRecord{Key: []byte("Hello"), Value: []byte("world"), Type: LogRecordNormal}
+	encLogRecord, _ := EncodeLogRecord(logRecord)
+	assert.NoError(t, df.Write(encLogRecord))
+
+	// Read the log record through mmap
+	assert.NoError(t, df.SetIOManager(dir, fio.MemoryMap))
+	readLogRecord, _, err := df.Read(df.HeaderSize)
+	assert.NoError(t, err)
+	assert.Equal(t, logRecord.Value, readLogRecord.Value)
+	_, _, err = df.Read(df.HeaderSize + int64(len(encLogRecord)))
+	assert.Equal(t, io.EOF, err)
+
+	// Switch back to standard file io and write again
+	assert.NoError(t, df.SetIOManager(dir, fio.StandardFIO))
+	assert.NoError(t, df.Write(encLogRecord))
+	_, _, err = df.Read(df.HeaderSize + int64(len(encLogRecord)))
+	assert.NoError(t, err)
+	assert.NoError(t, df.Close())
+}
+
+func TestRead_TornRecord(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
+	defer df.Close()
+
+	encLogRecord, size := EncodeLogRecord(&LogRecord{Key: []byte("Hello"), Value: []byte("world")})
+	assert.NoError(t, df.Write(encLogRecord))
+	// Only part of the second record reaches the disk
+	assert.NoError(t, df.Write(encLogRecord[:size-3]))
+
+	_, _, err := df.Read(df.HeaderSize)
+	assert.NoError(t, err)
+	_, _, err = df.Read(df.HeaderSize + size)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// A partial header is detected as well
+	assert.NoError(t, df.Truncate(df.HeaderSize+size+2))
+	_, _, err = df.Read(df.HeaderSize + size)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	// Nothing left after truncating to the last valid record
+	assert.NoError(t, df.Truncate(df.HeaderSize+size))
+	assert.Equal(t, df.HeaderSize+size, df.WriteOff)
+	_, _, err = df.Read(df.HeaderSize + size)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestRead_Compressed(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
+	defer df.Close()
+
+	value := bytes.Repeat([]byte("world"), 100)
+	encLogRecord, size := EncodeLogRecord(&LogRecord{Key: []byte("Hello"), Value: value, Compression: DeflateCompression})
+	assert.NoError(t, df.Write(encLogRecord))
+	// Uncompressed records in the same file are still readable
+	plainRecord, _ := EncodeLogRecord(&LogRecord{Key: []byte("Hello"), Value: value})
+	assert.NoError(t, df.Write(plainRecord))
+
+	logRecord, readSize, err := df.Read(df.HeaderSize)
+	assert.NoError(t, err)
+	assert.Equal(t, size, readSize)
+	assert.Equal(t, value, logRecord.Value)
+	assert.Equal(t, DeflateCompression, logRecord.Compression)
+
+	logRecord, _, err = df.Read(df.HeaderSize + size)
+	assert.NoError(t, err)
+	assert.Equal(t, value, logRecord.Value)
+	assert.Equal(t, NoCompression, logRecord.Compression)
+}
+
+func TestRead_Encrypted(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
+	defer df.Close()
+
+	key := bytes.Repeat([]byte("k"), 32)
+	c, err := NewCipher(key)
+	assert.NoError(t, err)
+	logRecord := &LogRecord{Key: []byte("secret-key"), Value: bytes.Repeat([]byte("secret-value"), 10), Compression: DeflateCompression}
+	encLogRecord, size := EncodeLogRecordWithCipher(logRecord, c)
+	assert.Equal(t, int64(len(encLogRecord)), size)
+	assert.False(t, bytes.Contains(encLogRecord, []byte("secret")))
+	assert.NoError(t, df.Write(encLogRecord))
+
+	// Reading needs the key
+	_, _, err = df.Read(df.HeaderSize)
+	assert.Equal(t, ErrEncryptionKeyRequired, err)
+	otherCipher, _ := NewCipher(bytes.Repeat([]byte("o"), 32))
+	df.Cipher = otherCipher
+	_, _, err = df.Read(df.HeaderSize)
+	assert.Equal(t, ErrEncryptionKeyMismatch, err)
+
+	// A rotated cipher still reads records written with a previous key
+	df.Cipher, err = NewCipher(bytes.Repeat([]byte("n"), 16), key)
+	assert.NoError(t, err)
+	readLogRecord, readSize, err := df.Read(df.HeaderSize)
+	assert.NoError(t, err)
+	assert.Equal(t, size, readSize)
+	assert.Equal(t, logRecord.Key, readLogRecord.Key)
+	assert.Equal(t, logRecord.Value, readLogRecord.Value)
+
+	// Tampering with the header is detected even when the crc is fixed up
+	tampered := append([]byte(nil), encLogRecord...)
+	tampered[4] |= LogRecordDelete
+	binary.LittleEndian.PutUint32(tampered, crc32.ChecksumIEEE(tampered[crc32.Size:]))
+	assert.NoError(t, df.Write(tampered))
+	_, _, err = df.Read(df.HeaderSize + size)
+	assert.Equal(t, ErrDecryptFailed, err)
+
+	_, err = NewCipher([]byte("short"))
+	assert.Error(t, err)
+}
+
+func TestReadRecordSize(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	df, _ := OpenDataFile(dir, 1, fio.StandardFIO)
+	defer df.Close()
+
+	c, err := NewCipher(bytes.Repeat([]byte("k"), 32))
+	assert.NoError(t, err)
+	value := bytes.Repeat([]byte("world"), 100)
+	encrypted, encryptedSize := EncodeLogRecordWithCipher(&LogRecord{Key: []byte("Hello"), Value: value, Compression: DeflateCompression, Expire: 1}, c)
+	plain, plainSize := EncodeLogRecord(&LogRecord{Key: []byte("Hello"), Value: value, SeqNo: 3})
+	assert.NoError(t, df.Write(encrypted))
+	assert.NoError(t, df.Write(plain))
+	assert.NoError(t, df.Write(plain[:plainSize-1]))
+
+	// The size is known without the key
+	size, err := df.ReadRecordSize(df.HeaderSize)
+	assert.NoError(t, err)
+	assert.Equal(t, encryptedSize, size)
+	size, err = df.ReadRecordSize(df.HeaderSize + encryptedSize)
+	assert.NoError(t, err)
+	assert.Equal(t, plainSize, size)
+	_, err = df.ReadRecordSize(df.HeaderSize + encryptedSize + plainSize)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, err = df.ReadRecordSize(df.WriteOff)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestOpenDataFile_Header(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	// New files start with the header
+	df, err := OpenDataFile(dir, 1, fio.StandardFIO)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(FileHeaderSize), df.HeaderSize)
+	assert.Equal(t, int64(FileHeaderSize), df.WriteOff)
+	assert.Equal(t, DataFileVersion, df.Version)
+	assert.Greater(t, df.CreatedAt, int64(0))
+	assert.NoError(t, df.Close())
+
+	// Reopening keeps the header, also through mmap
+	df, err = OpenDataFile(dir, 1, fio.MemoryMap)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(FileHeaderSize), df.HeaderSize)
+	assert.NoError(t, df.Close())
+
+	// A torn header is written again
+	fileName := GetDataFileName(dir, 2)
+	assert.NoError(t, os.WriteFile(fileName, fileHeaderMagic[:3], fio.DataFilePerm))
+	df, err = OpenDataFile(dir, 2, fio.StandardFIO)
+	assert.NoError(t, err)
+	assert.Equal(t, DataFileVersion, df.Version)
+	assert.NoError(t, df.Close())
+
+	// Files written by a newer version are refused
+	header := encodeFileHeader(0)
+	binary.LittleEndian.PutUint16(header[4:], DataFileVersion+1)
+	assert.NoError(t, os.WriteFile(GetDataFileName(dir, 3), header, fio.DataFilePerm))
+	_, err = OpenDataFile(dir, 3, fio.StandardFIO)
+	assert.Equal(t, ErrUnsupportedVersion, err)
+}
+
+func TestUpgradeDataFile(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test")
+	defer os.RemoveAll(dir)
+
+	// Files without a header are read from offset 0
+	logRecord := &LogRecord{Key: []byte("Hello"), Value: []byte("world")}
+	encLogRecord, size := EncodeLogRecord(logRecord)
+	assert.NoError(t, os.WriteFile(GetDataFileName(dir, 1), encLogRecord, fio.DataFilePerm))
+	df, err := OpenDataFile(dir, 1, fio.StandardFIO)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), df.HeaderSize)
+	assert.Equal(t, uint16(0), df.Version)
+	readLogRecord, _, err := df.Read(0)
+	assert.NoError(t, err)
+	assert.Equal(t, logRecord.Value, readLogRecord.Value)
+	assert.NoError(t, df.Close())
+
+	ok, err := UpgradeDataFile(dir, 1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = UpgradeDataFile(dir, 1)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	df, err = OpenDataFile(dir, 1, fio.StandardFIO)
+	assert.NoError(t, err)
+	defer df.Close()
+	assert.Equal(t, DataFileVersion, df.Version)
+	readLogRecord, readSize, err := df.Read(df.HeaderSize)
+	assert.NoError(t, err)
+	assert.Equal(t, size, readSize)
+	assert.Equal(t, logRecord.Value, readLogRecord.Value)
+}
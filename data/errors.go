@@ -3,5 +3,10 @@ package data
 import "errors"
 
 var (
-	ErrInvalidCRC = errors.New("invalid crc")
+	ErrInvalidCRC            = errors.New("invalid crc")
+	ErrUnknownCompression    = errors.New("unknown compression type")
+	ErrEncryptionKeyRequired = errors.New("the record is encrypted but no encryption key is given")
+	ErrEncryptionKeyMismatch = errors.New("the record is encrypted with a different key")
+	ErrDecryptFailed         = errors.New("failed to decrypt the record")
+	ErrUnsupportedVersion    = errors.New("unsupported data file version")
 )
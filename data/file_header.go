@@ -0,0 +1,148 @@
+package data
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"skv-go/fio"
+	"time"
+)
+
+// 数据文件头部，由魔数，格式版本，保留字段和创建时间组成
+// magic version reserved createdAt
+// 4 + 2 + 2 + 8 = 16
+const (
+	FileHeaderSize = 16
+	// DataFileVersion 当前的数据文件格式版本，没有头部的旧文件版本为0
+	DataFileVersion uint16 = 1
+	// UpgradeFileSuffix 升级时写入的临时文件的后缀
+	UpgradeFileSuffix = ".upgrade"
+)
+
+var fileHeaderMagic = []byte("SKVD")
+
+// encodeFileHeader 编码数据文件头部
+func encodeFileHeader(createdAt int64) []byte {
+	buf := make([]byte, FileHeaderSize)
+	copy(buf, fileHeaderMagic)
+	binary.LittleEndian.PutUint16(buf[4:], DataFileVersion)
+	binary.LittleEndian.PutUint64(buf[8:], uint64(createdAt))
+	return buf
+}
+
+// prepareFileHeader 为新的数据文件写入头部，写入时中断留下的不完整头部会被重写
+func prepareFileHeader(fileName string) error {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, fio.DataFilePerm)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := stat.Size()
+	if size >= FileHeaderSize {
+		return nil
+	}
+	if size > 0 {
+		buf := make([]byte, size)
+		if _, err := file.ReadAt(buf, 0); err != nil {
+			return err
+		}
+		//不是以魔数开头的短文件是只有不完整记录的旧文件，保持原样
+		n := min(int(size), len(fileHeaderMagic))
+		if !bytes.Equal(buf[:n], fileHeaderMagic[:n]) {
+			return nil
+		}
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+	}
+	_, err = file.WriteAt(encodeFileHeader(time.Now().UnixNano()), 0)
+	return err
+}
+
+// readFileHeader 读取并校验数据文件头部，没有头部的旧文件返回版本0
+func (df *DataFile) readFileHeader() error {
+	size, err := df.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	if size < FileHeaderSize {
+		return nil
+	}
+	buf, err := df.readNBytes(FileHeaderSize, 0)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(buf[:len(fileHeaderMagic)], fileHeaderMagic) {
+		return nil
+	}
+	version := binary.LittleEndian.Uint16(buf[4:])
+	if version == 0 || version > DataFileVersion {
+		return ErrUnsupportedVersion
+	}
+	df.Version = version
+	df.CreatedAt = int64(binary.LittleEndian.Uint64(buf[8:]))
+	df.HeaderSize = FileHeaderSize
+	return nil
+}
+
+// IsLegacyDataFile 判断数据文件是否是没有头部的旧文件
+func IsLegacyDataFile(dirPath string, fileId uint32) (bool, error) {
+	dataFile, err := newDataFile(GetDataFileName(dirPath, fileId), fileId, fio.StandardFIO)
+	if err != nil {
+		return false, err
+	}
+	err = dataFile.readFileHeader()
+	_ = dataFile.Close()
+	if err != nil {
+		return false, err
+	}
+	return dataFile.Version == 0, nil
+}
+
+// UpgradeDataFile 为没有头部的旧数据文件加上头部，返回是否进行了升级。
+// 升级后文件中所有记录的偏移量都会增加FileHeaderSize，调用方需要删除对应的hint文件以及保存在磁盘上的索引，
+// 升级时数据文件不能被打开
+func UpgradeDataFile(dirPath string, fileId uint32) (bool, error) {
+	legacy, err := IsLegacyDataFile(dirPath, fileId)
+	if err != nil || !legacy {
+		return false, err
+	}
+	fileName := GetDataFileName(dirPath, fileId)
+
+	src, err := os.Open(fileName)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return false, err
+	}
+	//先写临时文件再重命名，保证升级中断时原文件仍然完整
+	tmpFileName := fileName + UpgradeFileSuffix
+	dst, err := os.OpenFile(tmpFileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fio.DataFilePerm)
+	if err != nil {
+		return false, err
+	}
+	if _, err := dst.Write(encodeFileHeader(stat.ModTime().UnixNano())); err != nil {
+		_ = dst.Close()
+		return false, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return false, err
+	}
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		return false, err
+	}
+	if err := dst.Close(); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmpFileName, fileName)
+}
@@ -10,56 +10,197 @@ type LogRecordType = byte
 const (
 	LogRecordNormal LogRecordType = iota
 	LogRecordDelete
+	LogRecordTxnFinished
+	// LogRecordRangeDelete 范围删除，Key为范围的起点，Value为范围的终点（不包含），Value为空表示直到末尾
+	LogRecordRangeDelete
 )
 
-// crc type keySize valueSize
-// 4 + 1 + 5 + 5 = 15
-const maxLogRecordHeaderSize = 4 + 1 + binary.MaxVarintLen32*2
+// 类型字节的低四位为记录类型，高四位标识头部中是否存在对应的可选字段
+const (
+	logRecordTypeMask   byte = 0x0f
+	logRecordFlagSeqNo  byte = 1 << 4
+	logRecordFlagExpire byte = 1 << 5
+	// value经过压缩，头部末尾多一个字节记录压缩算法
+	logRecordFlagCompressed byte = 1 << 6
+	// key和value经过加密，头部末尾多四个字节记录密钥标识
+	logRecordFlagEncrypted byte = 1 << 7
+)
+
+// crc type keySize valueSize seqNo expire compression keyId
+// 4 + 1 + 5 + 5 + 10 + 10 + 1 + 4 = 40
+const maxLogRecordHeaderSize = 4 + 1 + binary.MaxVarintLen32*2 + binary.MaxVarintLen64*2 + 1 + keyIdSize
 
 // LogRecord 数据日志记录
 type LogRecord struct {
 	Key   []byte
 	Value []byte
 	Type  LogRecordType
+	//事务序列号，为0表示不属于任何事务
+	SeqNo uint64
+	//过期时间，单位为纳秒的unix时间戳，为0表示永不过期
+	Expire int64
+	//编码时value使用的压缩算法，压缩后没有变小的value不会被压缩。
+	//读取时value已经被解压，该字段为记录实际使用的压缩算法
+	Compression CompressionType
 }
 
 // logRecordHeader 日志记录头部
 type logRecordHeader struct {
-	crc       uint32
-	typ       LogRecordType
-	keySize   uint32
-	valueSize uint32
+	crc         uint32
+	typ         LogRecordType
+	keySize     uint32
+	valueSize   uint32
+	seqNo       uint64
+	expire      int64
+	compression CompressionType
+	encrypted   bool
+	keyId       uint32
 }
 
 // LogRecordPos 描述数据在磁盘上的位置
 type LogRecordPos struct {
 	Fid    uint32 // 文件ID，表示数据存储到了哪个文件
 	Offset int64  // 数据在文件中的偏移
+	Size   uint32 // 数据在磁盘上占据的大小
+	Expire int64  // 过期时间，为0表示永不过期
+}
+
+// IsExpired 判断数据在指定时间是否已经过期
+func (pos *LogRecordPos) IsExpired(now int64) bool {
+	return pos.Expire != 0 && pos.Expire <= now
 }
 
-// EncodeLogRecord 编码日志记录，由CRC，type，keySize，valueSize，key，value组成
+// EncodeLogRecord 编码日志记录，由CRC，type，keySize，valueSize，可选的seqNo，expire，压缩算法和密钥标识，key，value组成
 func EncodeLogRecord(logRecord *LogRecord) ([]byte, int64) {
+	return EncodeLogRecordWithCipher(logRecord, nil)
+}
+
+// EncodeLogRecordWithCipher 编码并加密日志记录，c为nil时不加密。
+// 加密时key和value作为一个整体加密，头部中的keySize仍然为明文key的长度，valueSize为剩余密文的长度
+func EncodeLogRecordWithCipher(logRecord *LogRecord, c *Cipher) ([]byte, int64) {
+	value := logRecord.Value
+	compressed, ok := compressValue(logRecord.Compression, value)
+	if ok {
+		value = compressed
+	}
 	header := make([]byte, maxLogRecordHeaderSize)
 	//前四个字节为CRC，需要最后计算
 	var index = 0
 	index += crc32.Size
 	header[index] = logRecord.Type
+	if logRecord.SeqNo != 0 {
+		header[index] |= logRecordFlagSeqNo
+	}
+	if logRecord.Expire != 0 {
+		header[index] |= logRecordFlagExpire
+	}
+	if ok {
+		header[index] |= logRecordFlagCompressed
+	}
+	//加密后key和value的总大小
+	kvSize := len(logRecord.Key) + len(value)
+	if c != nil {
+		header[index] |= logRecordFlagEncrypted
+		kvSize = c.sealedSize(kvSize)
+	}
 	index = 5
 	//从5开始存储keySize和valueSize
 	index += binary.PutUvarint(header[index:], uint64(uint32(len(logRecord.Key))))
-	index += binary.PutUvarint(header[index:], uint64(int64(len(logRecord.Value))))
-	var size = index + len(logRecord.Key) + len(logRecord.Value)
+	index += binary.PutUvarint(header[index:], uint64(int64(kvSize-len(logRecord.Key))))
+	if logRecord.SeqNo != 0 {
+		index += binary.PutUvarint(header[index:], logRecord.SeqNo)
+	}
+	if logRecord.Expire != 0 {
+		index += binary.PutVarint(header[index:], logRecord.Expire)
+	}
+	if ok {
+		header[index] = logRecord.Compression
+		index++
+	}
+	if c != nil {
+		binary.LittleEndian.PutUint32(header[index:], c.keyId)
+		index += keyIdSize
+	}
+	var size = index + kvSize
 	encBytes := make([]byte, size)
 	//将header和key，value拷贝到encBytes中
 	copy(encBytes[:index], header[:index])
-	copy(encBytes[index:], logRecord.Key)
-	copy(encBytes[index+len(logRecord.Key):], logRecord.Value)
+	if c != nil {
+		//头部参与认证，防止被篡改
+		plaintext := make([]byte, 0, len(logRecord.Key)+len(value))
+		plaintext = append(append(plaintext, logRecord.Key...), value...)
+		c.seal(encBytes[index:], plaintext, encBytes[crc32.Size:index])
+	} else {
+		copy(encBytes[index:], logRecord.Key)
+		copy(encBytes[index+len(logRecord.Key):], value)
+	}
 	//计算CRC
 	crc := crc32.ChecksumIEEE(encBytes[crc32.Size:])
 	binary.LittleEndian.PutUint32(encBytes[:crc32.Size], crc)
 	return encBytes, int64(size)
 }
 
+// EncodeLogRecordPos 编码日志记录的位置信息，过期时间只在设置了的时候才写入
+func EncodeLogRecordPos(pos *LogRecordPos) []byte {
+	buf := make([]byte, binary.MaxVarintLen32*2+binary.MaxVarintLen64*2)
+	var index = 0
+	index += binary.PutUvarint(buf[index:], uint64(pos.Fid))
+	index += binary.PutVarint(buf[index:], pos.Offset)
+	index += binary.PutUvarint(buf[index:], uint64(pos.Size))
+	if pos.Expire != 0 {
+		index += binary.PutVarint(buf[index:], pos.Expire)
+	}
+	return buf[:index]
+}
+
+// DecodeLogRecordPos 解码日志记录的位置信息
+func DecodeLogRecordPos(buf []byte) *LogRecordPos {
+	var index = 0
+	fileId, n := binary.Uvarint(buf[index:])
+	index += n
+	offset, n := binary.Varint(buf[index:])
+	index += n
+	size, n := binary.Uvarint(buf[index:])
+	index += n
+	pos := &LogRecordPos{Fid: uint32(fileId), Offset: offset, Size: uint32(size)}
+	if index < len(buf) {
+		pos.Expire, _ = binary.Varint(buf[index:])
+	}
+	return pos
+}
+
+// EncodeHintRecord 编码hint文件中的记录，只保存key，类型和位置信息，不保存value，c不为nil时加密。
+// 范围删除记录还需要保存范围的终点，位置信息之前会加上终点的长度和终点
+func EncodeHintRecord(logRecord *LogRecord, pos *LogRecordPos, c *Cipher) []byte {
+	value := EncodeLogRecordPos(pos)
+	if logRecord.Type == LogRecordRangeDelete {
+		buf := make([]byte, binary.MaxVarintLen32, binary.MaxVarintLen32+len(logRecord.Value)+len(value))
+		n := binary.PutUvarint(buf, uint64(len(logRecord.Value)))
+		value = append(append(buf[:n], logRecord.Value...), value...)
+	}
+	hintRecord := &LogRecord{
+		Key:   logRecord.Key,
+		Value: value,
+		Type:  logRecord.Type,
+		SeqNo: logRecord.SeqNo,
+	}
+	encRecord, _ := EncodeLogRecordWithCipher(hintRecord, c)
+	return encRecord
+}
+
+// DecodeHintRecord 解码hint文件中读取到的记录，返回位置信息，
+// 记录的Value会被替换为对应数据记录的Value，只有范围删除记录的Value不为空
+func DecodeHintRecord(hintRecord *LogRecord) *LogRecordPos {
+	buf := hintRecord.Value
+	hintRecord.Value = nil
+	if hintRecord.Type == LogRecordRangeDelete {
+		endSize, n := binary.Uvarint(buf)
+		hintRecord.Value = buf[n : n+int(endSize)]
+		buf = buf[n+int(endSize):]
+	}
+	return DecodeLogRecordPos(buf)
+}
+
 // decodeLogRecordHeader 解码日志记录头部，注意传入的字节切片可能会比实际的头部大，结果中会返回实际的头部字节大小
 func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	if len(buf) <= crc32.Size {
@@ -67,16 +208,55 @@ func decodeLogRecordHeader(buf []byte) (*logRecordHeader, int64) {
 	}
 	header := &logRecordHeader{
 		crc: binary.LittleEndian.Uint32(buf[:crc32.Size]),
-		typ: buf[crc32.Size],
+		typ: buf[crc32.Size] & logRecordTypeMask,
 	}
+	flags := buf[crc32.Size] &^ logRecordTypeMask
 	var index = 5
 	//取出实际的keySize和valueSize
+	//变长编码的字段不完整时返回nil
 	keySize, keySizeLen := binary.Uvarint(buf[index:])
+	if keySizeLen <= 0 {
+		return nil, 0
+	}
 	header.keySize = uint32(keySize)
 	index += keySizeLen
 	valueSize, valueSizeLen := binary.Uvarint(buf[index:])
+	if valueSizeLen <= 0 {
+		return nil, 0
+	}
 	header.valueSize = uint32(valueSize)
 	index += valueSizeLen
+	if flags&logRecordFlagSeqNo != 0 {
+		seqNo, seqNoLen := binary.Uvarint(buf[index:])
+		if seqNoLen <= 0 {
+			return nil, 0
+		}
+		header.seqNo = seqNo
+		index += seqNoLen
+	}
+	if flags&logRecordFlagExpire != 0 {
+		expire, expireLen := binary.Varint(buf[index:])
+		if expireLen <= 0 {
+			return nil, 0
+		}
+		header.expire = expire
+		index += expireLen
+	}
+	if flags&logRecordFlagCompressed != 0 {
+		if index >= len(buf) {
+			return nil, 0
+		}
+		header.compression = buf[index]
+		index++
+	}
+	if flags&logRecordFlagEncrypted != 0 {
+		if index+keyIdSize > len(buf) {
+			return nil, 0
+		}
+		header.encrypted = true
+		header.keyId = binary.LittleEndian.Uint32(buf[index:])
+		index += keyIdSize
+	}
 	return header, int64(index)
 }
 
@@ -1,6 +1,7 @@
 package data
 
 import (
+	"bytes"
 	"hash/crc32"
 	"testing"
 
@@ -63,3 +64,89 @@ func TestDecodeLogRecordHeaderWithInsufficientData(t *testing.T) {
 	// Assert that the decoded header is nil
 	assert.Nil(t, decodedHeader)
 }
+
+func TestEncodeDecodeLogRecordPos(t *testing.T) {
+	pos := &LogRecordPos{Fid: 12, Offset: 987654321, Size: 1024}
+	assert.Equal(t, pos, DecodeLogRecordPos(EncodeLogRecordPos(pos)))
+
+	pos = &LogRecordPos{Fid: 0, Offset: 0}
+	assert.Equal(t, pos, DecodeLogRecordPos(EncodeLogRecordPos(pos)))
+
+	pos = &LogRecordPos{Fid: 3, Offset: 100, Size: 64, Expire: 1700000000000000000}
+	assert.Equal(t, pos, DecodeLogRecordPos(EncodeLogRecordPos(pos)))
+}
+
+func TestEncodeDecodeLogRecordWithSeqNo(t *testing.T) {
+	originalRecord := &LogRecord{
+		Key:   []byte("TestKey"),
+		Value: []byte("TestValue"),
+		Type:  LogRecordDelete,
+		SeqNo: 1024,
+	}
+	encodedRecord, size := EncodeLogRecord(originalRecord)
+	assert.Equal(t, int64(len(encodedRecord)), size)
+
+	decodedHeader, headerSize := decodeLogRecordHeader(encodedRecord)
+	assert.Equal(t, originalRecord.Type, decodedHeader.typ)
+	assert.Equal(t, originalRecord.SeqNo, decodedHeader.seqNo)
+	assert.Equal(t, uint32(len(originalRecord.Key)), decodedHeader.keySize)
+	assert.Equal(t, getLogRecordCRC(originalRecord, encodedRecord[:headerSize]), decodedHeader.crc)
+}
+
+func TestEncodeDecodeLogRecordWithExpire(t *testing.T) {
+	originalRecord := &LogRecord{
+		Key:    []byte("TestKey"),
+		Value:  []byte("TestValue"),
+		Type:   LogRecordNormal,
+		SeqNo:  7,
+		Expire: 1700000000000000000,
+	}
+	encodedRecord, _ := EncodeLogRecord(originalRecord)
+
+	decodedHeader, headerSize := decodeLogRecordHeader(encodedRecord)
+	assert.Equal(t, originalRecord.Type, decodedHeader.typ)
+	assert.Equal(t, originalRecord.SeqNo, decodedHeader.seqNo)
+	assert.Equal(t, originalRecord.Expire, decodedHeader.expire)
+	assert.Equal(t, getLogRecordCRC(originalRecord, encodedRecord[:headerSize]), decodedHeader.crc)
+
+	// Records without expiration keep the old layout
+	encodedRecord, _ = EncodeLogRecord(&LogRecord{Key: []byte("TestKey"), Value: []byte("TestValue")})
+	decodedHeader, _ = decodeLogRecordHeader(encodedRecord)
+	assert.Equal(t, int64(0), decodedHeader.expire)
+	assert.Equal(t, byte(0), encodedRecord[4])
+}
+
+func TestEncodeLogRecordWithCompression(t *testing.T) {
+	originalRecord := &LogRecord{
+		Key:         []byte("TestKey"),
+		Value:       bytes.Repeat([]byte(`{"name":"skv","type":"json"}`), 64),
+		Type:        LogRecordNormal,
+		Compression: DeflateCompression,
+	}
+	encodedRecord, size := EncodeLogRecord(originalRecord)
+	assert.Less(t, size, int64(len(originalRecord.Value)))
+
+	decodedHeader, headerSize := decodeLogRecordHeader(encodedRecord)
+	assert.Equal(t, DeflateCompression, decodedHeader.compression)
+	assert.Equal(t, int64(len(encodedRecord)), headerSize+int64(decodedHeader.keySize)+int64(decodedHeader.valueSize))
+
+	// Values that do not shrink are stored raw
+	encodedRecord, _ = EncodeLogRecord(&LogRecord{Key: []byte("TestKey"), Value: []byte("v"), Compression: DeflateCompression})
+	decodedHeader, _ = decodeLogRecordHeader(encodedRecord)
+	assert.Equal(t, NoCompression, decodedHeader.compression)
+	assert.Equal(t, byte(0), encodedRecord[4])
+}
+
+func TestEncodeDecodeHintRecord_RangeDelete(t *testing.T) {
+	pos := &LogRecordPos{Fid: 2, Offset: 64, Size: 20}
+	for _, end := range [][]byte{[]byte("tenant;"), nil} {
+		logRecord := &LogRecord{Key: []byte("tenant:"), Value: end, Type: LogRecordRangeDelete}
+		encRecord := EncodeHintRecord(logRecord, pos, nil)
+		header, headerSize := decodeLogRecordHeader(encRecord)
+		hintRecord := &LogRecord{Type: header.typ, Value: encRecord[headerSize+int64(header.keySize):]}
+
+		assert.Equal(t, pos, DecodeHintRecord(hintRecord))
+		assert.Equal(t, len(end), len(hintRecord.Value))
+		assert.Equal(t, string(end), string(hintRecord.Value))
+	}
+}
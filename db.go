@@ -5,12 +5,23 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"skv-go/data"
+	"skv-go/fio"
 	"skv-go/index"
+	"skv-go/utils"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// 数据目录中的文件锁名称
+	fileLockName = "flock"
+	// 使用磁盘索引时保存事务序列号的文件名称
+	seqNoFileName = "seq-no"
 )
 
 type DB struct {
@@ -24,15 +35,84 @@ type DB struct {
 	index index.Indexer
 	//文件id列表，仅在加载索引时使用
 	fileIds []uint32
+	//是否正在进行merge
+	isMerging bool
+	//活跃文件中记录对应的hint数据，活跃文件转换为旧文件时写入hint文件
+	activeHints []byte
+	//当前事务序列号，全局递增
+	seqNo uint64
+	//是否正在提交批次，以及批次开始写入时的活跃文件id，一个批次可能跨越多个数据文件
+	committing bool
+	commitFid  uint32
+	//文件锁，保证多个进程之间只能有一个实例使用数据目录
+	fileLock *fio.FileLock
+	//设置了过期时间的key
+	expireKeys *expireKeys
+	//用于停止后台清理过期key的协程
+	sweepStop chan struct{}
+	sweepDone *sync.WaitGroup
+	//启动时从活跃文件末尾丢弃的字节数
+	truncatedTailSize int64
+	//被覆盖或删除的无效数据大小，可以通过merge回收
+	reclaimSize int64
+	//配置了密钥时用于加密和解密记录
+	cipher *data.Cipher
+	//仍在读取数据文件的快照和监听的数量
+	fileRefs int
+	//merge替换掉但仍可能被快照或监听读取的数据文件，全部释放之后关闭
+	retiredFiles []*data.DataFile
+	//正在监听数据变更的监听者
+	watchers map[*Watcher]struct{}
+	//用于等待监听的协程退出
+	watchDone *sync.WaitGroup
+	//是否为只读的副本，副本只能通过复制写入数据
+	readOnly bool
+	//是否已经加载完成，加载失败时关闭实例不能覆盖保存的事务序列号
+	loaded bool
+	//副本中还没有读到事务完成标识的事务记录
+	replicaTxnRecords map[uint64][]*txnRecord
+	//启动后追加的记录数量，用于计算副本落后的记录数
+	appendCount int64
+	//完成的merge次数，merge会重写旧的数据文件，正在复制的副本需要重新同步
+	mergeCount uint64
+	//有新的记录追加或者完成merge时关闭，用于唤醒等待的复制连接
+	appendNotify chan struct{}
+}
+
+// Stat 数据库的统计信息
+type Stat struct {
+	//key的数量
+	KeyNum uint
+	//数据文件的数量
+	DataFileNum uint
+	//可以通过merge回收的数据大小，单位字节
+	ReclaimableSize int64
+	//数据目录占据的磁盘空间大小，单位字节
+	DiskSize int64
 }
 
 // Open 打开数据库实例
 func Open(options Options) (*DB, error) {
+	return open(options, false)
+}
+
+// open 打开数据库实例，只读的副本不会启动后台清理，过期key的删除记录由主节点复制过来
+func open(options Options, readOnly bool) (*DB, error) {
 	//校验配置项
 	if err := checkOptions(options); err != nil {
 		return nil, err
 	}
 
+	//配置了密钥时，所有新写入的记录都会被加密
+	var dataCipher *data.Cipher
+	if len(options.EncryptionKey) > 0 {
+		c, err := data.NewCipher(options.EncryptionKey, options.PreviousEncryptionKeys...)
+		if err != nil {
+			return nil, err
+		}
+		dataCipher = c
+	}
+
 	//如果配置项中的文件路径不存在，则创建
 	if _, err := os.Stat(options.DirPath); err != nil {
 		if err := os.MkdirAll(options.DirPath, os.ModePerm); err != nil {
@@ -40,32 +120,171 @@ func Open(options Options) (*DB, error) {
 		}
 	}
 
+	//判断数据目录是否正在被使用
+	fileLock, err := LockDataDir(options.DirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	//磁盘索引文件不存在时，需要从数据文件中重建
+	var rebuildIndex bool
+	if options.IndexType == index.BPlusTreeIndex {
+		_, err := os.Stat(filepath.Join(options.DirPath, index.BPlusTreeIndexFileName))
+		rebuildIndex = os.IsNotExist(err)
+	}
+	indexer, err := index.NewIndexer(options.IndexType, options.DirPath, options.SyncWrite)
+	if err != nil {
+		_ = fileLock.Unlock()
+		return nil, err
+	}
+
 	//初始化DB实例结构体
 	db := &DB{
 		options:    options,
 		rw:         new(sync.RWMutex),
 		olderFiles: make(map[uint32]*data.DataFile),
-		index:      index.NewIndexer(options.IndexType),
+		index:      indexer,
+		fileLock:   fileLock,
+		expireKeys: newExpireKeys(),
+		cipher:     dataCipher,
+		watchers:   make(map[*Watcher]struct{}),
+		watchDone:  new(sync.WaitGroup),
+		readOnly:   readOnly,
 	}
 
-	//加载数据文件
-	if err := db.loadDataFiles(); err != nil {
+	if err := db.load(rebuildIndex); err != nil {
+		_ = db.Close()
 		return nil, err
 	}
-	if err := db.loadIndexFromDataFiles(); err != nil {
-		return nil, err
+	db.loaded = true
+	if !readOnly {
+		db.startExpireSweeper()
 	}
 	return db, nil
 }
 
-// Close 关闭数据库实例
-func (db *DB) Close() error {
+// LockDataDir 对数据目录加文件锁，目录正在被其他实例使用时返回ErrDatabaseIsUsing，
+// 不打开数据库直接读取数据文件时需要先加锁
+func LockDataDir(dirPath string) (*fio.FileLock, error) {
+	fileLock, ok, err := fio.TryLockFile(filepath.Join(dirPath, fileLockName))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrDatabaseIsUsing
+	}
+	return fileLock, nil
+}
+
+// load 加载merge目录，数据文件以及内存索引
+func (db *DB) load(rebuildIndex bool) error {
+	//处理merge目录
+	nonMergeFileId, mergeFileCount, err := db.applyMergeFiles()
+	if err != nil {
+		return err
+	}
+
+	//加载数据文件
+	if err := db.loadDataFiles(); err != nil {
+		return err
+	}
+	if persistentIndex, ok := db.index.(index.PersistentIndexer); ok && !rebuildIndex {
+		//磁盘索引只需要更新merge后的位置，并重放活跃文件中可能还没有写入索引的记录
+		if mergeFileCount >= 0 {
+			if err := db.loadIndexFromMergedFiles(nonMergeFileId, uint32(mergeFileCount)); err != nil {
+				return err
+			}
+		}
+		replayFid, ok, err := db.loadSeqNo()
+		if err != nil {
+			return err
+		}
+		//不遍历整个磁盘索引来找出设置了过期时间的key，启动前写入的key过期后在读取时被过滤，并在merge时清理
+		if len(db.fileIds) > 0 {
+			replayFileIds := db.fileIds[len(db.fileIds)-1:]
+			//从还有未完成事务的最早的文件开始重放，事务完成的标识可能写在之后的文件中
+			if ok {
+				idx := sort.Search(len(db.fileIds), func(i int) bool { return db.fileIds[i] >= replayFid })
+				replayFileIds = db.fileIds[min(idx, len(db.fileIds)-1):]
+			}
+			if err := db.loadIndexFromDataFiles(replayFileIds); err != nil {
+				return err
+			}
+		}
+		if err := persistentIndex.Sync(); err != nil {
+			return err
+		}
+	} else if err := db.loadIndexFromDataFiles(db.fileIds); err != nil {
+		return err
+	}
+	//索引更新完成后才能删除merge目录
+	if mergeFileCount >= 0 {
+		if err := os.RemoveAll(db.getMergePath()); err != nil {
+			return err
+		}
+	}
+	//加载完成后切换各个文件的IO类型
+	return db.resetIOType()
+}
+
+// resetIOType 活跃文件需要写入，切换回标准文件IO，旧文件根据配置决定是否使用内存文件映射
+func (db *DB) resetIOType() error {
 	if db.activeFile == nil {
 		return nil
 	}
+	if db.options.MMapAtStartup {
+		if err := db.activeFile.SetIOManager(db.options.DirPath, fio.StandardFIO); err != nil {
+			return err
+		}
+	}
+	if db.options.MMapAtStartup == db.options.MMapOlderFiles {
+		return nil
+	}
+	for _, dataFile := range db.olderFiles {
+		if err := dataFile.SetIOManager(db.options.DirPath, db.olderFilesIOType()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// olderFilesIOType 旧文件使用的IO类型
+func (db *DB) olderFilesIOType() fio.FileIOType {
+	if db.options.MMapOlderFiles {
+		return fio.MemoryMap
+	}
+	return fio.StandardFIO
+}
+
+// Close 关闭数据库实例
+func (db *DB) Close() error {
+	//后台清理需要获取锁，必须在加锁之前停止
+	db.stopExpireSweeper()
+	//监听的协程退出时需要获取锁，同样需要在加锁之前关闭
+	db.closeWatchers()
 	db.rw.Lock()
 	defer db.rw.Unlock()
 
+	//释放文件锁
+	defer func() {
+		if db.fileLock != nil {
+			_ = db.fileLock.Unlock()
+			db.fileLock = nil
+		}
+	}()
+
+	//关闭索引
+	if err := db.index.Close(); err != nil {
+		return err
+	}
+	if db.activeFile == nil {
+		return nil
+	}
+	if db.loaded {
+		if err := db.writeSeqNo(db.replayStartFid(db.activeFile.FileId)); err != nil {
+			return err
+		}
+	}
 	if err := db.activeFile.Close(); err != nil {
 		return err
 	}
@@ -76,7 +295,7 @@ func (db *DB) Close() error {
 			return err
 		}
 	}
-	return nil
+	return db.closeRetiredFiles()
 }
 
 func (db *DB) Sync() error {
@@ -85,11 +304,22 @@ func (db *DB) Sync() error {
 	}
 	db.rw.Lock()
 	defer db.rw.Unlock()
-	return db.activeFile.Sync()
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	if persistentIndex, ok := db.index.(index.PersistentIndexer); ok {
+		return persistentIndex.Sync()
+	}
+	return nil
 }
 
 // Put 写入Key/Value数据，Key不能为空
 func (db *DB) Put(key []byte, value []byte) error {
+	return db.put(key, value, 0)
+}
+
+// put 写入数据并更新索引，expire为0表示永不过期
+func (db *DB) put(key []byte, value []byte, expire int64) error {
 	//判断key是否为空
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -97,20 +327,29 @@ func (db *DB) Put(key []byte, value []byte) error {
 
 	//构造logRecord
 	logRecord := data.LogRecord{
-		Key:   key,
-		Value: value,
-		Type:  data.LogRecordNormal,
+		Key:    key,
+		Value:  value,
+		Type:   data.LogRecordNormal,
+		Expire: expire,
 	}
+	//写入和更新索引需要在同一个锁内完成，避免后台清理时删除掉新写入的数据
+	db.rw.Lock()
+	defer db.rw.Unlock()
 	pos, err := db.appendLogRecord(&logRecord)
 	if err != nil {
 		return err
 	}
-	//更新内存索引
-	if db.index.Put(key, pos) {
-		return nil
-	} else {
+	//更新内存索引，被覆盖的旧数据成为无效数据
+	oldPos := db.index.Get(key)
+	if !db.index.Put(key, pos) {
 		return ErrIndexUpdate
 	}
+	if oldPos != nil {
+		db.reclaimSize += int64(oldPos.Size)
+	}
+	db.expireKeys.add(key, expire)
+	db.emitEvent(&logRecord, pos)
+	return nil
 }
 
 // Get 读取Key对应的Value，Key不能为空
@@ -122,20 +361,23 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 		return nil, ErrKeyIsEmpty
 	}
 	pos := db.index.Get(key)
-	if pos == nil {
+	if pos == nil || pos.IsExpired(time.Now().UnixNano()) {
 		return nil, ErrKeyNotFound
 	}
 	return db.getValueByPosition(pos)
 }
 
-// ListKeys 获取数据库中的所有key
+// ListKeys 获取数据库中的所有key，不包括已经过期的key
 func (db *DB) ListKeys() [][]byte {
 	iterator := db.index.Iterator(false)
-	keys := make([][]byte, db.index.Size())
-	var idx int
+	defer iterator.Close()
+	now := time.Now().UnixNano()
+	keys := make([][]byte, 0, db.index.Size())
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
-		keys[idx] = iterator.Key()
-		idx++
+		if iterator.Value().IsExpired(now) {
+			continue
+		}
+		keys = append(keys, iterator.Key())
 	}
 	return keys
 }
@@ -146,7 +388,12 @@ func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 	defer db.rw.RUnlock()
 
 	iterator := db.index.Iterator(false)
+	defer iterator.Close()
+	now := time.Now().UnixNano()
 	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		if iterator.Value().IsExpired(now) {
+			continue
+		}
 		key := iterator.Key()
 		value, err := db.getValueByPosition(iterator.Value())
 		if err != nil {
@@ -159,14 +406,48 @@ func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 	return nil
 }
 
+// KeyValue Scan返回的一对key和value
+type KeyValue struct {
+	Key   []byte
+	Value []byte
+}
+
+// Scan 按顺序获取[start, end)范围内的数据，start为nil表示从头开始，end为nil表示直到末尾，
+// limit小于等于0表示不限制数量
+func (db *DB) Scan(start, end []byte, limit int) ([]KeyValue, error) {
+	iterator := db.NewIterator(IteratorOptions{LowerBound: start, UpperBound: end})
+	defer iterator.Close()
+
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+	var result []KeyValue
+	for ; iterator.Valid(); iterator.Next() {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		value, err := db.getValueByPosition(iterator.indexIter.Value())
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, KeyValue{Key: iterator.Key(), Value: value})
+	}
+	return result, nil
+}
+
 func (db *DB) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
 	//找到数据文件
 	var dataFile *data.DataFile
-	if pos.Fid == db.activeFile.FileId {
+	//副本重新同步时会清空所有的数据文件，活跃文件可能为空
+	if db.activeFile != nil && pos.Fid == db.activeFile.FileId {
 		dataFile = db.activeFile
 	} else {
 		dataFile = db.olderFiles[pos.Fid]
 	}
+	return readValueFromFile(dataFile, pos)
+}
+
+// readValueFromFile 从数据文件中读取记录的value
+func readValueFromFile(dataFile *data.DataFile, pos *data.LogRecordPos) ([]byte, error) {
 	if dataFile == nil {
 		return nil, ErrDataFileNotFound
 	}
@@ -185,50 +466,92 @@ func (db *DB) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
 
 // Delete 删除一条数据，Key不能为空
 func (db *DB) Delete(key []byte) error {
+	_, err := db.DeleteIfExists(key)
+	return err
+}
+
+// DeleteIfExists 删除一条数据，返回删除之前key是否存在，已经过期的key视为不存在，Key不能为空。
+// 是否存在只通过索引判断，不会读取value，判断和删除在同一次加锁中完成
+func (db *DB) DeleteIfExists(key []byte) (bool, error) {
 	if len(key) == 0 {
-		return ErrKeyIsEmpty
+		return false, ErrKeyIsEmpty
 	}
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
 	//判断key是否存在
-	if db.index.Get(key) == nil {
-		return nil
+	oldPos := db.index.Get(key)
+	if oldPos == nil {
+		return false, nil
 	}
+	exists := !oldPos.IsExpired(time.Now().UnixNano())
 
 	logRecord := data.LogRecord{
 		Key:  key,
 		Type: data.LogRecordDelete,
 	}
-	_, err := db.appendLogRecord(&logRecord)
+	pos, err := db.appendLogRecord(&logRecord)
 	if err != nil {
-		return err
+		return false, err
 	}
+	//删除记录本身以及被删除的数据都是无效数据
+	db.reclaimSize += int64(pos.Size) + int64(oldPos.Size)
 	if !db.index.Delete(key) {
-		return ErrIndexUpdate
+		return false, ErrIndexUpdate
 	}
-	return nil
+	db.emitEvent(&logRecord, pos)
+	return exists, nil
 }
 
-// appendLogRecord 追加一条日志记录，并返回日志记录的位置用于维护索引
-func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+// Stat 获取数据库的统计信息
+// 使用磁盘索引时，启动前产生的无效数据不会被重新统计，可回收的数据大小只是一个估计值
+func (db *DB) Stat() (*Stat, error) {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	dataFileNum := uint(len(db.olderFiles))
+	if db.activeFile != nil {
+		dataFileNum++
+	}
+	diskSize, err := utils.DirSize(db.options.DirPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Stat{
+		KeyNum:          uint(db.index.Size()),
+		DataFileNum:     dataFileNum,
+		ReclaimableSize: db.reclaimSize,
+		DiskSize:        diskSize,
+	}, nil
+}
+
+// appendLogRecordWithLock 加锁后追加一条日志记录
+func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
 	db.rw.Lock()
 	defer db.rw.Unlock()
+	return db.appendLogRecord(logRecord)
+}
+
+// appendLogRecord 追加一条日志记录，并返回日志记录的位置用于维护索引
+// 使用该方法需要加锁
+func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
+	if db.readOnly {
+		return nil, ErrReadOnlyReplica
+	}
 	if db.activeFile == nil {
 		if err := db.setActiveFile(); err != nil {
 			return nil, err
 		}
 	}
-	encRecode, size := data.EncodeLogRecord(logRecord)
+	//只压缩普通记录的value，merge重写时会使用当前配置的压缩算法
+	if logRecord.Type == data.LogRecordNormal {
+		logRecord.Compression = db.options.Compression
+	}
+	encRecode, size := data.EncodeLogRecordWithCipher(logRecord, db.cipher)
 	//如果写入的数据已经达到活跃文件的阈值，则将活跃文件设置为旧文件，并创建一个新的活跃文件
 	if db.activeFile.WriteOff+size > db.options.DataFileSize {
 		log.Print("active file is full, create a new one")
-		//先持久化数据文件
-		if err := db.activeFile.Sync(); err != nil {
-			return nil, err
-		}
-
-		db.olderFiles[db.activeFile.FileId] = db.activeFile
-
-		//创建新活跃文件
-		if err := db.setActiveFile(); err != nil {
+		if err := db.rotateActiveFile(); err != nil {
 			return nil, err
 		}
 	}
@@ -243,10 +566,63 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 		}
 	}
 	//构造内存索引信息
-	return &data.LogRecordPos{
+	pos := &data.LogRecordPos{
 		Fid:    db.activeFile.FileId,
 		Offset: writeOff,
-	}, nil
+		Size:   uint32(size),
+		Expire: logRecord.Expire,
+	}
+	db.activeHints = append(db.activeHints, data.EncodeHintRecord(logRecord, pos, db.cipher)...)
+	db.appendCount++
+	db.notifyAppend()
+	return pos, nil
+}
+
+// rotateActiveFile 将活跃文件转换为旧文件并写入对应的hint文件，然后创建一个新的活跃文件
+// 使用该方法需要加锁
+func (db *DB) rotateActiveFile() error {
+	if err := db.retireActiveFile(); err != nil {
+		return err
+	}
+	//创建新活跃文件
+	return db.setActiveFile()
+}
+
+// retireActiveFile 持久化活跃文件并将其转换为旧文件，使用该方法需要加锁
+func (db *DB) retireActiveFile() error {
+	//先持久化数据文件
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	if err := db.writeActiveHintFile(); err != nil {
+		return err
+	}
+	//活跃文件中的记录不会再被重放，磁盘索引需要持久化
+	if persistentIndex, ok := db.index.(index.PersistentIndexer); ok {
+		if err := persistentIndex.Sync(); err != nil {
+			return err
+		}
+		if err := db.writeSeqNo(db.replayStartFid(db.activeFile.FileId + 1)); err != nil {
+			return err
+		}
+	}
+	if db.options.MMapOlderFiles {
+		if err := db.activeFile.SetIOManager(db.options.DirPath, fio.MemoryMap); err != nil {
+			return err
+		}
+	}
+	db.olderFiles[db.activeFile.FileId] = db.activeFile
+	return nil
+}
+
+// writeActiveHintFile 写入活跃文件对应的hint文件
+// 使用该方法需要加锁
+func (db *DB) writeActiveHintFile() error {
+	if err := data.WriteHintFile(db.options.DirPath, db.activeFile.FileId, db.activeHints); err != nil {
+		return err
+	}
+	db.activeHints = nil
+	return nil
 }
 
 // setActiveFile 设置当前活跃的数据文件，如果当前没有活跃的数据文件，则创建一个新的数据文件，并设置为活跃文件
@@ -256,7 +632,7 @@ func (db *DB) setActiveFile() error {
 	if db.activeFile != nil {
 		initFileId = db.activeFile.FileId + 1
 	}
-	dataFile, err := data.OpenDataFile(db.options.DirPath, initFileId)
+	dataFile, err := db.openDataFile(initFileId, fio.StandardFIO)
 	if err != nil {
 		return err
 	}
@@ -264,11 +640,11 @@ func (db *DB) setActiveFile() error {
 	return nil
 }
 
-// loadDataFiles 加载数据文件
-func (db *DB) loadDataFiles() error {
-	dirEntries, err := os.ReadDir(db.options.DirPath)
+// getDataFileIds 获取目录中所有数据文件的id，按从小到大的顺序返回
+func getDataFileIds(dirPath string) ([]uint32, error) {
+	dirEntries, err := os.ReadDir(dirPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var fileIds []uint32
 	//遍历目录中的所有文件，找到以.data结尾的文件
@@ -277,7 +653,7 @@ func (db *DB) loadDataFiles() error {
 			splitName := strings.Split(dirEntry.Name(), ".")
 			fileId, err := strconv.Atoi(splitName[0])
 			if err != nil {
-				return ErrDataDirCorrupt
+				return nil, ErrDataDirCorrupt
 			}
 			fileIds = append(fileIds, uint32(fileId))
 		}
@@ -286,10 +662,34 @@ func (db *DB) loadDataFiles() error {
 	sort.Slice(fileIds, func(i, j int) bool {
 		return fileIds[i] < fileIds[j]
 	})
+	return fileIds, nil
+}
+
+// openDataFile 打开数据文件，并设置解密使用的密钥
+func (db *DB) openDataFile(fileId uint32, ioType fio.FileIOType) (*data.DataFile, error) {
+	dataFile, err := data.OpenDataFile(db.options.DirPath, fileId, ioType)
+	if err != nil {
+		return nil, err
+	}
+	dataFile.Cipher = db.cipher
+	return dataFile, nil
+}
+
+// loadDataFiles 加载数据文件
+func (db *DB) loadDataFiles() error {
+	fileIds, err := getDataFileIds(db.options.DirPath)
+	if err != nil {
+		return err
+	}
 	db.fileIds = fileIds
+	//启动时可以使用内存文件映射加速索引的加载
+	ioType := fio.StandardFIO
+	if db.options.MMapAtStartup {
+		ioType = fio.MemoryMap
+	}
 	//加载数据文件
 	for i, fileId := range fileIds {
-		dataFile, err := data.OpenDataFile(db.options.DirPath, fileId)
+		dataFile, err := db.openDataFile(fileId, ioType)
 		if err != nil {
 			return err
 		}
@@ -302,53 +702,264 @@ func (db *DB) loadDataFiles() error {
 	return nil
 }
 
-// loadIndexFromDataFiles 加载索引数据文件
-func (db *DB) loadIndexFromDataFiles() error {
-	if len(db.fileIds) == 0 {
+// loadIndexFromDataFiles 加载索引数据文件，旧文件存在hint文件时直接从hint文件中加载
+func (db *DB) loadIndexFromDataFiles(fileIds []uint32) error {
+	if len(fileIds) == 0 {
 		return nil
 	}
+	//暂存事务中的记录，读到事务完成的标识后才更新索引
+	txnRecords := make(map[uint64][]*txnRecord)
+	updateIndex := func(logRecord *data.LogRecord, pos *data.LogRecordPos) {
+		db.replayLogRecord(logRecord, pos, txnRecords)
+	}
 	//遍历文件id，取出文件中的记录
-	for _, fileId := range db.fileIds {
-		var dataFile *data.DataFile
+	for _, fileId := range fileIds {
+		//活跃文件需要完整读取，用于确定写入偏移量以及重建hint数据
 		if fileId == db.activeFile.FileId {
-			dataFile = db.activeFile
-		} else {
-			dataFile = db.olderFiles[fileId]
-		}
-
-		//读取dataFile中的所有内容
-		var offset int64 = 0
-		for {
-			logRecord, size, err := dataFile.Read(offset)
-			if err != nil {
-				//如果读取到文件末尾，则跳出循环
-				if err == io.EOF {
-					break
-				}
+			offset, err := db.readDataFile(db.activeFile, func(logRecord *data.LogRecord, pos *data.LogRecordPos) {
+				updateIndex(logRecord, pos)
+				db.activeHints = append(db.activeHints, data.EncodeHintRecord(logRecord, pos, db.cipher)...)
+			})
+			//活跃文件末尾的记录不完整或者校验失败，说明写入时发生了中断
+			if err != nil && err != io.ErrUnexpectedEOF && err != data.ErrInvalidCRC {
 				return err
 			}
-			//构造内存索引
-			logRecordPos := data.LogRecordPos{
-				Fid:    fileId,
-				Offset: offset,
+			//校验失败的记录之后还有数据时，说明损坏发生在文件中间，不能丢弃后面的有效记录
+			if err == data.ErrInvalidCRC {
+				if err := db.checkActiveFileTail(offset); err != nil {
+					return err
+				}
 			}
-			if logRecord.Type == data.LogRecordDelete {
-				db.index.Delete(logRecord.Key)
-			} else {
-				db.index.Put(logRecord.Key, &logRecordPos)
+			if err := db.truncateActiveFileTail(offset); err != nil {
+				return err
 			}
-			//更新offset
-			offset += size
+			//更新db中的写入偏移量
+			db.activeFile.WriteOff = offset
+			continue
+		}
+		if err := db.readIndexRecords(db.olderFiles[fileId], updateIndex); err != nil {
+			return err
 		}
+	}
+	//副本继续复制时，事务完成的标识可能在之后才会收到
+	if db.readOnly {
+		db.replicaTxnRecords = txnRecords
+	}
+	return nil
+}
 
-		//如果是活跃文件，则更新db中的写入偏移量
-		if fileId == db.activeFile.FileId {
-			db.activeFile.WriteOff = offset
+// txnRecord 暂存的事务记录
+type txnRecord struct {
+	record *data.LogRecord
+	pos    *data.LogRecordPos
+}
+
+// replayLogRecord 根据日志记录更新内存索引，事务中的记录会先暂存到txnRecords中，直到读到事务完成的标识
+func (db *DB) replayLogRecord(logRecord *data.LogRecord, pos *data.LogRecordPos, txnRecords map[uint64][]*txnRecord) {
+	updateIndex := func(logRecord *data.LogRecord, pos *data.LogRecordPos) {
+		//范围删除只影响在它之前写入的数据
+		if logRecord.Type == data.LogRecordRangeDelete {
+			db.deleteIndexRange(logRecord.Key, logRecord.Value)
+			db.reclaimSize += int64(pos.Size)
+			return
+		}
+		oldPos := db.index.Get(logRecord.Key)
+		if logRecord.Type == data.LogRecordDelete {
+			db.index.Delete(logRecord.Key)
+			db.reclaimSize += int64(pos.Size)
+		} else {
+			db.index.Put(logRecord.Key, pos)
+			db.expireKeys.add(logRecord.Key, pos.Expire)
+		}
+		if oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
+		}
+	}
+	//不属于事务的记录直接更新索引
+	if logRecord.SeqNo == nonTransactionSeqNo {
+		updateIndex(logRecord, pos)
+		return
+	}
+	if logRecord.SeqNo > db.seqNo {
+		db.seqNo = logRecord.SeqNo
+	}
+	if logRecord.Type == data.LogRecordTxnFinished {
+		db.reclaimSize += int64(pos.Size)
+		for _, txnRecord := range txnRecords[logRecord.SeqNo] {
+			updateIndex(txnRecord.record, txnRecord.pos)
 		}
+		delete(txnRecords, logRecord.SeqNo)
+		return
+	}
+	//暂存时不保留value，减少内存占用
+	txnRecords[logRecord.SeqNo] = append(txnRecords[logRecord.SeqNo], &txnRecord{
+		record: &data.LogRecord{Key: logRecord.Key, Type: logRecord.Type},
+		pos:    pos,
+	})
+}
+
+// readIndexRecords 读取旧文件中用于构建索引的记录，优先从hint文件中读取
+func (db *DB) readIndexRecords(dataFile *data.DataFile, fn func(*data.LogRecord, *data.LogRecordPos)) error {
+	ok, err := db.readHintFile(dataFile.FileId, fn)
+	if err != nil || ok {
+		return err
+	}
+	_, err = db.readDataFile(dataFile, fn)
+	return err
+}
+
+// checkActiveFileTail 检查校验失败的记录是否是活跃文件中的最后一条记录
+func (db *DB) checkActiveFileTail(offset int64) error {
+	size, err := db.activeFile.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	_, recordSize, _ := db.activeFile.Read(offset)
+	if offset+recordSize < size {
+		return ErrActiveFileCorrupted
 	}
 	return nil
 }
 
+// truncateActiveFileTail 将活跃文件截断到最后一条有效记录的末尾，丢弃写入中断时留下的数据
+func (db *DB) truncateActiveFileTail(offset int64) error {
+	size, err := db.activeFile.IOManager.Size()
+	if err != nil {
+		return err
+	}
+	if size <= offset {
+		return nil
+	}
+	if !db.options.TruncateCorruptedTail {
+		return ErrActiveFileCorrupted
+	}
+	//内存文件映射不支持截断，需要先切换回标准文件IO
+	if db.options.MMapAtStartup {
+		if err := db.activeFile.SetIOManager(db.options.DirPath, fio.StandardFIO); err != nil {
+			return err
+		}
+	}
+	if err := db.activeFile.Truncate(offset); err != nil {
+		return err
+	}
+	if err := db.activeFile.Sync(); err != nil {
+		return err
+	}
+	db.truncatedTailSize = size - offset
+	log.Printf("truncated %d corrupted bytes at the tail of data file %d", db.truncatedTailSize, db.activeFile.FileId)
+	return nil
+}
+
+// TruncatedTailSize 获取启动时从活跃文件末尾丢弃的字节数
+func (db *DB) TruncatedTailSize() int64 {
+	return db.truncatedTailSize
+}
+
+// readDataFile 读取数据文件中的所有记录，返回读取到的末尾偏移量，
+// 读取出错时返回最后一条有效记录的末尾偏移量
+func (db *DB) readDataFile(dataFile *data.DataFile, fn func(*data.LogRecord, *data.LogRecordPos)) (int64, error) {
+	offset := dataFile.HeaderSize
+	for {
+		logRecord, size, err := dataFile.Read(offset)
+		if err != nil {
+			//如果读取到文件末尾，则跳出循环
+			if err == io.EOF {
+				break
+			}
+			return offset, err
+		}
+		//构造内存索引
+		fn(logRecord, &data.LogRecordPos{Fid: dataFile.FileId, Offset: offset, Size: uint32(size), Expire: logRecord.Expire})
+		//更新offset
+		offset += size
+	}
+	return offset, nil
+}
+
+// readHintFile 读取数据文件对应的hint文件，hint文件不存在时返回false
+func (db *DB) readHintFile(fileId uint32, fn func(*data.LogRecord, *data.LogRecordPos)) (bool, error) {
+	if _, err := os.Stat(data.GetHintFileName(db.options.DirPath, fileId)); os.IsNotExist(err) {
+		return false, nil
+	}
+	hintFile, err := data.OpenHintFile(db.options.DirPath, fileId)
+	if err != nil {
+		return false, err
+	}
+	hintFile.Cipher = db.cipher
+	defer hintFile.Close()
+
+	var offset int64 = 0
+	for {
+		logRecord, size, err := hintFile.Read(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return false, err
+		}
+		pos := data.DecodeHintRecord(logRecord)
+		fn(logRecord, pos)
+		offset += size
+	}
+	return true, nil
+}
+
+// replayStartFid 获取启动时需要开始重放的文件id，nextFid之前文件中的记录都已经写入索引，
+// 还没有读到事务完成标识的记录除外，使用该方法需要加锁
+func (db *DB) replayStartFid(nextFid uint32) uint32 {
+	fid := nextFid
+	if db.committing {
+		fid = min(fid, db.commitFid)
+	}
+	for _, records := range db.replicaTxnRecords {
+		for _, record := range records {
+			fid = min(fid, record.pos.Fid)
+		}
+	}
+	return fid
+}
+
+// writeSeqNo 使用磁盘索引时保存当前的事务序列号和启动时开始重放的文件id，启动时不会重放全部旧文件，无法从中恢复序列号
+func (db *DB) writeSeqNo(replayFid uint32) error {
+	if _, ok := db.index.(index.PersistentIndexer); !ok {
+		return nil
+	}
+	fileName := filepath.Join(db.options.DirPath, seqNoFileName)
+	content := strconv.FormatUint(db.seqNo, 10) + " " + strconv.FormatUint(uint64(replayFid), 10)
+	if err := os.WriteFile(fileName+".tmp", []byte(content), fio.DataFilePerm); err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
+
+// loadSeqNo 读取保存的事务序列号，并返回开始重放的文件id，旧版本的文件中只有序列号，此时返回false
+func (db *DB) loadSeqNo() (uint32, bool, error) {
+	content, err := os.ReadFile(filepath.Join(db.options.DirPath, seqNoFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 || len(fields) > 2 {
+		return 0, false, ErrDataDirCorrupt
+	}
+	seqNo, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	db.seqNo = seqNo
+	if len(fields) == 1 {
+		return 0, false, nil
+	}
+	replayFid, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return 0, false, err
+	}
+	return uint32(replayFid), true, nil
+}
+
 // checkOptions 校验配置项
 func checkOptions(options Options) error {
 	if options.DirPath == "" {
@@ -357,5 +968,18 @@ func checkOptions(options Options) error {
 	if options.DataFileSize <= 0 {
 		return errors.New("DataFileSize is invalid")
 	}
+	if options.ExpireSweepInterval < 0 {
+		return errors.New("ExpireSweepInterval is invalid")
+	}
+	if options.Compression != data.NoCompression && data.GetCompressor(options.Compression) == nil {
+		return errors.New("Compression is invalid")
+	}
+	if len(options.EncryptionKey) == 0 && len(options.PreviousEncryptionKeys) > 0 {
+		return errors.New("EncryptionKey is empty")
+	}
+	//B+树索引的节点以明文保存在磁盘上，会泄露所有的key
+	if len(options.EncryptionKey) > 0 && options.IndexType == index.BPlusTreeIndex {
+		return errors.New("BPlusTreeIndex can not be used with EncryptionKey")
+	}
 	return nil
 }
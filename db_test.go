@@ -1,10 +1,15 @@
 package skv_go
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
+	"skv-go/data"
+	"skv-go/index"
 	"skv-go/utils"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -122,6 +127,21 @@ func TestDelete(t *testing.T) {
 	// Put a record after it has been deleted
 	err = db.Put([]byte("Hello"), []byte("world"))
 	assert.NoError(t, err)
+
+	// Report whether the key existed
+	exists, err := db.DeleteIfExists([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = db.DeleteIfExists([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	// An expired key does not count as existing
+	assert.NoError(t, db.PutWithTTL([]byte("expired"), []byte("world"), time.Millisecond))
+	time.Sleep(2 * time.Millisecond)
+	exists, err = db.DeleteIfExists([]byte("expired"))
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, db.index.Get([]byte("expired")))
 }
 
 func TestDB_ListKeys(t *testing.T) {
@@ -177,12 +197,480 @@ func TestDB_Fold(t *testing.T) {
 
 func destroyDB(db *DB) {
 	if db != nil {
-		if db.activeFile != nil {
-			_ = db.Close()
-		}
+		_ = db.Close()
 		err := os.RemoveAll(db.options.DirPath)
 		if err != nil {
 			panic(err)
 		}
 	}
 }
+
+func TestDB_HintFile(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-hint")
+
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.NoError(t, db.Put(utils.GetTestKey(1), []byte("Hello")))
+	assert.True(t, len(db.olderFiles) > 0)
+
+	// Every older file has a hint file, the active file does not
+	for fileId := range db.olderFiles {
+		_, err := os.Stat(data.GetHintFileName(dir, fileId))
+		assert.NoError(t, err)
+	}
+	_, err = os.Stat(data.GetHintFileName(dir, db.activeFile.FileId))
+	assert.True(t, os.IsNotExist(err))
+
+	// Restart and load the index from hint files
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2001, len(db.ListKeys()))
+	value, err := db.Get(utils.GetTestKey(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Hello"), value)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Fall back to reading data files when hint files are missing
+	assert.NoError(t, db.Close())
+	for fileId := range db.olderFiles {
+		assert.NoError(t, os.Remove(data.GetHintFileName(dir, fileId)))
+	}
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2001, len(db.ListKeys()))
+	value, err = db.Get(utils.GetTestKey(2999))
+	assert.NoError(t, err)
+	assert.NotNil(t, value)
+}
+
+func TestOpen_DatabaseIsUsing(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-flock")
+
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	// Open the same directory again
+	_, err = Open(options)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+
+	// The lock is released after closing
+	assert.NoError(t, db.Close())
+	db2, err := Open(options)
+	assert.NoError(t, err)
+	assert.NoError(t, db2.Close())
+}
+
+func TestOpen_MMap(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-mmap")
+
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+	options.MMapAtStartup = true
+	options.MMapOlderFiles = true
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	assert.NoError(t, db.Close())
+
+	// Load the index through mmap and keep reading older files through mmap
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2000, len(db.ListKeys()))
+	_, err = db.Get(utils.GetTestKey(0))
+	assert.NoError(t, err)
+	for i := 2000; i < 4000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	_, err = db.Get(utils.GetTestKey(2000))
+	assert.NoError(t, err)
+	assert.NoError(t, db.Merge())
+	_, err = db.Get(utils.GetTestKey(3999))
+	assert.NoError(t, err)
+
+	// Older files are switched back to standard file io
+	options.MMapOlderFiles = false
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 4000, len(db.ListKeys()))
+	assert.NoError(t, db.Put([]byte("Hello"), []byte("world")))
+	value, err := db.Get([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), value)
+}
+
+func TestOpen_ARTIndex(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-art")
+
+	options := DefaultOptions
+	options.DirPath = dir
+	options.IndexType = index.ART
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	assert.NoError(t, db.Delete(utils.GetTestKey(1)))
+	assert.NoError(t, db.Put([]byte("Hello"), []byte("world")))
+
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, len(db.ListKeys()))
+	value, err := db.Get([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), value)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestOpen_BPlusTreeIndex(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-bptree")
+
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+	options.IndexType = index.BPlusTreeIndex
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 3000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put([]byte("Hello"), []byte("world")))
+	assert.NoError(t, wb.Commit())
+	assert.NoError(t, db.Merge())
+	assert.NoError(t, db.Put([]byte("after-merge"), []byte("value")))
+
+	assert.NoError(t, db.Close())
+	_, err = os.Stat(filepath.Join(dir, index.BPlusTreeIndexFileName))
+	assert.NoError(t, err)
+
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2002, len(db.ListKeys()))
+	value, err := db.Get([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), value)
+	value, err = db.Get([]byte("after-merge"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// The sequence number survives restarts without replaying older files
+	wb = db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put([]byte("Hello"), []byte("again")))
+	assert.NoError(t, wb.Commit())
+	assert.Equal(t, uint64(2), db.seqNo)
+
+	// Removing the index file rebuilds it from the data files
+	assert.NoError(t, db.Close())
+	assert.NoError(t, os.Remove(filepath.Join(dir, index.BPlusTreeIndexFileName)))
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2002, len(db.ListKeys()))
+	value, err = db.Get([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("again"), value)
+}
+
+func TestOpen_BPlusTreeIndexFailedKeepsSeqNo(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-bptree")
+	defer os.RemoveAll(dir)
+
+	options := DefaultOptions
+	options.DirPath = dir
+	options.IndexType = index.BPlusTreeIndex
+
+	db, err := Open(options)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("Hello"), []byte("world")))
+	assert.NoError(t, db.Close())
+
+	// A failed open must not overwrite the saved sequence number
+	seqNoFile := filepath.Join(dir, seqNoFileName)
+	assert.NoError(t, os.WriteFile(seqNoFile, []byte("7 1 2"), 0644))
+	_, err = Open(options)
+	assert.Equal(t, ErrDataDirCorrupt, err)
+	content, err := os.ReadFile(seqNoFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "7 1 2", string(content))
+}
+
+func TestOpen_TruncateCorruptedTail(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-torn-tail")
+
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	validSize := db.activeFile.WriteOff
+	assert.NoError(t, db.Close())
+
+	// Simulate a crash in the middle of writing a record
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: []byte("torn"), Value: utils.RandomValue(64)})
+	appendToFile(t, data.GetDataFileName(dir, 0), encRecord[:len(encRecord)/2])
+
+	// Refuse to open when truncation is disabled
+	options.TruncateCorruptedTail = false
+	_, err = Open(options)
+	assert.Equal(t, ErrActiveFileCorrupted, err)
+
+	options.TruncateCorruptedTail = true
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(encRecord)/2), db.TruncatedTailSize())
+	assert.Equal(t, 100, len(db.ListKeys()))
+	_, err = db.Get([]byte("torn"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// New writes continue right after the last valid record
+	assert.NoError(t, db.Put([]byte("Hello"), []byte("world")))
+	assert.NoError(t, db.Close())
+	stat, err := os.Stat(data.GetDataFileName(dir, 0))
+	assert.NoError(t, err)
+	assert.Greater(t, stat.Size(), validSize)
+
+	// A record with a corrupted checksum is discarded as well
+	encRecord, _ = data.EncodeLogRecord(&data.LogRecord{Key: []byte("bad-crc"), Value: []byte("value")})
+	encRecord[0] ^= 0xff
+	appendToFile(t, data.GetDataFileName(dir, 0), encRecord)
+
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(encRecord)), db.TruncatedTailSize())
+	assert.Equal(t, 101, len(db.ListKeys()))
+	value, err := db.Get([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), value)
+}
+
+func TestOpen_CorruptedMiddleRecord(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-corrupted-middle")
+	defer os.RemoveAll(dir)
+
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(10)))
+	}
+	pos := db.index.Get(utils.GetTestKey(50))
+	assert.NoError(t, db.Close())
+
+	// Flip a byte inside a record that is followed by valid records
+	fileName := data.GetDataFileName(dir, 0)
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	content[pos.Offset+int64(pos.Size)-1] ^= 0xff
+	assert.NoError(t, os.WriteFile(fileName, content, 0644))
+
+	// The file is left untouched even when truncation is enabled
+	options.TruncateCorruptedTail = true
+	_, err = Open(options)
+	assert.Equal(t, ErrActiveFileCorrupted, err)
+	after, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, content, after)
+}
+
+func appendToFile(t *testing.T, fileName string, b []byte) {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = file.Write(b)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+}
+
+func TestDB_Stat(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-stat")
+
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	stat, err := db.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(0), stat.KeyNum)
+	assert.Equal(t, uint(0), stat.DataFileNum)
+	assert.Equal(t, int64(0), stat.ReclaimableSize)
+
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	stat, err = db.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2000), stat.KeyNum)
+	assert.Greater(t, stat.DataFileNum, uint(1))
+	assert.Equal(t, int64(0), stat.ReclaimableSize)
+	assert.Greater(t, stat.DiskSize, int64(0))
+
+	// Overwrites and deletes make the old records reclaimable
+	for i := 0; i < 500; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	for i := 500; i < 1000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+	stat, err = db.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1500), stat.KeyNum)
+	reclaimableSize := stat.ReclaimableSize
+	assert.Greater(t, reclaimableSize, int64(0))
+
+	// The estimate is rebuilt when the index is loaded from the data files
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	stat, err = db.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, reclaimableSize, stat.ReclaimableSize)
+
+	// Merge cleans up the reclaimable data
+	assert.NoError(t, db.Merge())
+	stat, err = db.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1500), stat.KeyNum)
+	assert.Equal(t, int64(0), stat.ReclaimableSize)
+}
+
+func TestOpen_Compression(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-compression")
+	options := DefaultOptions
+	options.DirPath = dir
+
+	// Data written without compression stays readable after enabling it
+	db, err := Open(options)
+	assert.NoError(t, err)
+	value := bytes.Repeat([]byte(`{"id":1,"name":"skv"}`), 100)
+	assert.NoError(t, db.Put([]byte("plain"), value))
+	assert.NoError(t, db.Close())
+
+	options.Compression = data.DeflateCompression
+	db, err = Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("compressed"), value))
+	assert.Less(t, db.index.Get([]byte("compressed")).Size, uint32(len(value)))
+	for _, key := range []string{"plain", "compressed"} {
+		v, err := db.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+
+	// Merge rewrites old records with the configured compression
+	assert.NoError(t, db.Merge())
+	assert.Less(t, db.index.Get([]byte("plain")).Size, uint32(len(value)))
+	v, err := db.Get([]byte("plain"))
+	assert.NoError(t, err)
+	assert.Equal(t, value, v)
+
+	options.Compression = 100
+	_, err = Open(options)
+	assert.Error(t, err)
+}
+
+func TestOpen_Encryption(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-encryption")
+	defer os.RemoveAll(dir)
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+	oldKey := bytes.Repeat([]byte("a"), 32)
+	newKey := bytes.Repeat([]byte("b"), 32)
+	options.EncryptionKey = oldKey
+
+	db, err := Open(options)
+	assert.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.GetTestKey(i)))
+	}
+	assert.NoError(t, db.Close())
+
+	// Keys and values never reach the disk in plain text
+	content, err := os.ReadFile(data.GetDataFileName(dir, 0))
+	assert.NoError(t, err)
+	assert.False(t, bytes.Contains(content, utils.GetTestKey(1)))
+
+	// Opening with no key or the wrong key fails clearly
+	plainOptions := options
+	plainOptions.EncryptionKey = nil
+	_, err = Open(plainOptions)
+	assert.Equal(t, data.ErrEncryptionKeyRequired, err)
+	wrongOptions := options
+	wrongOptions.EncryptionKey = newKey
+	_, err = Open(wrongOptions)
+	assert.Equal(t, data.ErrEncryptionKeyMismatch, err)
+
+	// Rotate the key, merge re-encrypts everything with the new one
+	rotateOptions := options
+	rotateOptions.EncryptionKey = newKey
+	rotateOptions.PreviousEncryptionKeys = [][]byte{oldKey}
+	db, err = Open(rotateOptions)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Merge())
+	assert.NoError(t, db.Close())
+
+	db, err = Open(wrongOptions)
+	assert.NoError(t, err)
+	defer destroyDB(db)
+	for i := 0; i < 1000; i++ {
+		value, err := db.Get(utils.GetTestKey(i))
+		assert.NoError(t, err)
+		assert.Equal(t, utils.GetTestKey(i), value)
+	}
+
+	plainOptions.PreviousEncryptionKeys = [][]byte{oldKey}
+	_, err = Open(plainOptions)
+	assert.Error(t, err)
+
+	// The B+tree index would store the keys in plain text
+	bptreeOptions := wrongOptions
+	bptreeOptions.IndexType = index.BPlusTreeIndex
+	_, err = Open(bptreeOptions)
+	assert.Error(t, err)
+}
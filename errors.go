@@ -3,10 +3,29 @@ package skv_go
 import "errors"
 
 var (
-	ErrKeyIsEmpty       = errors.New("key is empty")
-	ErrIndexUpdate      = errors.New("index update error")
-	ErrKeyNotFound      = errors.New("key not found")
-	ErrDataFileNotFound = errors.New("data file error")
-	ErrDataDeleted      = errors.New("data deleted")
-	ErrDataDirCorrupt   = errors.New("data dir corrupt")
+	ErrKeyIsEmpty          = errors.New("key is empty")
+	ErrIndexUpdate         = errors.New("index update error")
+	ErrKeyNotFound         = errors.New("key not found")
+	ErrDataFileNotFound    = errors.New("data file error")
+	ErrDataDeleted         = errors.New("data deleted")
+	ErrDataDirCorrupt      = errors.New("data dir corrupt")
+	ErrMergeIsProgress     = errors.New("merge is in progress, try again later")
+	ErrMergeTooLarge       = errors.New("the merged data needs more files than it replaces, merge is aborted")
+	ErrExceedMaxBatchNum   = errors.New("exceed the max batch num")
+	ErrDatabaseIsUsing     = errors.New("the database directory is used by another process")
+	ErrTTLIsInvalid        = errors.New("ttl must be positive")
+	ErrActiveFileCorrupted = errors.New("the active data file is corrupted")
+	ErrBackupDirIsDataDir  = errors.New("the backup directory can not be the data directory")
+	ErrBackupDirNotEmpty   = errors.New("the backup directory is not empty")
+	ErrSnapshotReleased    = errors.New("the snapshot has been released")
+	ErrTxnConflict         = errors.New("transaction conflict, the keys it read have been changed")
+	ErrTxnFinished         = errors.New("the transaction has been committed or rolled back")
+	ErrWatcherOverflow     = errors.New("the watcher buffer is full, resume from the last received position")
+	ErrInvalidWatchPos     = errors.New("the watch position does not point to a record in the data files")
+	ErrWatchBufferSize     = errors.New("watch buffer size must be positive")
+	ErrReadOnlyReplica     = errors.New("the database is a read only replica")
+	ErrPrimaryAddrIsEmpty  = errors.New("the address of the primary is empty")
+	ErrReplicationProtocol = errors.New("replication protocol error")
+	ErrLegacyDataFile      = errors.New("data files without a header can not be replicated, upgrade them first")
+	ErrReplicationClosed   = errors.New("replication server closed")
 )
@@ -19,6 +19,15 @@ func NewFileIOManager(fileName string) (*FileIO, error) {
 	return &FileIO{fd: file}, nil
 }
 
+// NewReadOnlyFileIOManager 以只读方式打开已有的文件，不会创建或修改文件
+func NewReadOnlyFileIOManager(fileName string) (*FileIO, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &FileIO{fd: file}, nil
+}
+
 func (fio *FileIO) Read(bytes []byte, offset int64) (int, error) {
 	return fio.fd.ReadAt(bytes, offset)
 }
@@ -42,3 +51,7 @@ func (fio *FileIO) Size() (int64, error) {
 	}
 	return stat.Size(), nil
 }
+
+func (fio *FileIO) Truncate(size int64) error {
+	return fio.fd.Truncate(size)
+}
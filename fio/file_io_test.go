@@ -99,3 +99,24 @@ func TestFileIO_Integration(t *testing.T) {
 	err = fileIO.Close()
 	assert.NoError(t, err)
 }
+
+func TestTryLockFile(t *testing.T) {
+	tempFile, _ := os.CreateTemp("", "test")
+	defer os.Remove(tempFile.Name())
+
+	fileLock, ok, err := fio.TryLockFile(tempFile.Name())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// The lock is already held
+	_, ok, err = fio.TryLockFile(tempFile.Name())
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// The lock can be acquired again after unlocking
+	assert.NoError(t, fileLock.Unlock())
+	fileLock, ok, err = fio.TryLockFile(tempFile.Name())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, fileLock.Unlock())
+}
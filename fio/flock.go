@@ -0,0 +1,38 @@
+package fio
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// FileLock 基于flock的文件锁，用于保证一个目录同一时刻只能被一个实例使用
+type FileLock struct {
+	//文件描述符
+	fd *os.File
+}
+
+// TryLockFile 尝试对文件加排他锁，锁已经被占用时返回false
+func TryLockFile(fileName string) (*FileLock, bool, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		_ = file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &FileLock{fd: file}, true, nil
+}
+
+// Unlock 释放文件锁
+func (fl *FileLock) Unlock() error {
+	if err := syscall.Flock(int(fl.fd.Fd()), syscall.LOCK_UN); err != nil {
+		_ = fl.fd.Close()
+		return err
+	}
+	return fl.fd.Close()
+}
@@ -2,6 +2,17 @@ package fio
 
 const DataFilePerm = 0644
 
+// FileIOType 文件IO类型
+type FileIOType = byte
+
+const (
+	// StandardFIO 标准文件IO
+	StandardFIO FileIOType = iota
+
+	// MemoryMap 内存文件映射
+	MemoryMap
+)
+
 type IOManager interface {
 	// Read 从文件的给定位置读取数据
 	Read([]byte, int64) (int, error)
@@ -13,9 +24,18 @@ type IOManager interface {
 	Close() error
 	// Size 文件大小
 	Size() (int64, error)
+	// Truncate 将文件截断到指定大小
+	Truncate(int64) error
 }
 
 // NewIOManager  文件IO管理器
-func NewIOManager(fileName string) (IOManager, error) {
-	return NewFileIOManager(fileName)
+func NewIOManager(fileName string, ioType FileIOType) (IOManager, error) {
+	switch ioType {
+	case StandardFIO:
+		return NewFileIOManager(fileName)
+	case MemoryMap:
+		return NewMMapIOManager(fileName)
+	default:
+		panic("unsupported io type")
+	}
 }
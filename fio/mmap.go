@@ -0,0 +1,82 @@
+package fio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+var ErrMMapWriteNotSupported = errors.New("mmap io manager does not support write")
+
+// MMap 内存文件映射IO，只用于读取数据
+type MMap struct {
+	//文件描述符
+	fd *os.File
+	//映射到内存中的文件内容
+	data []byte
+}
+
+// NewMMapIOManager 创建内存文件映射IO
+func NewMMapIOManager(fileName string) (*MMap, error) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_RDWR, DataFilePerm)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	mmap := &MMap{fd: file}
+	//空文件无法映射，直接当作空数据处理
+	if stat.Size() > 0 {
+		mmap.data, err = syscall.Mmap(int(file.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+	return mmap, nil
+}
+
+func (mmap *MMap) Read(bytes []byte, offset int64) (int, error) {
+	if offset >= int64(len(mmap.data)) {
+		if len(bytes) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := copy(bytes, mmap.data[offset:])
+	if n < len(bytes) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (mmap *MMap) Write([]byte) (int, error) {
+	return 0, ErrMMapWriteNotSupported
+}
+
+func (mmap *MMap) Truncate(int64) error {
+	return ErrMMapWriteNotSupported
+}
+
+func (mmap *MMap) Sync() error {
+	return nil
+}
+
+func (mmap *MMap) Close() error {
+	if mmap.data != nil {
+		if err := syscall.Munmap(mmap.data); err != nil {
+			_ = mmap.fd.Close()
+			return err
+		}
+		mmap.data = nil
+	}
+	return mmap.fd.Close()
+}
+
+func (mmap *MMap) Size() (int64, error) {
+	return int64(len(mmap.data)), nil
+}
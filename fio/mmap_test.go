@@ -0,0 +1,63 @@
+package fio_test
+
+import (
+	"io"
+	"os"
+	"skv-go/fio"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewMMapIOManager(t *testing.T) {
+	tempFile, _ := os.CreateTemp("", "test")
+	defer os.Remove(tempFile.Name())
+
+	// An empty file can be mapped as well
+	mmap, err := fio.NewMMapIOManager(tempFile.Name())
+	assert.NoError(t, err)
+	assert.NotNil(t, mmap)
+	size, err := mmap.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), size)
+	_, err = mmap.Read(make([]byte, 1), 0)
+	assert.Equal(t, io.EOF, err)
+	assert.NoError(t, mmap.Close())
+}
+
+func TestMMap_Read(t *testing.T) {
+	tempFile, _ := os.CreateTemp("", "test")
+	defer os.Remove(tempFile.Name())
+	tempFile.WriteString("Hello, World!")
+
+	mmap, err := fio.NewMMapIOManager(tempFile.Name())
+	assert.NoError(t, err)
+	defer mmap.Close()
+
+	size, err := mmap.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(13), size)
+
+	bytes := make([]byte, 5)
+	n, err := mmap.Read(bytes, 7)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "World", string(bytes))
+
+	// Read past the end of the file
+	n, err = mmap.Read(bytes, 10)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestMMap_Write(t *testing.T) {
+	tempFile, _ := os.CreateTemp("", "test")
+	defer os.Remove(tempFile.Name())
+
+	mmap, err := fio.NewIOManager(tempFile.Name(), fio.MemoryMap)
+	assert.NoError(t, err)
+	defer mmap.Close()
+
+	_, err = mmap.Write([]byte("Hello"))
+	assert.Equal(t, fio.ErrMMapWriteNotSupported, err)
+}
@@ -0,0 +1,163 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	skv "skv-go"
+	"strconv"
+)
+
+// 单个value允许的最大大小
+const maxValueSize = 64 * 1024 * 1024
+
+// Server 使用HTTP/JSON对外提供DB的读写服务
+type Server struct {
+	db  *skv.DB
+	mux *http.ServeMux
+}
+
+// kvItem 遍历接口返回的数据，key和value在JSON中使用base64编码，保证二进制安全
+type kvItem struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// statResponse 统计信息接口返回的数据
+type statResponse struct {
+	KeyNum          uint  `json:"key_num"`
+	DataFileNum     uint  `json:"data_file_num"`
+	ReclaimableSize int64 `json:"reclaimable_size"`
+	DiskSize        int64 `json:"disk_size"`
+}
+
+// NewServer 创建HTTP服务，返回的Server实现了http.Handler
+func NewServer(db *skv.DB) *Server {
+	s := &Server{db: db, mux: http.NewServeMux()}
+	s.mux.HandleFunc("PUT /kv/{key...}", s.handlePut)
+	s.mux.HandleFunc("GET /kv/{key...}", s.handleGet)
+	s.mux.HandleFunc("DELETE /kv/{key...}", s.handleDelete)
+	s.mux.HandleFunc("GET /kv", s.handleList)
+	s.mux.HandleFunc("GET /stat", s.handleStat)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handlePut 请求体为原始的value
+func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
+	value, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValueSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.db.Put([]byte(r.PathValue("key")), value); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGet 响应体为原始的value
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
+	value, err := s.db.Get([]byte(r.PathValue("key")))
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	_, _ = w.Write(value)
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.Delete([]byte(r.PathValue("key"))); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleList 按照prefix和reverse参数遍历数据，start和end限制key的范围[start, end)，limit限制返回的数量
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	options := skv.DefaultIteratorOptions
+	options.Prefix = []byte(query.Get("prefix"))
+	if query.Has("start") {
+		options.LowerBound = []byte(query.Get("start"))
+	}
+	if query.Has("end") {
+		options.UpperBound = []byte(query.Get("end"))
+	}
+	if reverse := query.Get("reverse"); reverse != "" {
+		var err error
+		if options.Reverse, err = strconv.ParseBool(reverse); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid reverse parameter"))
+			return
+		}
+	}
+	limit := -1
+	if limitParam := query.Get("limit"); limitParam != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitParam); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid limit parameter"))
+			return
+		}
+	}
+
+	iter := s.db.NewIterator(options)
+	defer iter.Close()
+	items := make([]kvItem, 0)
+	for iter.Rewind(); iter.Valid() && limit != 0; iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		items = append(items, kvItem{Key: iter.Key(), Value: value})
+		limit--
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (s *Server) handleStat(w http.ResponseWriter, _ *http.Request) {
+	stat, err := s.db.Stat()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, &statResponse{
+		KeyNum:          stat.KeyNum,
+		DataFileNum:     stat.DataFileNum,
+		ReclaimableSize: stat.ReclaimableSize,
+		DiskSize:        stat.DiskSize,
+	})
+}
+
+// writeDBError 根据DB返回的错误设置对应的状态码
+func writeDBError(w http.ResponseWriter, err error) {
+	switch err {
+	case skv.ErrKeyNotFound:
+		writeError(w, http.StatusNotFound, err)
+	case skv.ErrKeyIsEmpty:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("httpserver: failed to write response: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	skv "skv-go"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, func()) {
+	dir, _ := os.MkdirTemp("", "test-http")
+	options := skv.DefaultOptions
+	options.DirPath = dir
+	db, err := skv.Open(options)
+	assert.NoError(t, err)
+	server := httptest.NewServer(NewServer(db))
+	return server, func() {
+		server.Close()
+		assert.NoError(t, db.Close())
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func doRequest(t *testing.T, method, url string, body []byte) (int, []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, respBody
+}
+
+func TestServer_KV(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	status, body := doRequest(t, http.MethodGet, server.URL+"/kv/key", nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.JSONEq(t, `{"error":"key not found"}`, string(body))
+
+	// Values are binary safe and keys may contain escaped characters
+	value := []byte{0, 1, 2, 255, '\n'}
+	key := "/kv/" + url.PathEscape("a/b c")
+	status, _ = doRequest(t, http.MethodPut, server.URL+key, value)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, body = doRequest(t, http.MethodGet, server.URL+key, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, value, body)
+
+	status, _ = doRequest(t, http.MethodPut, server.URL+"/kv/", value)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = doRequest(t, http.MethodDelete, server.URL+key, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = doRequest(t, http.MethodGet, server.URL+key, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestServer_List(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	for _, key := range []string{"user:1", "user:2", "user:3", "order:1"} {
+		status, _ := doRequest(t, http.MethodPut, server.URL+"/kv/"+key, []byte("value-"+key))
+		assert.Equal(t, http.StatusNoContent, status)
+	}
+
+	var items []kvItem
+	status, body := doRequest(t, http.MethodGet, server.URL+"/kv?prefix=user:&reverse=true&limit=2", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(body, &items))
+	assert.Equal(t, []kvItem{
+		{Key: []byte("user:3"), Value: []byte("value-user:3")},
+		{Key: []byte("user:2"), Value: []byte("value-user:2")},
+	}, items)
+
+	items = nil
+	status, body = doRequest(t, http.MethodGet, server.URL+"/kv?start=order:1&end=user:2", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(body, &items))
+	assert.Equal(t, 2, len(items))
+	assert.Equal(t, []byte("order:1"), items[0].Key)
+	assert.Equal(t, []byte("user:1"), items[1].Key)
+
+	status, body = doRequest(t, http.MethodGet, server.URL+"/kv?prefix=none", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "[]\n", string(body))
+
+	status, _ = doRequest(t, http.MethodGet, server.URL+"/kv?reverse=maybe", nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestServer_Stat(t *testing.T) {
+	server, cleanup := newTestServer(t)
+	defer cleanup()
+
+	doRequest(t, http.MethodPut, server.URL+"/kv/key", []byte("value"))
+	doRequest(t, http.MethodPut, server.URL+"/kv/key", []byte("value"))
+
+	var stat statResponse
+	status, body := doRequest(t, http.MethodGet, server.URL+"/stat", nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NoError(t, json.Unmarshal(body, &stat))
+	assert.Equal(t, uint(1), stat.KeyNum)
+	assert.Equal(t, uint(1), stat.DataFileNum)
+	assert.Greater(t, stat.ReclaimableSize, int64(0))
+}
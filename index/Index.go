@@ -18,6 +18,21 @@ type Indexer interface {
 	Size() int
 	// Iterator 获取迭代器
 	Iterator(reverse bool) Iterator
+	// Close 关闭索引
+	Close() error
+}
+
+// PersistentIndexer 保存在磁盘上的索引，打开数据库时不需要从数据文件中重建
+type PersistentIndexer interface {
+	Indexer
+	// Sync 持久化索引
+	Sync() error
+}
+
+// Cloner 支持快速复制的索引，复制出来的索引和原索引互不影响
+type Cloner interface {
+	// Clone 复制一份索引
+	Clone() Indexer
 }
 
 type IndexType = int8
@@ -25,20 +40,25 @@ type IndexType = int8
 const (
 	BTreeIndex IndexType = iota
 
+	// ART 自适应基数树索引
 	ART
+
+	// BPlusTreeIndex B+树索引，将索引保存在磁盘上
+	BPlusTreeIndex
 )
 
-func NewIndexer(typ IndexType) Indexer {
+// NewIndexer 根据类型创建索引，dirPath和sync仅用于保存在磁盘上的索引
+func NewIndexer(typ IndexType, dirPath string, sync bool) (Indexer, error) {
 	switch typ {
 	case BTreeIndex:
-		return NewBTree()
+		return NewBTree(), nil
 	case ART:
-		return nil
+		return NewART(), nil
+	case BPlusTreeIndex:
+		return NewBPlusTree(dirPath, sync)
 	default:
 		panic("unknown index type")
 	}
-	return nil
-
 }
 
 type Item struct {
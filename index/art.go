@@ -0,0 +1,730 @@
+package index
+
+import (
+	"bytes"
+	"skv-go/data"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// AdaptiveRadixTree 自适应基数树索引
+// 参考论文 The Adaptive Radix Tree: ARTful Indexing for Main-Memory Databases
+// 节点采用写时复制，复制索引或者创建迭代器时只需要共享根节点，之后的修改会先复制路径上不属于当前版本的节点
+type AdaptiveRadixTree struct {
+	root *artNode
+	size int
+	lock *sync.RWMutex
+	//当前的版本号，只有版本号相同的节点可以直接修改
+	version uint64
+}
+
+// artVersion 用于分配全局唯一的版本号
+var artVersion atomic.Uint64
+
+// NewART 创建自适应基数树索引
+func NewART() *AdaptiveRadixTree {
+	return &AdaptiveRadixTree{lock: new(sync.RWMutex), version: artVersion.Add(1)}
+}
+
+func (art *AdaptiveRadixTree) Put(key []byte, pos *data.LogRecordPos) bool {
+	art.lock.Lock()
+	if art.insert(&art.root, key, 0, pos) {
+		art.size++
+	}
+	art.lock.Unlock()
+	return true
+}
+
+func (art *AdaptiveRadixTree) Get(key []byte) *data.LogRecordPos {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	leaf := art.search(key)
+	if leaf == nil {
+		return nil
+	}
+	return leaf.pos
+}
+
+func (art *AdaptiveRadixTree) Delete(key []byte) bool {
+	art.lock.Lock()
+	deleted := art.delete(&art.root, key, 0)
+	if deleted {
+		art.size--
+	}
+	art.lock.Unlock()
+	return deleted
+}
+
+func (art *AdaptiveRadixTree) Size() int {
+	art.lock.RLock()
+	defer art.lock.RUnlock()
+	return art.size
+}
+
+func (art *AdaptiveRadixTree) Iterator(reverse bool) Iterator {
+	//共享根节点需要更新版本号，因此需要加写锁
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	art.version = artVersion.Add(1)
+	return newARTIterator(art.root, reverse)
+}
+
+// Clone 复制一份索引，两份索引共享所有的节点，之后各自修改时才会复制对应的节点
+func (art *AdaptiveRadixTree) Clone() Indexer {
+	art.lock.Lock()
+	defer art.lock.Unlock()
+	art.version = artVersion.Add(1)
+	return &AdaptiveRadixTree{
+		root:    art.root,
+		size:    art.size,
+		lock:    new(sync.RWMutex),
+		version: artVersion.Add(1),
+	}
+}
+
+func (art *AdaptiveRadixTree) Close() error {
+	return nil
+}
+
+// artNodeKind 节点类型，内部节点根据子节点的数量自适应地选择不同的结构
+type artNodeKind uint8
+
+const (
+	artLeaf artNodeKind = iota
+	artNode4
+	artNode16
+	artNode48
+	artNode256
+)
+
+// 各种内部节点能容纳的最大子节点数量
+const (
+	node4Max   = 4
+	node16Max  = 16
+	node48Max  = 48
+	node256Max = 256
+)
+
+// artNode 基数树节点
+type artNode struct {
+	kind artNodeKind
+	//创建节点的索引版本，和索引的版本不同时说明节点被共享，不能直接修改
+	version uint64
+	//叶子节点保存完整的key和位置信息
+	key []byte
+	pos *data.LogRecordPos
+	//内部节点压缩的公共前缀
+	prefix []byte
+	//恰好在当前节点结束的key对应的叶子节点
+	value *artNode
+	//node4和node16中有序存放的子节点key
+	keys []byte
+	//node48中key到子节点下标的映射，下标从1开始，0表示不存在
+	childIndex *[256]uint8
+	//子节点，node4和node16与keys一一对应，node48通过childIndex定位，node256直接通过key定位
+	children    []*artNode
+	numChildren int
+}
+
+func newARTLeaf(key []byte, pos *data.LogRecordPos, version uint64) *artNode {
+	return &artNode{kind: artLeaf, version: version, key: key, pos: pos}
+}
+
+func newARTNode4(version uint64) *artNode {
+	return &artNode{
+		kind:     artNode4,
+		version:  version,
+		keys:     make([]byte, 0, node4Max),
+		children: make([]*artNode, 0, node4Max),
+	}
+}
+
+// clone 复制节点本身，子节点仍然是共享的
+func (n *artNode) clone(version uint64) *artNode {
+	c := *n
+	c.version = version
+	if n.keys != nil {
+		c.keys = make([]byte, len(n.keys), cap(n.keys))
+		copy(c.keys, n.keys)
+	}
+	if n.children != nil {
+		c.children = make([]*artNode, len(n.children), cap(n.children))
+		copy(c.children, n.children)
+	}
+	if n.childIndex != nil {
+		childIndex := *n.childIndex
+		c.childIndex = &childIndex
+	}
+	return &c
+}
+
+// mutable 获取可以直接修改的节点，节点被共享时复制一份替换原来的位置
+func (art *AdaptiveRadixTree) mutable(ref **artNode) *artNode {
+	if (*ref).version != art.version {
+		*ref = (*ref).clone(art.version)
+	}
+	return *ref
+}
+
+func (n *artNode) isLeaf() bool {
+	return n.kind == artLeaf
+}
+
+// findChild 查找子节点，返回子节点所在的位置，便于替换子节点
+func (n *artNode) findChild(b byte) **artNode {
+	switch n.kind {
+	case artNode4, artNode16:
+		idx := sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= b })
+		if idx < len(n.keys) && n.keys[idx] == b {
+			return &n.children[idx]
+		}
+	case artNode48:
+		if idx := n.childIndex[b]; idx > 0 {
+			return &n.children[idx-1]
+		}
+	case artNode256:
+		if n.children[b] != nil {
+			return &n.children[b]
+		}
+	}
+	return nil
+}
+
+// addChild 添加子节点，节点已满时先扩容
+func (n *artNode) addChild(b byte, child *artNode) {
+	if n.isFull() {
+		n.grow()
+	}
+	switch n.kind {
+	case artNode4, artNode16:
+		idx := sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= b })
+		n.keys = append(n.keys, 0)
+		copy(n.keys[idx+1:], n.keys[idx:])
+		n.keys[idx] = b
+		n.children = append(n.children, nil)
+		copy(n.children[idx+1:], n.children[idx:])
+		n.children[idx] = child
+	case artNode48:
+		//找到一个空闲的位置
+		for i := range n.children {
+			if n.children[i] == nil {
+				n.children[i] = child
+				n.childIndex[b] = uint8(i + 1)
+				break
+			}
+		}
+	case artNode256:
+		n.children[b] = child
+	}
+	n.numChildren++
+}
+
+// addLeaf 将叶子节点放到当前节点下，key恰好在depth处结束时作为当前节点的value
+func (n *artNode) addLeaf(leaf *artNode, depth int) {
+	if depth == len(leaf.key) {
+		n.value = leaf
+		return
+	}
+	n.addChild(leaf.key[depth], leaf)
+}
+
+// removeChild 删除子节点
+func (n *artNode) removeChild(b byte) {
+	switch n.kind {
+	case artNode4, artNode16:
+		idx := sort.Search(len(n.keys), func(i int) bool { return n.keys[i] >= b })
+		n.keys = append(n.keys[:idx], n.keys[idx+1:]...)
+		copy(n.children[idx:], n.children[idx+1:])
+		n.children[len(n.children)-1] = nil
+		n.children = n.children[:len(n.children)-1]
+	case artNode48:
+		idx := n.childIndex[b]
+		n.children[idx-1] = nil
+		n.childIndex[b] = 0
+	case artNode256:
+		n.children[b] = nil
+	}
+	n.numChildren--
+}
+
+func (n *artNode) isFull() bool {
+	switch n.kind {
+	case artNode4:
+		return n.numChildren == node4Max
+	case artNode16:
+		return n.numChildren == node16Max
+	case artNode48:
+		return n.numChildren == node48Max
+	default:
+		return false
+	}
+}
+
+// grow 将节点扩容为能容纳更多子节点的类型
+func (n *artNode) grow() {
+	switch n.kind {
+	case artNode4:
+		keys := make([]byte, len(n.keys), node16Max)
+		children := make([]*artNode, len(n.children), node16Max)
+		copy(keys, n.keys)
+		copy(children, n.children)
+		n.kind, n.keys, n.children = artNode16, keys, children
+	case artNode16:
+		childIndex := new([256]uint8)
+		children := make([]*artNode, node48Max)
+		for i, b := range n.keys {
+			children[i] = n.children[i]
+			childIndex[b] = uint8(i + 1)
+		}
+		n.kind, n.keys, n.childIndex, n.children = artNode48, nil, childIndex, children
+	case artNode48:
+		children := make([]*artNode, node256Max)
+		for b, idx := range n.childIndex {
+			if idx > 0 {
+				children[b] = n.children[idx-1]
+			}
+		}
+		n.kind, n.childIndex, n.children = artNode256, nil, children
+	}
+}
+
+// shrink 子节点数量较少时缩容为更小的节点类型
+func (n *artNode) shrink() {
+	switch n.kind {
+	case artNode16:
+		if n.numChildren > node4Max {
+			return
+		}
+		keys := make([]byte, len(n.keys), node4Max)
+		children := make([]*artNode, len(n.children), node4Max)
+		copy(keys, n.keys)
+		copy(children, n.children)
+		n.kind, n.keys, n.children = artNode4, keys, children
+	case artNode48:
+		if n.numChildren > node16Max {
+			return
+		}
+		keys := make([]byte, 0, node16Max)
+		children := make([]*artNode, 0, node16Max)
+		for b, idx := range n.childIndex {
+			if idx > 0 {
+				keys = append(keys, byte(b))
+				children = append(children, n.children[idx-1])
+			}
+		}
+		n.kind, n.keys, n.childIndex, n.children = artNode16, keys, nil, children
+	case artNode256:
+		if n.numChildren > node48Max {
+			return
+		}
+		childIndex := new([256]uint8)
+		children := make([]*artNode, node48Max)
+		var i int
+		for b, child := range n.children {
+			if child != nil {
+				children[i] = child
+				childIndex[b] = uint8(i + 1)
+				i++
+			}
+		}
+		n.kind, n.childIndex, n.children = artNode48, childIndex, children
+	}
+}
+
+// nextChild 从b开始按照遍历方向查找第一个存在的子节点，返回子节点对应的key，没有找到时返回nil
+func (n *artNode) nextChild(b int, reverse bool) (int, *artNode) {
+	switch n.kind {
+	case artNode4, artNode16:
+		var idx int
+		if reverse {
+			idx = sort.Search(len(n.keys), func(i int) bool { return int(n.keys[i]) > b }) - 1
+		} else {
+			idx = sort.Search(len(n.keys), func(i int) bool { return int(n.keys[i]) >= b })
+		}
+		if idx >= 0 && idx < len(n.keys) {
+			return int(n.keys[idx]), n.children[idx]
+		}
+	case artNode48, artNode256:
+		step := 1
+		if reverse {
+			step = -1
+		}
+		for ; b >= 0 && b < node256Max; b += step {
+			if n.kind == artNode48 {
+				if idx := n.childIndex[b]; idx > 0 {
+					return b, n.children[idx-1]
+				}
+			} else if n.children[b] != nil {
+				return b, n.children[b]
+			}
+		}
+	}
+	return 0, nil
+}
+
+// forEachChild 按照key的顺序遍历子节点
+func (n *artNode) forEachChild(reverse bool, fn func(b byte, child *artNode)) {
+	switch n.kind {
+	case artNode4, artNode16:
+		for i := range n.keys {
+			if reverse {
+				i = len(n.keys) - 1 - i
+			}
+			fn(n.keys[i], n.children[i])
+		}
+	case artNode48:
+		for b := range n.childIndex {
+			if reverse {
+				b = len(n.childIndex) - 1 - b
+			}
+			if idx := n.childIndex[b]; idx > 0 {
+				fn(byte(b), n.children[idx-1])
+			}
+		}
+	case artNode256:
+		for b := range n.children {
+			if reverse {
+				b = len(n.children) - 1 - b
+			}
+			if n.children[b] != nil {
+				fn(byte(b), n.children[b])
+			}
+		}
+	}
+}
+
+// insert 插入key，返回是否新增了key
+func (art *AdaptiveRadixTree) insert(ref **artNode, key []byte, depth int, pos *data.LogRecordPos) bool {
+	node := *ref
+	if node == nil {
+		*ref = newARTLeaf(key, pos, art.version)
+		return true
+	}
+
+	//叶子节点，key相同则直接替换，否则分裂出一个新的内部节点
+	if node.isLeaf() {
+		if bytes.Equal(node.key, key) {
+			art.mutable(ref).pos = pos
+			return false
+		}
+		newNode := newARTNode4(art.version)
+		commonLen := longestCommonPrefix(node.key[depth:], key[depth:])
+		newNode.prefix = key[depth : depth+commonLen]
+		depth += commonLen
+		newNode.addLeaf(node, depth)
+		newNode.addLeaf(newARTLeaf(key, pos, art.version), depth)
+		*ref = newNode
+		return true
+	}
+
+	//前缀不匹配，在不匹配的位置分裂出一个新的内部节点
+	node = art.mutable(ref)
+	if len(node.prefix) > 0 {
+		mismatch := longestCommonPrefix(node.prefix, key[depth:])
+		if mismatch < len(node.prefix) {
+			newNode := newARTNode4(art.version)
+			newNode.prefix = node.prefix[:mismatch]
+			newNode.addChild(node.prefix[mismatch], node)
+			node.prefix = node.prefix[mismatch+1:]
+			newNode.addLeaf(newARTLeaf(key, pos, art.version), depth+mismatch)
+			*ref = newNode
+			return true
+		}
+		depth += len(node.prefix)
+	}
+
+	//key在当前节点结束
+	if depth == len(key) {
+		if node.value != nil {
+			art.mutable(&node.value).pos = pos
+			return false
+		}
+		node.value = newARTLeaf(key, pos, art.version)
+		return true
+	}
+
+	if child := node.findChild(key[depth]); child != nil {
+		return art.insert(child, key, depth+1, pos)
+	}
+	node.addChild(key[depth], newARTLeaf(key, pos, art.version))
+	return true
+}
+
+// search 查找key对应的叶子节点
+func (art *AdaptiveRadixTree) search(key []byte) *artNode {
+	node := art.root
+	depth := 0
+	for node != nil {
+		if node.isLeaf() {
+			if bytes.Equal(node.key, key) {
+				return node
+			}
+			return nil
+		}
+		if !bytes.HasPrefix(key[depth:], node.prefix) {
+			return nil
+		}
+		depth += len(node.prefix)
+		if depth == len(key) {
+			return node.value
+		}
+		child := node.findChild(key[depth])
+		if child == nil {
+			return nil
+		}
+		node = *child
+		depth++
+	}
+	return nil
+}
+
+// delete 删除key，返回key是否存在
+func (art *AdaptiveRadixTree) delete(ref **artNode, key []byte, depth int) bool {
+	node := *ref
+	if node == nil {
+		return false
+	}
+	if node.isLeaf() {
+		if bytes.Equal(node.key, key) {
+			*ref = nil
+			return true
+		}
+		return false
+	}
+	if !bytes.HasPrefix(key[depth:], node.prefix) {
+		return false
+	}
+	depth += len(node.prefix)
+
+	if depth == len(key) {
+		if node.value == nil {
+			return false
+		}
+		art.mutable(ref).value = nil
+		art.compact(ref)
+		return true
+	}
+
+	child := node.findChild(key[depth])
+	if child == nil {
+		return false
+	}
+	if (*child).isLeaf() {
+		if !bytes.Equal((*child).key, key) {
+			return false
+		}
+		art.mutable(ref).removeChild(key[depth])
+		art.compact(ref)
+		return true
+	}
+	//复制节点之后需要重新查找子节点的位置
+	return art.delete(art.mutable(ref).findChild(key[depth]), key, depth+1)
+}
+
+// compact 删除后整理节点，合并只有一个子节点的路径并缩容
+func (art *AdaptiveRadixTree) compact(ref **artNode) {
+	node := *ref
+	switch {
+	case node.numChildren == 0:
+		//没有子节点时，直接用value替换当前节点
+		*ref = node.value
+	case node.numChildren == 1 && node.value == nil:
+		//只有一个子节点时，将当前节点的前缀合并到子节点中
+		var b byte
+		var child *artNode
+		node.forEachChild(false, func(k byte, c *artNode) { b, child = k, c })
+		if !child.isLeaf() {
+			if child.version != art.version {
+				child = child.clone(art.version)
+			}
+			prefix := make([]byte, 0, len(node.prefix)+1+len(child.prefix))
+			prefix = append(prefix, node.prefix...)
+			prefix = append(prefix, b)
+			child.prefix = append(prefix, child.prefix...)
+		}
+		*ref = child
+	default:
+		node.shrink()
+	}
+}
+
+// longestCommonPrefix 计算两个字节切片公共前缀的长度
+func longestCommonPrefix(a, b []byte) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
+// artIterator 自适应基数树索引迭代器，在创建时共享的根节点上用节点栈按需查找下一个叶子节点，
+// 创建时不需要复制所有的数据，之后对索引的修改对迭代器不可见
+type artIterator struct {
+	root    *artNode   //创建迭代器时的根节点
+	reverse bool       //是否反向遍历
+	stack   []artFrame //从根节点到当前位置路径上的内部节点
+	curr    *artNode   //当前的叶子节点，为nil表示遍历结束
+}
+
+// artFrame 路径上的内部节点以及下一个要访问的位置，-1表示在当前节点结束的key，0到255表示对应的子节点
+type artFrame struct {
+	node *artNode
+	next int
+}
+
+func newARTIterator(root *artNode, reverse bool) *artIterator {
+	ai := &artIterator{
+		root:    root,
+		reverse: reverse,
+	}
+	ai.Rewind()
+	return ai
+}
+
+func (ai *artIterator) Rewind() {
+	ai.stack = ai.stack[:0]
+	ai.curr = nil
+	if ai.root == nil {
+		return
+	}
+	if ai.root.isLeaf() {
+		ai.curr = ai.root
+		return
+	}
+	ai.push(ai.root)
+	ai.advance()
+}
+
+func (ai *artIterator) Seek(key []byte) {
+	ai.stack = ai.stack[:0]
+	ai.curr = nil
+	node, depth := ai.root, 0
+	for node != nil {
+		if node.isLeaf() {
+			cmp := bytes.Compare(node.key, key)
+			if cmp == 0 || (cmp > 0) != ai.reverse {
+				ai.curr = node
+				return
+			}
+			break
+		}
+		//比较节点的前缀和key中对应的部分，key在前缀中间结束时节点中所有的key都比它大
+		end := min(len(key), depth+len(node.prefix))
+		cmp := bytes.Compare(node.prefix, key[depth:end])
+		if cmp == 0 && end < depth+len(node.prefix) {
+			cmp = 1
+		}
+		if cmp != 0 {
+			//整个节点都在遍历方向上key的后面时从头遍历这个节点，否则跳过整个节点
+			if (cmp > 0) != ai.reverse {
+				ai.push(node)
+			}
+			break
+		}
+		depth += len(node.prefix)
+		//key在当前节点结束，正向遍历时从头遍历这个节点，反向遍历时只剩下在当前节点结束的key
+		if depth == len(key) {
+			ai.stack = append(ai.stack, artFrame{node: node, next: -1})
+			break
+		}
+		//之后从key所在子节点的下一个位置继续遍历
+		b := int(key[depth])
+		next := b + 1
+		if ai.reverse {
+			next = b - 1
+		}
+		ai.stack = append(ai.stack, artFrame{node: node, next: next})
+		child := node.findChild(key[depth])
+		if child == nil {
+			break
+		}
+		node = *child
+		depth++
+	}
+	ai.advance()
+}
+
+func (ai *artIterator) Next() {
+	ai.advance()
+}
+
+func (ai *artIterator) Valid() bool {
+	return ai.curr != nil
+}
+
+func (ai *artIterator) Key() []byte {
+	return ai.curr.key
+}
+
+func (ai *artIterator) Value() *data.LogRecordPos {
+	return ai.curr.pos
+}
+
+func (ai *artIterator) Close() {
+	ai.root = nil
+	ai.stack = nil
+	ai.curr = nil
+}
+
+// push 将内部节点压入栈中，从节点的开头开始遍历
+func (ai *artIterator) push(node *artNode) {
+	next := -1
+	if ai.reverse {
+		next = node256Max - 1
+	}
+	ai.stack = append(ai.stack, artFrame{node: node, next: next})
+}
+
+// advance 移动到下一个叶子节点，栈中的节点都遍历完时结束
+func (ai *artIterator) advance() {
+	ai.curr = nil
+	for len(ai.stack) > 0 {
+		node := ai.stack[len(ai.stack)-1].nextNode(ai.reverse)
+		if node == nil {
+			ai.stack = ai.stack[:len(ai.stack)-1]
+			continue
+		}
+		if node.isLeaf() {
+			ai.curr = node
+			return
+		}
+		ai.push(node)
+	}
+}
+
+// nextNode 按照遍历方向取出下一个要访问的节点，在当前节点结束的key比所有子节点中的key都小
+func (f *artFrame) nextNode(reverse bool) *artNode {
+	if !reverse {
+		if f.next == -1 {
+			f.next = 0
+			if f.node.value != nil {
+				return f.node.value
+			}
+		}
+		b, child := f.node.nextChild(f.next, false)
+		if child == nil {
+			f.next = node256Max
+			return nil
+		}
+		f.next = b + 1
+		return child
+	}
+	if f.next >= 0 {
+		if b, child := f.node.nextChild(f.next, true); child != nil {
+			f.next = b - 1
+			return child
+		}
+		f.next = -1
+	}
+	if f.next == -1 {
+		f.next = -2
+		return f.node.value
+	}
+	return nil
+}
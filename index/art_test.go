@@ -0,0 +1,287 @@
+package index
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"skv-go/data"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestART_Put(t *testing.T) {
+	art := NewART()
+	pos := &data.LogRecordPos{Offset: 1, Fid: 1}
+
+	assert.True(t, art.Put([]byte("key"), pos))
+	assert.True(t, art.Put([]byte("key"), pos))
+	assert.Equal(t, 1, art.Size())
+
+	// Keys that are prefixes of each other
+	assert.True(t, art.Put([]byte("k"), pos))
+	assert.True(t, art.Put([]byte("key1"), pos))
+	assert.Equal(t, 3, art.Size())
+}
+
+func TestART_Get(t *testing.T) {
+	art := NewART()
+	pos1 := &data.LogRecordPos{Offset: 1, Fid: 1}
+	pos2 := &data.LogRecordPos{Offset: 2, Fid: 1}
+	art.Put([]byte("key"), pos1)
+	art.Put([]byte("key-2"), pos2)
+
+	assert.Equal(t, pos1, art.Get([]byte("key")))
+	assert.Equal(t, pos2, art.Get([]byte("key-2")))
+	assert.Nil(t, art.Get([]byte("ke")))
+	assert.Nil(t, art.Get([]byte("key-3")))
+	assert.Nil(t, art.Get([]byte("nonExisting")))
+
+	// Update an existing key
+	art.Put([]byte("key"), pos2)
+	assert.Equal(t, pos2, art.Get([]byte("key")))
+}
+
+func TestART_Delete(t *testing.T) {
+	art := NewART()
+	pos := &data.LogRecordPos{Offset: 1, Fid: 1}
+	art.Put([]byte("key"), pos)
+	art.Put([]byte("key-2"), pos)
+
+	assert.True(t, art.Delete([]byte("key")))
+	assert.False(t, art.Delete([]byte("key")))
+	assert.False(t, art.Delete([]byte("nonExisting")))
+	assert.Nil(t, art.Get([]byte("key")))
+	assert.Equal(t, pos, art.Get([]byte("key-2")))
+	assert.Equal(t, 1, art.Size())
+
+	assert.True(t, art.Delete([]byte("key-2")))
+	assert.Equal(t, 0, art.Size())
+	assert.Nil(t, art.root)
+}
+
+// 使用随机数据与有序的key列表对比，覆盖节点的扩容，缩容以及路径压缩
+func TestART_Random(t *testing.T) {
+	art := NewART()
+	random := rand.New(rand.NewSource(1))
+	expected := make(map[string]*data.LogRecordPos)
+	randomKey := func() []byte {
+		key := make([]byte, random.Intn(4)+1)
+		for i := range key {
+			key[i] = byte(random.Intn(64) * 4)
+		}
+		return key
+	}
+
+	for i := 0; i < 20000; i++ {
+		key := randomKey()
+		if random.Intn(3) == 0 {
+			_, ok := expected[string(key)]
+			assert.Equal(t, ok, art.Delete(key))
+			delete(expected, string(key))
+		} else {
+			pos := &data.LogRecordPos{Fid: uint32(i), Offset: int64(i)}
+			art.Put(key, pos)
+			expected[string(key)] = pos
+		}
+	}
+	assert.Equal(t, len(expected), art.Size())
+	for key, pos := range expected {
+		assert.Equal(t, pos, art.Get([]byte(key)), fmt.Sprintf("key %v", []byte(key)))
+	}
+
+	// Iterate in order
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	iterator := art.Iterator(false)
+	for _, key := range keys {
+		assert.True(t, iterator.Valid())
+		assert.Equal(t, []byte(key), iterator.Key())
+		iterator.Next()
+	}
+	assert.False(t, iterator.Valid())
+
+	// Delete everything
+	for key := range expected {
+		assert.True(t, art.Delete([]byte(key)))
+	}
+	assert.Equal(t, 0, art.Size())
+	assert.Nil(t, art.root)
+}
+
+// 创建一个预填充的ART和对应的迭代器
+func createARTAndIterator(t *testing.T, reverse bool) (*AdaptiveRadixTree, Iterator) {
+	art := NewART()
+	for i := 0; i < 10; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		pos := &data.LogRecordPos{Offset: int64(i), Fid: uint32(i)}
+		assert.True(t, art.Put(key, pos))
+	}
+	return art, art.Iterator(reverse)
+}
+
+func TestARTIterator(t *testing.T) {
+	art, iterator := createARTAndIterator(t, false)
+	for i := 0; i < 10; i++ {
+		assert.True(t, iterator.Valid())
+		assert.Equal(t, []byte(fmt.Sprintf("key-%d", i)), iterator.Key())
+		assert.Equal(t, art.Get(iterator.Key()), iterator.Value())
+		iterator.Next()
+	}
+	assert.False(t, iterator.Valid())
+
+	iterator.Rewind()
+	assert.Equal(t, []byte("key-0"), iterator.Key())
+	iterator.Close()
+	assert.False(t, iterator.Valid())
+}
+
+func TestARTIterator_Seek(t *testing.T) {
+	_, iterator := createARTAndIterator(t, false)
+	iterator.Seek([]byte("key-5"))
+	assert.Equal(t, []byte("key-5"), iterator.Key())
+	iterator.Seek([]byte("key-55"))
+	assert.Equal(t, []byte("key-6"), iterator.Key())
+	iterator.Seek([]byte("z"))
+	assert.False(t, iterator.Valid())
+}
+
+func TestARTIterator_Reverse(t *testing.T) {
+	_, iterator := createARTAndIterator(t, true)
+	for i := 9; i >= 0; i-- {
+		assert.True(t, iterator.Valid())
+		assert.Equal(t, []byte(fmt.Sprintf("key-%d", i)), iterator.Key())
+		iterator.Next()
+	}
+	assert.False(t, iterator.Valid())
+
+	iterator.Seek([]byte("key-55"))
+	assert.Equal(t, []byte("key-5"), iterator.Key())
+	iterator.Seek([]byte("a"))
+	assert.False(t, iterator.Valid())
+}
+
+func TestARTIterator_PrefixKeys(t *testing.T) {
+	art := NewART()
+	keys := [][]byte{[]byte("a"), []byte("ab"), []byte("abc"), []byte("abd"), []byte("b")}
+	for i, key := range keys {
+		art.Put(key, &data.LogRecordPos{Offset: int64(i)})
+	}
+	var got [][]byte
+	for iterator := art.Iterator(false); iterator.Valid(); iterator.Next() {
+		got = append(got, iterator.Key())
+	}
+	assert.Equal(t, keys, got)
+
+	got = nil
+	for iterator := art.Iterator(true); iterator.Valid(); iterator.Next() {
+		got = append(got, iterator.Key())
+	}
+	for i := range got {
+		assert.True(t, bytes.Equal(keys[len(keys)-1-i], got[i]))
+	}
+}
+
+// 测试复制出来的索引和原索引互不影响
+func TestART_Clone(t *testing.T) {
+	art := NewART()
+	pos := &data.LogRecordPos{Offset: 1, Fid: 1}
+	art.Put([]byte("a"), pos)
+	art.Put([]byte("ab"), pos)
+	art.Put([]byte("b"), pos)
+
+	clone := art.Clone()
+	newPos := &data.LogRecordPos{Offset: 2, Fid: 2}
+	art.Put([]byte("c"), pos)
+	art.Put([]byte("ab"), newPos)
+	art.Delete([]byte("a"))
+	clone.Put([]byte("d"), pos)
+
+	assert.Equal(t, 3, art.Size())
+	assert.Nil(t, art.Get([]byte("a")))
+	assert.Nil(t, art.Get([]byte("d")))
+	assert.Equal(t, newPos, art.Get([]byte("ab")))
+	assert.Equal(t, 4, clone.Size())
+	assert.Equal(t, pos, clone.Get([]byte("a")))
+	assert.Equal(t, pos, clone.Get([]byte("ab")))
+	assert.Nil(t, clone.Get([]byte("c")))
+}
+
+// 测试迭代器遍历的是创建时的数据，以及随机位置的Seek
+func TestARTIterator_Lazy(t *testing.T) {
+	art := NewART()
+	random := rand.New(rand.NewSource(1))
+	randomKey := func() []byte {
+		key := make([]byte, random.Intn(4)+1)
+		for i := range key {
+			key[i] = byte(random.Intn(64) * 4)
+		}
+		return key
+	}
+	expected := make(map[string]*data.LogRecordPos)
+	for i := 0; i < 5000; i++ {
+		key := randomKey()
+		pos := &data.LogRecordPos{Fid: uint32(i), Offset: int64(i)}
+		art.Put(key, pos)
+		expected[string(key)] = pos
+	}
+	keys := make([]string, 0, len(expected))
+	for key := range expected {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	iterator := art.Iterator(false)
+	reverseIterator := art.Iterator(true)
+	for i := 0; i < 5000; i++ {
+		key := randomKey()
+		if random.Intn(2) == 0 {
+			art.Delete(key)
+		} else {
+			art.Put(key, &data.LogRecordPos{Fid: uint32(i)})
+		}
+	}
+
+	for _, key := range keys {
+		assert.True(t, iterator.Valid())
+		assert.Equal(t, []byte(key), iterator.Key())
+		assert.Equal(t, expected[key], iterator.Value())
+		iterator.Next()
+	}
+	assert.False(t, iterator.Valid())
+	for i := len(keys) - 1; i >= 0; i-- {
+		assert.True(t, reverseIterator.Valid())
+		assert.Equal(t, []byte(keys[i]), reverseIterator.Key())
+		reverseIterator.Next()
+	}
+	assert.False(t, reverseIterator.Valid())
+
+	for i := 0; i < 1000; i++ {
+		key := randomKey()
+		if random.Intn(2) == 0 {
+			key = append(key, 1)
+		}
+		idx := sort.SearchStrings(keys, string(key))
+		iterator.Seek(key)
+		if idx < len(keys) {
+			assert.Equal(t, []byte(keys[idx]), iterator.Key())
+		} else {
+			assert.False(t, iterator.Valid())
+		}
+		if idx < len(keys) && keys[idx] == string(key) {
+			idx++
+		}
+		reverseIterator.Seek(key)
+		if idx > 0 {
+			assert.Equal(t, []byte(keys[idx-1]), reverseIterator.Key())
+		} else {
+			assert.False(t, reverseIterator.Valid())
+		}
+	}
+	iterator.Close()
+	reverseIterator.Close()
+}
@@ -0,0 +1,877 @@
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"skv-go/data"
+	"sort"
+	"sync"
+)
+
+// BPlusTreeIndexFileName B+树索引文件名
+const BPlusTreeIndexFileName = "bptree-index"
+
+var ErrBPlusTreeCorrupted = errors.New("the b+tree index file is corrupted")
+
+const (
+	bptreeMagic = "SKVB"
+	//文件头部有两个交替写入的元数据槽位，写入一半崩溃时可以使用另一个槽位恢复
+	bptreeMetaSize   = 64
+	bptreeHeaderSize = bptreeMetaSize * 2
+	//每个节点最多保存的条目数量
+	bptreeMaxEntries = 64
+	//文件超过该大小且无效数据多于有效数据时进行压缩
+	bptreeCompactThreshold = 4 * 1024 * 1024
+)
+
+// BPlusTree 保存在磁盘上的B+树索引
+// 节点采用写时复制的方式追加写入文件，更新完成后再写入指向新根节点的元数据，
+// 因此文件中的树总是一致的，无效的旧节点会在文件膨胀后通过压缩清理掉
+type BPlusTree struct {
+	path     string
+	file     *os.File
+	sync     bool
+	lock     *sync.RWMutex
+	meta     bptreeMeta
+	fileSize int64
+	//本次更新中待写入的节点数据
+	pending []byte
+	//内部节点缓存，节点写入后不会被修改，可以安全的缓存
+	cache     map[int64]*bptreeNode
+	cacheLock *sync.Mutex
+	//迭代器正在读取的索引文件，压缩后旧文件在迭代器关闭时才会关闭
+	fileRefs map[*os.File]int
+	fileLock *sync.Mutex
+}
+
+// bptreeMeta 元数据
+type bptreeMeta struct {
+	txId     uint64
+	root     bptreeRef
+	count    uint64
+	liveSize uint64
+}
+
+// bptreeRef 节点在文件中的位置，offset为0表示空节点
+type bptreeRef struct {
+	offset int64
+	length uint32
+}
+
+// bptreeNode B+树节点，内部节点的keys[i]为第i个子节点中最小的key
+type bptreeNode struct {
+	leaf     bool
+	keys     [][]byte
+	values   []*data.LogRecordPos
+	children []bptreeRef
+}
+
+// NewBPlusTree 打开或创建B+树索引文件
+func NewBPlusTree(dirPath string, syncWrites bool) (*BPlusTree, error) {
+	path := filepath.Join(dirPath, BPlusTreeIndexFileName)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	bpt := &BPlusTree{
+		path:      path,
+		file:      file,
+		sync:      syncWrites,
+		lock:      new(sync.RWMutex),
+		cache:     make(map[int64]*bptreeNode),
+		cacheLock: new(sync.Mutex),
+		fileRefs:  make(map[*os.File]int),
+		fileLock:  new(sync.Mutex),
+	}
+	if err := bpt.load(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return bpt, nil
+}
+
+// load 读取元数据，新文件则写入初始的元数据
+func (bpt *BPlusTree) load() error {
+	stat, err := bpt.file.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() == 0 {
+		header := make([]byte, bptreeHeaderSize)
+		copy(header, encodeBPTreeMeta(&bpt.meta))
+		copy(header[bptreeMetaSize:], encodeBPTreeMeta(&bpt.meta))
+		if _, err := bpt.file.WriteAt(header, 0); err != nil {
+			return err
+		}
+		bpt.fileSize = bptreeHeaderSize
+		return bpt.file.Sync()
+	}
+	if stat.Size() < bptreeHeaderSize {
+		return ErrBPlusTreeCorrupted
+	}
+	bpt.fileSize = stat.Size()
+
+	header := make([]byte, bptreeHeaderSize)
+	if _, err := bpt.file.ReadAt(header, 0); err != nil {
+		return err
+	}
+	//优先使用较新的元数据，其根节点无法读取时回退到另一个
+	var metas []*bptreeMeta
+	for i := 0; i < 2; i++ {
+		if meta := decodeBPTreeMeta(header[i*bptreeMetaSize : (i+1)*bptreeMetaSize]); meta != nil {
+			metas = append(metas, meta)
+		}
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].txId > metas[j].txId })
+	for _, meta := range metas {
+		if meta.root.offset == 0 {
+			bpt.meta = *meta
+			return nil
+		}
+		if _, err := bpt.readNode(meta.root); err == nil {
+			bpt.meta = *meta
+			return nil
+		}
+	}
+	return ErrBPlusTreeCorrupted
+}
+
+func (bpt *BPlusTree) Put(key []byte, pos *data.LogRecordPos) bool {
+	bpt.lock.Lock()
+	defer bpt.lock.Unlock()
+
+	meta := bpt.meta
+	refs, _, replaced, err := bpt.insert(bpt.meta.root, key, pos)
+	if err != nil {
+		bpt.rollback(meta)
+		return false
+	}
+	root := refs[0]
+	//根节点分裂，生成新的根节点
+	if len(refs) > 1 {
+		firstKeys := make([][]byte, len(refs))
+		for i, ref := range refs {
+			node, err := bpt.readPendingNode(ref)
+			if err != nil {
+				bpt.rollback(meta)
+				return false
+			}
+			firstKeys[i] = node.keys[0]
+		}
+		root = bpt.writeNode(&bptreeNode{keys: firstKeys, children: refs})
+	}
+	count := bpt.meta.count
+	if !replaced {
+		count++
+	}
+	if err := bpt.commit(root, count); err != nil {
+		bpt.rollback(meta)
+		return false
+	}
+	return true
+}
+
+func (bpt *BPlusTree) Get(key []byte) *data.LogRecordPos {
+	bpt.lock.RLock()
+	defer bpt.lock.RUnlock()
+
+	ref := bpt.meta.root
+	for ref.offset != 0 {
+		node, err := bpt.readNode(ref)
+		if err != nil {
+			return nil
+		}
+		if node.leaf {
+			idx, found := node.search(key)
+			if !found {
+				return nil
+			}
+			return node.values[idx]
+		}
+		ref = node.children[node.childIndex(key)]
+	}
+	return nil
+}
+
+func (bpt *BPlusTree) Delete(key []byte) bool {
+	bpt.lock.Lock()
+	defer bpt.lock.Unlock()
+
+	if bpt.meta.root.offset == 0 {
+		return false
+	}
+	meta := bpt.meta
+	root, _, found, err := bpt.delete(bpt.meta.root, key)
+	if err != nil || !found {
+		bpt.rollback(meta)
+		return false
+	}
+	//根节点只剩一个子节点时，直接使用子节点作为根节点
+	for root.offset != 0 {
+		node, err := bpt.readPendingNode(root)
+		if err != nil {
+			bpt.rollback(meta)
+			return false
+		}
+		if node.leaf || len(node.children) > 1 {
+			break
+		}
+		bpt.meta.liveSize -= uint64(root.length)
+		root = node.children[0]
+	}
+	if err := bpt.commit(root, bpt.meta.count-1); err != nil {
+		bpt.rollback(meta)
+		return false
+	}
+	return true
+}
+
+func (bpt *BPlusTree) Size() int {
+	bpt.lock.RLock()
+	defer bpt.lock.RUnlock()
+	return int(bpt.meta.count)
+}
+
+func (bpt *BPlusTree) Iterator(reverse bool) Iterator {
+	bpt.lock.RLock()
+	defer bpt.lock.RUnlock()
+	return newBPTreeIterator(bpt, bpt.acquireFile(), bpt.meta.root, reverse)
+}
+
+// Clone 获取索引当前的只读视图，写入不会修改已经写入文件的节点，视图只需要记录根节点，
+// 压缩替换掉的旧文件在视图关闭之前不会被关闭
+func (bpt *BPlusTree) Clone() Indexer {
+	bpt.lock.RLock()
+	defer bpt.lock.RUnlock()
+	return &bptreeSnapshot{
+		bpt:   bpt,
+		file:  bpt.acquireFile(),
+		root:  bpt.meta.root,
+		count: int(bpt.meta.count),
+	}
+}
+
+// Sync 持久化索引文件
+func (bpt *BPlusTree) Sync() error {
+	bpt.lock.Lock()
+	defer bpt.lock.Unlock()
+	return bpt.file.Sync()
+}
+
+// Close 关闭索引文件
+func (bpt *BPlusTree) Close() error {
+	bpt.lock.Lock()
+	defer bpt.lock.Unlock()
+	if err := bpt.file.Sync(); err != nil {
+		_ = bpt.file.Close()
+		return err
+	}
+	return bpt.file.Close()
+}
+
+// insert 写时复制地插入key，节点分裂时返回多个新节点，同时返回第一个新节点的最小key以及是否替换了已有的key
+func (bpt *BPlusTree) insert(ref bptreeRef, key []byte, pos *data.LogRecordPos) ([]bptreeRef, []byte, bool, error) {
+	if ref.offset == 0 {
+		leaf := &bptreeNode{leaf: true, keys: [][]byte{key}, values: []*data.LogRecordPos{pos}}
+		return []bptreeRef{bpt.writeNode(leaf)}, key, false, nil
+	}
+	node, err := bpt.readNode(ref)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	newNode := node.clone()
+	var replaced bool
+	if node.leaf {
+		idx, found := node.search(key)
+		if found {
+			newNode.values[idx] = pos
+			replaced = true
+		} else {
+			newNode.keys = insertAt(newNode.keys, idx, key)
+			newNode.values = insertAt(newNode.values, idx, pos)
+		}
+	} else {
+		idx := node.childIndex(key)
+		refs, firstKey, childReplaced, err := bpt.insert(node.children[idx], key, pos)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		replaced = childReplaced
+		newNode.children[idx] = refs[0]
+		newNode.keys[idx] = firstKey
+		//子节点发生了分裂
+		if len(refs) > 1 {
+			right, err := bpt.readPendingNode(refs[1])
+			if err != nil {
+				return nil, nil, false, err
+			}
+			newNode.children = insertAt(newNode.children, idx+1, refs[1])
+			newNode.keys = insertAt(newNode.keys, idx+1, right.keys[0])
+		}
+	}
+	bpt.discard(ref)
+	return bpt.writeSplitNode(newNode), newNode.keys[0], replaced, nil
+}
+
+// delete 写时复制地删除key，节点为空时返回空的位置
+func (bpt *BPlusTree) delete(ref bptreeRef, key []byte) (bptreeRef, []byte, bool, error) {
+	node, err := bpt.readNode(ref)
+	if err != nil {
+		return ref, nil, false, err
+	}
+	newNode := node.clone()
+	if node.leaf {
+		idx, found := node.search(key)
+		if !found {
+			return ref, nil, false, nil
+		}
+		newNode.keys = removeAt(newNode.keys, idx)
+		newNode.values = removeAt(newNode.values, idx)
+	} else {
+		idx := node.childIndex(key)
+		childRef, firstKey, found, err := bpt.delete(node.children[idx], key)
+		if err != nil || !found {
+			return ref, nil, found, err
+		}
+		if childRef.offset == 0 {
+			newNode.children = removeAt(newNode.children, idx)
+			newNode.keys = removeAt(newNode.keys, idx)
+		} else {
+			newNode.children[idx] = childRef
+			newNode.keys[idx] = firstKey
+		}
+	}
+	bpt.discard(ref)
+	if len(newNode.keys) == 0 {
+		return bptreeRef{}, nil, true, nil
+	}
+	return bpt.writeNode(newNode), newNode.keys[0], true, nil
+}
+
+// rollback 更新失败时丢弃待写入的数据并恢复元数据
+func (bpt *BPlusTree) rollback(meta bptreeMeta) {
+	bpt.pending = nil
+	bpt.meta = meta
+}
+
+// writeSplitNode 写入节点，条目过多时分裂为两个节点
+func (bpt *BPlusTree) writeSplitNode(node *bptreeNode) []bptreeRef {
+	if len(node.keys) <= bptreeMaxEntries {
+		return []bptreeRef{bpt.writeNode(node)}
+	}
+	mid := len(node.keys) / 2
+	left := &bptreeNode{leaf: node.leaf, keys: node.keys[:mid:mid]}
+	right := &bptreeNode{leaf: node.leaf, keys: node.keys[mid:]}
+	if node.leaf {
+		left.values, right.values = node.values[:mid:mid], node.values[mid:]
+	} else {
+		left.children, right.children = node.children[:mid:mid], node.children[mid:]
+	}
+	return []bptreeRef{bpt.writeNode(left), bpt.writeNode(right)}
+}
+
+// writeNode 将节点追加到待写入的数据中，返回节点的位置
+func (bpt *BPlusTree) writeNode(node *bptreeNode) bptreeRef {
+	buf := encodeBPTreeNode(node)
+	ref := bptreeRef{offset: bpt.fileSize + int64(len(bpt.pending)), length: uint32(len(buf))}
+	bpt.pending = append(bpt.pending, buf...)
+	bpt.meta.liveSize += uint64(ref.length)
+	return ref
+}
+
+// discard 标记节点已经被替换，成为无效数据
+func (bpt *BPlusTree) discard(ref bptreeRef) {
+	bpt.meta.liveSize -= uint64(ref.length)
+	bpt.cacheLock.Lock()
+	delete(bpt.cache, ref.offset)
+	bpt.cacheLock.Unlock()
+}
+
+// commit 写入新的节点和元数据，完成一次更新
+func (bpt *BPlusTree) commit(root bptreeRef, count uint64) error {
+	if _, err := bpt.file.WriteAt(bpt.pending, bpt.fileSize); err != nil {
+		return err
+	}
+	bpt.fileSize += int64(len(bpt.pending))
+	bpt.pending = nil
+	//节点数据持久化之后才能写入指向它们的元数据
+	if bpt.sync {
+		if err := bpt.file.Sync(); err != nil {
+			return err
+		}
+	}
+	meta := bpt.meta
+	meta.txId++
+	meta.root = root
+	meta.count = count
+	slot := int64(meta.txId%2) * bptreeMetaSize
+	if _, err := bpt.file.WriteAt(encodeBPTreeMeta(&meta), slot); err != nil {
+		return err
+	}
+	if bpt.sync {
+		if err := bpt.file.Sync(); err != nil {
+			return err
+		}
+	}
+	bpt.meta = meta
+
+	//新的元数据已经写入，压缩失败不能影响本次更新，旧文件仍然完整，下次更新时会再次尝试
+	if bpt.fileSize > bptreeCompactThreshold && uint64(bpt.fileSize-bptreeHeaderSize) > 2*bpt.meta.liveSize {
+		_ = bpt.compact()
+	}
+	return nil
+}
+
+// compact 将有效的节点重写到新文件中，清理无效数据
+func (bpt *BPlusTree) compact() error {
+	tmpPath := bpt.path + ".compact"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	//失败时删除不完整的临时文件
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = tmpFile.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+	compacted := &BPlusTree{path: tmpPath, file: tmpFile, fileSize: bptreeHeaderSize}
+	var copyNode func(ref bptreeRef) (bptreeRef, error)
+	copyNode = func(ref bptreeRef) (bptreeRef, error) {
+		node, err := bpt.readNode(ref)
+		if err != nil {
+			return ref, err
+		}
+		if !node.leaf {
+			node = node.clone()
+			for i, child := range node.children {
+				if node.children[i], err = copyNode(child); err != nil {
+					return ref, err
+				}
+			}
+		}
+		return compacted.writeNode(node), nil
+	}
+	var root bptreeRef
+	if bpt.meta.root.offset != 0 {
+		if root, err = copyNode(bpt.meta.root); err != nil {
+			return err
+		}
+	}
+	meta := bptreeMeta{txId: bpt.meta.txId + 1, root: root, count: bpt.meta.count, liveSize: compacted.meta.liveSize}
+	header := make([]byte, bptreeHeaderSize)
+	copy(header, encodeBPTreeMeta(&meta))
+	copy(header[bptreeMetaSize:], encodeBPTreeMeta(&meta))
+	if _, err := tmpFile.WriteAt(append(header, compacted.pending...), 0); err != nil {
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, bpt.path); err != nil {
+		return err
+	}
+	renamed = true
+	bpt.fileLock.Lock()
+	if bpt.fileRefs[bpt.file] == 0 {
+		_ = bpt.file.Close()
+	}
+	bpt.file = tmpFile
+	bpt.fileLock.Unlock()
+	bpt.fileSize = compacted.fileSize + int64(len(compacted.pending))
+	bpt.meta = meta
+	bpt.cacheLock.Lock()
+	bpt.cache = make(map[int64]*bptreeNode)
+	bpt.cacheLock.Unlock()
+	return nil
+}
+
+// readPendingNode 读取节点，节点可能还在待写入的数据中
+func (bpt *BPlusTree) readPendingNode(ref bptreeRef) (*bptreeNode, error) {
+	if ref.offset >= bpt.fileSize {
+		start := ref.offset - bpt.fileSize
+		return decodeBPTreeNode(bpt.pending[start : start+int64(ref.length)])
+	}
+	return bpt.readNode(ref)
+}
+
+// readNode 从文件中读取节点
+func (bpt *BPlusTree) readNode(ref bptreeRef) (*bptreeNode, error) {
+	bpt.cacheLock.Lock()
+	node, ok := bpt.cache[ref.offset]
+	bpt.cacheLock.Unlock()
+	if ok {
+		return node, nil
+	}
+	if ref.offset+int64(ref.length) > bpt.fileSize {
+		return nil, ErrBPlusTreeCorrupted
+	}
+	node, err := readBPTreeNode(bpt.file, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !node.leaf {
+		bpt.cacheLock.Lock()
+		bpt.cache[ref.offset] = node
+		bpt.cacheLock.Unlock()
+	}
+	return node, nil
+}
+
+// readBPTreeNode 从指定的索引文件中读取节点，不使用缓存
+func readBPTreeNode(file *os.File, ref bptreeRef) (*bptreeNode, error) {
+	buf := make([]byte, ref.length)
+	if _, err := file.ReadAt(buf, ref.offset); err != nil {
+		return nil, err
+	}
+	return decodeBPTreeNode(buf)
+}
+
+// acquireFile 获取当前的索引文件供迭代器读取，压缩不会关闭还在被读取的旧文件，使用该方法需要加锁
+func (bpt *BPlusTree) acquireFile() *os.File {
+	return bpt.retainFile(bpt.file)
+}
+
+// retainFile 增加索引文件的引用计数，在对应的releaseFile之前文件不会被关闭
+func (bpt *BPlusTree) retainFile(file *os.File) *os.File {
+	bpt.fileLock.Lock()
+	defer bpt.fileLock.Unlock()
+	bpt.fileRefs[file]++
+	return file
+}
+
+// releaseFile 释放acquireFile获取的索引文件，压缩替换掉的旧文件在最后一次释放时关闭
+func (bpt *BPlusTree) releaseFile(file *os.File) {
+	bpt.fileLock.Lock()
+	defer bpt.fileLock.Unlock()
+	bpt.fileRefs[file]--
+	if bpt.fileRefs[file] > 0 {
+		return
+	}
+	delete(bpt.fileRefs, file)
+	if file != bpt.file {
+		_ = file.Close()
+	}
+}
+
+// search 在叶子节点中查找key，返回key所在或者应该插入的位置
+func (n *bptreeNode) search(key []byte) (int, bool) {
+	idx := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) >= 0 })
+	return idx, idx < len(n.keys) && bytes.Equal(n.keys[idx], key)
+}
+
+// childIndex 在内部节点中查找key所在的子节点
+func (n *bptreeNode) childIndex(key []byte) int {
+	idx := sort.Search(len(n.keys), func(i int) bool { return bytes.Compare(n.keys[i], key) > 0 })
+	if idx > 0 {
+		idx--
+	}
+	return idx
+}
+
+func (n *bptreeNode) clone() *bptreeNode {
+	newNode := &bptreeNode{leaf: n.leaf, keys: append([][]byte(nil), n.keys...)}
+	if n.leaf {
+		newNode.values = append([]*data.LogRecordPos(nil), n.values...)
+	} else {
+		newNode.children = append([]bptreeRef(nil), n.children...)
+	}
+	return newNode
+}
+
+func insertAt[T any](s []T, idx int, v T) []T {
+	s = append(s, v)
+	copy(s[idx+1:], s[idx:])
+	s[idx] = v
+	return s
+}
+
+func removeAt[T any](s []T, idx int) []T {
+	return append(s[:idx], s[idx+1:]...)
+}
+
+// encodeBPTreeNode 编码节点，由类型，条目数量，各个条目以及末尾的CRC组成
+func encodeBPTreeNode(node *bptreeNode) []byte {
+	buf := make([]byte, 0, 256)
+	if node.leaf {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(node.keys)))
+	for i, key := range node.keys {
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+		if node.leaf {
+			pos := data.EncodeLogRecordPos(node.values[i])
+			buf = binary.AppendUvarint(buf, uint64(len(pos)))
+			buf = append(buf, pos...)
+		} else {
+			buf = binary.AppendUvarint(buf, uint64(node.children[i].offset))
+			buf = binary.AppendUvarint(buf, uint64(node.children[i].length))
+		}
+	}
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeBPTreeNode 解码节点并校验CRC
+func decodeBPTreeNode(buf []byte) (*bptreeNode, error) {
+	if len(buf) < 1+crc32.Size {
+		return nil, ErrBPlusTreeCorrupted
+	}
+	payload := buf[:len(buf)-crc32.Size]
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(buf[len(payload):]) {
+		return nil, ErrBPlusTreeCorrupted
+	}
+	node := &bptreeNode{leaf: payload[0] == 1}
+	index := 1
+	readUvarint := func() uint64 {
+		v, n := binary.Uvarint(payload[index:])
+		index += n
+		return v
+	}
+	num := int(readUvarint())
+	node.keys = make([][]byte, num)
+	for i := 0; i < num; i++ {
+		keySize := int(readUvarint())
+		node.keys[i] = payload[index : index+keySize]
+		index += keySize
+		if node.leaf {
+			posSize := int(readUvarint())
+			node.values = append(node.values, data.DecodeLogRecordPos(payload[index:index+posSize]))
+			index += posSize
+		} else {
+			offset := int64(readUvarint())
+			length := uint32(readUvarint())
+			node.children = append(node.children, bptreeRef{offset: offset, length: length})
+		}
+	}
+	return node, nil
+}
+
+// encodeBPTreeMeta 编码元数据
+func encodeBPTreeMeta(meta *bptreeMeta) []byte {
+	buf := make([]byte, 0, bptreeMetaSize)
+	buf = append(buf, bptreeMagic...)
+	buf = binary.LittleEndian.AppendUint64(buf, meta.txId)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(meta.root.offset))
+	buf = binary.LittleEndian.AppendUint32(buf, meta.root.length)
+	buf = binary.LittleEndian.AppendUint64(buf, meta.count)
+	buf = binary.LittleEndian.AppendUint64(buf, meta.liveSize)
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeBPTreeMeta 解码元数据，数据无效时返回nil
+func decodeBPTreeMeta(buf []byte) *bptreeMeta {
+	const size = 4 + 8 + 8 + 4 + 8 + 8
+	if string(buf[:4]) != bptreeMagic ||
+		crc32.ChecksumIEEE(buf[:size]) != binary.LittleEndian.Uint32(buf[size:]) {
+		return nil
+	}
+	return &bptreeMeta{
+		txId: binary.LittleEndian.Uint64(buf[4:]),
+		root: bptreeRef{
+			offset: int64(binary.LittleEndian.Uint64(buf[12:])),
+			length: binary.LittleEndian.Uint32(buf[20:]),
+		},
+		count:    binary.LittleEndian.Uint64(buf[24:]),
+		liveSize: binary.LittleEndian.Uint64(buf[32:]),
+	}
+}
+
+// bptreeSnapshot B+树索引在某一时刻的只读视图，Put和Delete总是返回false
+type bptreeSnapshot struct {
+	bpt   *BPlusTree
+	file  *os.File
+	root  bptreeRef
+	count int
+}
+
+func (bps *bptreeSnapshot) Put(_ []byte, _ *data.LogRecordPos) bool {
+	return false
+}
+
+func (bps *bptreeSnapshot) Get(key []byte) *data.LogRecordPos {
+	ref := bps.root
+	for ref.offset != 0 && bps.file != nil {
+		node, err := readBPTreeNode(bps.file, ref)
+		if err != nil {
+			return nil
+		}
+		if node.leaf {
+			idx, found := node.search(key)
+			if !found {
+				return nil
+			}
+			return node.values[idx]
+		}
+		ref = node.children[node.childIndex(key)]
+	}
+	return nil
+}
+
+func (bps *bptreeSnapshot) Delete(_ []byte) bool {
+	return false
+}
+
+func (bps *bptreeSnapshot) Size() int {
+	return bps.count
+}
+
+func (bps *bptreeSnapshot) Iterator(reverse bool) Iterator {
+	//视图关闭后返回一个空的迭代器
+	if bps.file == nil {
+		return newBPTreeIterator(bps.bpt, nil, bptreeRef{}, reverse)
+	}
+	return newBPTreeIterator(bps.bpt, bps.bpt.retainFile(bps.file), bps.root, reverse)
+}
+
+// Close 释放视图读取的索引文件，已经创建的迭代器仍然可以继续使用
+func (bps *bptreeSnapshot) Close() error {
+	if bps.file != nil {
+		bps.bpt.releaseFile(bps.file)
+		bps.file = nil
+	}
+	return nil
+}
+
+// bptreeIterator B+树索引迭代器，遍历创建时的根节点，每次只读取路径上的节点，不会把整棵树加载到内存中。
+// 节点写入后不会被修改，迭代器使用期间压缩产生的新文件不影响旧文件的读取
+type bptreeIterator struct {
+	bpt     *BPlusTree
+	file    *os.File
+	root    bptreeRef
+	reverse bool
+	//从根节点到当前叶子节点的路径
+	stack []bptreeFrame
+}
+
+// bptreeFrame 路径上的一个节点以及当前所在的条目下标
+type bptreeFrame struct {
+	node *bptreeNode
+	idx  int
+}
+
+func newBPTreeIterator(bpt *BPlusTree, file *os.File, root bptreeRef, reverse bool) *bptreeIterator {
+	bpi := &bptreeIterator{
+		bpt:     bpt,
+		file:    file,
+		root:    root,
+		reverse: reverse,
+	}
+	bpi.Rewind()
+	return bpi
+}
+
+func (bpi *bptreeIterator) Rewind() {
+	bpi.stack = bpi.stack[:0]
+	bpi.descendEdge(bpi.root)
+}
+
+func (bpi *bptreeIterator) Seek(key []byte) {
+	bpi.stack = bpi.stack[:0]
+	ref := bpi.root
+	for ref.offset != 0 {
+		node, err := readBPTreeNode(bpi.file, ref)
+		if err != nil {
+			bpi.stack = nil
+			return
+		}
+		if !node.leaf {
+			idx := node.childIndex(key)
+			bpi.stack = append(bpi.stack, bptreeFrame{node: node, idx: idx})
+			ref = node.children[idx]
+			continue
+		}
+		idx, found := node.search(key)
+		if bpi.reverse && !found {
+			idx--
+		}
+		//叶子节点中没有满足条件的key，移动到相邻的叶子节点
+		switch {
+		case idx >= len(node.keys):
+			bpi.stack = append(bpi.stack, bptreeFrame{node: node, idx: len(node.keys) - 1})
+			bpi.step()
+		case idx < 0:
+			bpi.stack = append(bpi.stack, bptreeFrame{node: node, idx: 0})
+			bpi.step()
+		default:
+			bpi.stack = append(bpi.stack, bptreeFrame{node: node, idx: idx})
+		}
+		return
+	}
+}
+
+func (bpi *bptreeIterator) Next() {
+	if bpi.Valid() {
+		bpi.step()
+	}
+}
+
+func (bpi *bptreeIterator) Valid() bool {
+	return len(bpi.stack) > 0
+}
+
+func (bpi *bptreeIterator) Key() []byte {
+	frame := bpi.stack[len(bpi.stack)-1]
+	return frame.node.keys[frame.idx]
+}
+
+func (bpi *bptreeIterator) Value() *data.LogRecordPos {
+	frame := bpi.stack[len(bpi.stack)-1]
+	return frame.node.values[frame.idx]
+}
+
+func (bpi *bptreeIterator) Close() {
+	if bpi.file == nil {
+		return
+	}
+	bpi.stack = nil
+	bpi.bpt.releaseFile(bpi.file)
+	bpi.file = nil
+}
+
+// step 移动到下一个条目，当前叶子节点遍历完后回到父节点，再进入下一个子节点
+func (bpi *bptreeIterator) step() {
+	for len(bpi.stack) > 0 {
+		frame := &bpi.stack[len(bpi.stack)-1]
+		if bpi.reverse {
+			frame.idx--
+		} else {
+			frame.idx++
+		}
+		if frame.idx >= 0 && frame.idx < len(frame.node.keys) {
+			if !frame.node.leaf {
+				bpi.descendEdge(frame.node.children[frame.idx])
+			}
+			return
+		}
+		bpi.stack = bpi.stack[:len(bpi.stack)-1]
+	}
+}
+
+// descendEdge 从指定节点一直走到最左边的叶子节点，反向遍历时走到最右边
+func (bpi *bptreeIterator) descendEdge(ref bptreeRef) {
+	for ref.offset != 0 {
+		node, err := readBPTreeNode(bpi.file, ref)
+		if err != nil || len(node.keys) == 0 {
+			bpi.stack = nil
+			return
+		}
+		idx := 0
+		if bpi.reverse {
+			idx = len(node.keys) - 1
+		}
+		bpi.stack = append(bpi.stack, bptreeFrame{node: node, idx: idx})
+		if node.leaf {
+			return
+		}
+		ref = node.children[idx]
+	}
+}
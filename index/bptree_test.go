@@ -0,0 +1,250 @@
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"skv-go/data"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBPlusTree(t *testing.T) (*BPlusTree, string) {
+	dir, _ := os.MkdirTemp("", "test-bptree")
+	bpt, err := NewBPlusTree(dir, false)
+	assert.NoError(t, err)
+	return bpt, dir
+}
+
+func TestBPlusTree_Put(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	assert.True(t, bpt.Put([]byte("key"), &data.LogRecordPos{Fid: 1, Offset: 1}))
+	assert.True(t, bpt.Put([]byte("key"), &data.LogRecordPos{Fid: 1, Offset: 2}))
+	assert.True(t, bpt.Put(nil, &data.LogRecordPos{Fid: 1, Offset: 3}))
+	assert.Equal(t, 2, bpt.Size())
+}
+
+func TestBPlusTree_Get(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	pos1 := &data.LogRecordPos{Fid: 1, Offset: 1}
+	pos2 := &data.LogRecordPos{Fid: 2, Offset: 200}
+	bpt.Put([]byte("key-1"), pos1)
+	bpt.Put([]byte("key-2"), pos2)
+
+	assert.Equal(t, pos1, bpt.Get([]byte("key-1")))
+	assert.Equal(t, pos2, bpt.Get([]byte("key-2")))
+	assert.Nil(t, bpt.Get([]byte("key-3")))
+
+	bpt.Put([]byte("key-1"), pos2)
+	assert.Equal(t, pos2, bpt.Get([]byte("key-1")))
+}
+
+func TestBPlusTree_Delete(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	bpt.Put([]byte("key-1"), &data.LogRecordPos{Fid: 1, Offset: 1})
+	assert.True(t, bpt.Delete([]byte("key-1")))
+	assert.False(t, bpt.Delete([]byte("key-1")))
+	assert.False(t, bpt.Delete([]byte("not-exist")))
+	assert.Nil(t, bpt.Get([]byte("key-1")))
+	assert.Equal(t, 0, bpt.Size())
+}
+
+func TestBPlusTree_SplitAndMergeNodes(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	// Enough keys to build a multi-level tree
+	for i := 0; i < 10000; i++ {
+		bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: uint32(i), Offset: int64(i)})
+	}
+	assert.Equal(t, 10000, bpt.Size())
+	for i := 0; i < 10000; i += 2 {
+		assert.True(t, bpt.Delete([]byte(fmt.Sprintf("key-%09d", i))))
+	}
+	assert.Equal(t, 5000, bpt.Size())
+	for i := 0; i < 10000; i++ {
+		pos := bpt.Get([]byte(fmt.Sprintf("key-%09d", i)))
+		if i%2 == 0 {
+			assert.Nil(t, pos)
+		} else {
+			assert.Equal(t, &data.LogRecordPos{Fid: uint32(i), Offset: int64(i)}, pos)
+		}
+	}
+}
+
+func TestBPlusTree_Reopen(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+
+	for i := 0; i < 1000; i++ {
+		bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	bpt.Delete([]byte(fmt.Sprintf("key-%09d", 10)))
+	assert.NoError(t, bpt.Sync())
+	assert.NoError(t, bpt.Close())
+
+	bpt, err := NewBPlusTree(dir, false)
+	assert.NoError(t, err)
+	defer bpt.Close()
+	assert.Equal(t, 999, bpt.Size())
+	assert.Nil(t, bpt.Get([]byte(fmt.Sprintf("key-%09d", 10))))
+	assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 500}, bpt.Get([]byte(fmt.Sprintf("key-%09d", 500))))
+}
+
+func TestBPlusTree_Compact(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	// Overwriting the same keys leaves lots of stale nodes in the file
+	for round := 0; round < 30; round++ {
+		for i := 0; i < 2000; i++ {
+			bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: uint32(round), Offset: int64(i)})
+		}
+	}
+	stat, err := os.Stat(filepath.Join(dir, BPlusTreeIndexFileName))
+	assert.NoError(t, err)
+	assert.Less(t, stat.Size(), int64(2*bptreeCompactThreshold))
+	assert.Equal(t, 2000, bpt.Size())
+	assert.Equal(t, &data.LogRecordPos{Fid: 29, Offset: 100}, bpt.Get([]byte(fmt.Sprintf("key-%09d", 100))))
+}
+
+func TestBPlusTree_Iterator(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	iter1 := bpt.Iterator(false)
+	assert.False(t, iter1.Valid())
+	iter1.Close()
+
+	for i := 0; i < 200; i++ {
+		bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	iter2 := bpt.Iterator(false)
+	var count int
+	for iter2.Rewind(); iter2.Valid(); iter2.Next() {
+		assert.Equal(t, []byte(fmt.Sprintf("key-%09d", count)), iter2.Key())
+		count++
+	}
+	assert.Equal(t, 200, count)
+	iter2.Seek([]byte("key-000000150"))
+	assert.Equal(t, []byte("key-000000150"), iter2.Key())
+	iter2.Close()
+
+	iter3 := bpt.Iterator(true)
+	iter3.Rewind()
+	assert.Equal(t, []byte("key-000000199"), iter3.Key())
+	iter3.Seek([]byte("key-000000150"))
+	assert.Equal(t, []byte("key-000000150"), iter3.Key())
+	iter3.Close()
+}
+
+func TestBPlusTree_Iterator_Lazy(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	// Several levels of nodes, only even keys
+	for i := 0; i < 10000; i += 2 {
+		bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	iter := bpt.Iterator(false)
+	iter.Seek([]byte(fmt.Sprintf("key-%09d", 4095)))
+	assert.Equal(t, []byte(fmt.Sprintf("key-%09d", 4096)), iter.Key())
+	iter.Seek([]byte("key-999999999"))
+	assert.False(t, iter.Valid())
+
+	reverse := bpt.Iterator(true)
+	reverse.Seek([]byte(fmt.Sprintf("key-%09d", 4095)))
+	assert.Equal(t, []byte(fmt.Sprintf("key-%09d", 4094)), reverse.Key())
+	reverse.Seek([]byte("a"))
+	assert.False(t, reverse.Valid())
+	reverse.Close()
+
+	// Writes and compaction after the iterator was created are not visible to it
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10000; i++ {
+			bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: 2, Offset: int64(i)})
+		}
+	}
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, []byte(fmt.Sprintf("key-%09d", count*2)), iter.Key())
+		assert.Equal(t, uint32(1), iter.Value().Fid)
+		count++
+	}
+	assert.Equal(t, 5000, count)
+	iter.Close()
+	assert.Equal(t, 0, len(bpt.fileRefs))
+}
+
+func TestBPlusTree_Clone(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+	defer bpt.Close()
+
+	for i := 0; i < 2000; i++ {
+		bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+	clone := bpt.Clone()
+	assert.False(t, clone.Put([]byte("key"), &data.LogRecordPos{Fid: 1}))
+	assert.False(t, clone.Delete([]byte(fmt.Sprintf("key-%09d", 0))))
+
+	// Writes and compaction after the clone are not visible to it
+	assert.True(t, bpt.Delete([]byte(fmt.Sprintf("key-%09d", 0))))
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 10000; i++ {
+			bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: 2, Offset: int64(i)})
+		}
+	}
+	assert.Equal(t, 2000, clone.Size())
+	assert.Equal(t, &data.LogRecordPos{Fid: 1, Offset: 0}, clone.Get([]byte(fmt.Sprintf("key-%09d", 0))))
+	assert.Nil(t, clone.Get([]byte(fmt.Sprintf("key-%09d", 5000))))
+	iter := clone.Iterator(false)
+	var count int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.Equal(t, uint32(1), iter.Value().Fid)
+		count++
+	}
+	assert.Equal(t, 2000, count)
+
+	// Iterators created from the clone outlive it
+	assert.NoError(t, clone.Close())
+	iter.Rewind()
+	assert.True(t, iter.Valid())
+	iter.Close()
+	assert.Equal(t, 0, len(bpt.fileRefs))
+	assert.False(t, clone.Iterator(false).Valid())
+}
+
+func TestBPlusTree_CompactFailure(t *testing.T) {
+	bpt, dir := newTestBPlusTree(t)
+	defer os.RemoveAll(dir)
+
+	// A directory in the way makes every compaction fail
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, BPlusTreeIndexFileName+".compact"), os.ModePerm))
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 2000; i++ {
+			assert.True(t, bpt.Put([]byte(fmt.Sprintf("key-%09d", i)), &data.LogRecordPos{Fid: uint32(round), Offset: int64(i)}))
+		}
+	}
+	assert.NoError(t, bpt.Close())
+
+	bpt, err := NewBPlusTree(dir, false)
+	assert.NoError(t, err)
+	defer bpt.Close()
+	assert.Equal(t, 2000, bpt.Size())
+	assert.Equal(t, &data.LogRecordPos{Fid: 2, Offset: 100}, bpt.Get([]byte(fmt.Sprintf("key-%09d", 100))))
+}
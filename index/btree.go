@@ -1,10 +1,8 @@
 package index
 
 import (
-	"bytes"
 	"github.com/google/btree"
 	"skv-go/data"
-	"sort"
 	"sync"
 )
 
@@ -58,73 +56,115 @@ func (bt *BTree) Iterator(reverse bool) Iterator {
 	if bt.tree == nil {
 		return nil
 	}
-	bt.lock.RLock()
-	defer bt.lock.RUnlock()
-	return newBTreeIterator(bt.tree, reverse)
+	//复制B树需要修改原来的树，因此需要加写锁
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	return newBTreeIterator(bt.tree.Clone(), reverse)
+}
+
+func (bt *BTree) Close() error {
+	return nil
 }
 
+// Clone 复制一份索引，底层的B树是写时复制的，复制本身的开销很小，
+// 之后对任意一方的修改都不会影响另一方
+func (bt *BTree) Clone() Indexer {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+	return &BTree{tree: bt.tree.Clone(), lock: new(sync.RWMutex)}
+}
+
+// btreeIterator B树迭代器，在写时复制的B树副本上按需查找下一个位置，
+// 创建时不需要复制所有的数据，之后对索引的修改对迭代器不可见
 type btreeIterator struct {
-	currIndex int     //当前遍历的下标位置
-	reverse   bool    //是否反向遍历
-	values    []*Item //key+pos信息
+	tree    *btree.BTree //创建迭代器时B树的副本
+	reverse bool         //是否反向遍历
+	curr    *Item        //当前位置的key+pos信息，为nil表示遍历结束
 }
 
 func newBTreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
-	var idx int
-	values := make([]*Item, tree.Len())
-	//遍历B树，将key+pos信息保存到values中
-	//这玩意类似于mapper
-	saveValues := func(i btree.Item) bool {
-		values[idx] = i.(*Item)
-		idx++
-		return true
-	}
-	if reverse {
-		tree.Descend(saveValues)
-	} else {
-		tree.Ascend(saveValues)
-	}
-	return &btreeIterator{
-		currIndex: 0,
-		reverse:   reverse,
-		values:    values,
+	bti := &btreeIterator{
+		tree:    tree,
+		reverse: reverse,
 	}
+	bti.Rewind()
+	return bti
 }
 
 func (bti *btreeIterator) Rewind() {
-	bti.currIndex = 0
+	if bti.tree == nil {
+		return
+	}
+	var item btree.Item
+	if bti.reverse {
+		item = bti.tree.Max()
+	} else {
+		item = bti.tree.Min()
+	}
+	bti.setCurr(item)
 }
 
 func (bti *btreeIterator) Seek(key []byte) {
+	if bti.tree == nil {
+		return
+	}
+	bti.curr = nil
+	pivot := &Item{key: key}
+	//正向找到第一个大于等于key的位置，反向找到第一个小于等于key的位置
 	if bti.reverse {
-		//使用二分查找找到第一个小于等于key的位置
-		bti.currIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) <= 0
-		})
+		bti.tree.DescendLessOrEqual(pivot, bti.visit)
 	} else {
-		bti.currIndex = sort.Search(len(bti.values), func(i int) bool {
-			return bytes.Compare(bti.values[i].key, key) >= 0
-		})
-
+		bti.tree.AscendGreaterOrEqual(pivot, bti.visit)
 	}
 }
 
 func (bti *btreeIterator) Next() {
-	bti.currIndex += 1
+	if bti.curr == nil {
+		return
+	}
+	prev := bti.curr
+	bti.curr = nil
+	//跳过当前位置本身
+	skipPrev := func(i btree.Item) bool {
+		if !prev.Less(i) && !i.Less(prev) {
+			return true
+		}
+		return bti.visit(i)
+	}
+	if bti.reverse {
+		bti.tree.DescendLessOrEqual(prev, skipPrev)
+	} else {
+		bti.tree.AscendGreaterOrEqual(prev, skipPrev)
+	}
+}
+
+// visit 记录遍历到的第一个位置，然后停止遍历
+func (bti *btreeIterator) visit(i btree.Item) bool {
+	bti.curr = i.(*Item)
+	return false
+}
+
+func (bti *btreeIterator) setCurr(item btree.Item) {
+	if item == nil {
+		bti.curr = nil
+		return
+	}
+	bti.curr = item.(*Item)
 }
 
 func (bti *btreeIterator) Valid() bool {
-	return bti.currIndex < len(bti.values)
+	return bti.curr != nil
 }
 
 func (bti *btreeIterator) Key() []byte {
-	return bti.values[bti.currIndex].key
+	return bti.curr.key
 }
 
 func (bti *btreeIterator) Value() *data.LogRecordPos {
-	return bti.values[bti.currIndex].pos
+	return bti.curr.pos
 }
 
 func (bti *btreeIterator) Close() {
-	bti.values = nil
+	bti.tree = nil
+	bti.curr = nil
 }
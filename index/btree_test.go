@@ -164,3 +164,53 @@ func TestBTreeIterator_ReverseSeek(t *testing.T) {
 	reverseIterator.Seek([]byte{5})
 	assert.Equal(t, []byte{5}, reverseIterator.Key())
 }
+
+// 测试复制出来的索引和原索引互不影响
+func TestBTree_Clone(t *testing.T) {
+	bt := NewBTree()
+	pos := &data.LogRecordPos{Offset: 1, Fid: 1}
+	bt.Put([]byte("a"), pos)
+	bt.Put([]byte("b"), pos)
+
+	clone := bt.Clone()
+	bt.Put([]byte("c"), pos)
+	bt.Delete([]byte("a"))
+	clone.Put([]byte("d"), pos)
+
+	assert.Equal(t, 2, bt.Size())
+	assert.Nil(t, bt.Get([]byte("a")))
+	assert.Nil(t, bt.Get([]byte("d")))
+	assert.Equal(t, 3, clone.Size())
+	assert.Equal(t, pos, clone.Get([]byte("a")))
+	assert.Nil(t, clone.Get([]byte("c")))
+}
+
+// 测试迭代器遍历的是创建时的数据，以及Seek到不存在的key
+func TestBTreeIterator_Lazy(t *testing.T) {
+	bt := NewBTree()
+	for i := 0; i < 10; i += 2 {
+		bt.Put([]byte{byte(i)}, &data.LogRecordPos{Offset: int64(i)})
+	}
+	iterator := bt.Iterator(false)
+	reverseIterator := bt.Iterator(true)
+	bt.Put([]byte{3}, &data.LogRecordPos{Offset: 3})
+	bt.Delete([]byte{4})
+
+	var keys []byte
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		keys = append(keys, iterator.Key()[0])
+	}
+	assert.Equal(t, []byte{0, 2, 4, 6, 8}, keys)
+
+	iterator.Seek([]byte{5})
+	assert.Equal(t, []byte{6}, iterator.Key())
+	iterator.Seek([]byte{9})
+	assert.False(t, iterator.Valid())
+	reverseIterator.Seek([]byte{5})
+	assert.Equal(t, []byte{4}, reverseIterator.Key())
+	reverseIterator.Next()
+	assert.Equal(t, []byte{2}, reverseIterator.Key())
+
+	// An empty tree gives an invalid iterator
+	assert.False(t, NewBTree().Iterator(false).Valid())
+}
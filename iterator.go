@@ -3,35 +3,90 @@ package skv_go
 import (
 	"bytes"
 	"skv-go/index"
+	"time"
 )
 
 type Iterator struct {
 	indexIter index.Iterator  //索引迭代器
 	db        *DB             //数据库实例
+	snapshot  *Snapshot       //遍历快照时使用的快照
 	options   IteratorOptions //迭代器配置项
+	finished  bool            //已经遍历完范围内的key
 }
 
-// NewIterator 创建一个迭代器
+// NewIterator 创建一个迭代器，创建后位于范围内的第一个key
 func (db *DB) NewIterator(opts IteratorOptions) *Iterator {
-	return &Iterator{
+	it := &Iterator{
 		indexIter: db.index.Iterator(opts.Reverse),
 		db:        db,
 		options:   opts,
 	}
+	it.Rewind()
+	return it
 }
 
-// Rewind 回到起点
+// Rewind 回到起点，直接定位到范围内的第一个key
 func (it *Iterator) Rewind() {
-	it.indexIter.Rewind()
+	it.finished = false
+	if !it.options.Reverse {
+		if start := it.rangeStart(); start != nil {
+			it.indexIter.Seek(start)
+		} else {
+			it.indexIter.Rewind()
+		}
+	} else {
+		if end := it.rangeEnd(); end != nil {
+			it.seekBefore(end)
+		} else {
+			it.indexIter.Rewind()
+		}
+	}
 	it.skipToNext()
 }
 
-// Seek 根据传入的key找到对应的位置
+// Seek 根据传入的key找到对应的位置，超出上下界的key会被限制在范围之内
 func (it *Iterator) Seek(key []byte) {
-	it.indexIter.Seek(key)
+	it.finished = false
+	lowerBound, upperBound := it.options.LowerBound, it.options.UpperBound
+	if !it.options.Reverse && lowerBound != nil && bytes.Compare(key, lowerBound) < 0 {
+		key = lowerBound
+	}
+	if it.options.Reverse && upperBound != nil && bytes.Compare(key, upperBound) >= 0 {
+		it.seekBefore(upperBound)
+	} else {
+		it.indexIter.Seek(key)
+	}
 	it.skipToNext()
 }
 
+// seekBefore 反向遍历时定位到最后一个小于end的key
+func (it *Iterator) seekBefore(end []byte) {
+	it.indexIter.Seek(end)
+	if it.indexIter.Valid() && bytes.Equal(it.indexIter.Key(), end) {
+		it.indexIter.Next()
+	}
+}
+
+// rangeStart 获取遍历范围的起点，即下界和前缀中较大的一个，没有限制时返回nil
+func (it *Iterator) rangeStart() []byte {
+	start := it.options.LowerBound
+	if prefix := it.options.Prefix; len(prefix) > 0 && (start == nil || bytes.Compare(prefix, start) > 0) {
+		start = prefix
+	}
+	return start
+}
+
+// rangeEnd 获取遍历范围的终点（不包含），即上界和前缀上界中较小的一个，没有限制时返回nil
+func (it *Iterator) rangeEnd() []byte {
+	end := it.options.UpperBound
+	if len(it.options.Prefix) > 0 {
+		if prefixEnd := prefixEnd(it.options.Prefix); prefixEnd != nil && (end == nil || bytes.Compare(prefixEnd, end) < 0) {
+			end = prefixEnd
+		}
+	}
+	return end
+}
+
 // Next 移动到下一个位置
 func (it *Iterator) Next() {
 	it.indexIter.Next()
@@ -40,7 +95,7 @@ func (it *Iterator) Next() {
 
 // Valid 判断是否有效，即是否还有下一个位置
 func (it *Iterator) Valid() bool {
-	return it.indexIter.Valid()
+	return !it.finished && it.indexIter.Valid()
 }
 
 // Key 获取key
@@ -51,6 +106,9 @@ func (it *Iterator) Key() []byte {
 // Value 获取value
 func (it *Iterator) Value() ([]byte, error) {
 	logRecordPos := it.indexIter.Value()
+	if it.snapshot != nil {
+		return it.snapshot.getValue(logRecordPos)
+	}
 	it.db.rw.RLock()
 	defer it.db.rw.RUnlock()
 	return it.db.getValueByPosition(logRecordPos)
@@ -61,17 +119,58 @@ func (it *Iterator) Close() {
 	it.indexIter.Close()
 }
 
-// skipToNext 跳过前缀不匹配的key
+// skipToNext 跳过不在范围内以及已经过期的key
 func (it *Iterator) skipToNext() {
-	prefixLen := len(it.options.Prefix)
-	if prefixLen == 0 {
-		return
-	}
+	now := time.Now().UnixNano()
 	for ; it.indexIter.Valid(); it.indexIter.Next() {
 		key := it.indexIter.Key()
-		//如果key的前缀不是指定的前缀，就跳过
-		if prefixLen <= len(key) && bytes.Compare(it.options.Prefix, key[:prefixLen]) == 0 {
+		//key是有序的，越过了范围之后不会再有满足条件的key
+		if it.pastRange(key) {
+			it.finished = true
+			return
+		}
+		if it.inRange(key) && !it.indexIter.Value().IsExpired(now) {
 			break
 		}
 	}
 }
+
+// inRange 判断key是否在上下界之内并且前缀匹配
+func (it *Iterator) inRange(key []byte) bool {
+	opts := it.options
+	if opts.LowerBound != nil && bytes.Compare(key, opts.LowerBound) < 0 {
+		return false
+	}
+	if opts.UpperBound != nil && bytes.Compare(key, opts.UpperBound) >= 0 {
+		return false
+	}
+	return bytes.HasPrefix(key, opts.Prefix)
+}
+
+// pastRange 判断key是否已经越过了遍历方向上的范围终点
+func (it *Iterator) pastRange(key []byte) bool {
+	opts := it.options
+	if opts.Reverse {
+		if opts.LowerBound != nil && bytes.Compare(key, opts.LowerBound) < 0 {
+			return true
+		}
+		return len(opts.Prefix) > 0 && bytes.Compare(key, opts.Prefix) < 0
+	}
+	if opts.UpperBound != nil && bytes.Compare(key, opts.UpperBound) >= 0 {
+		return true
+	}
+	return len(opts.Prefix) > 0 && bytes.Compare(key, opts.Prefix) > 0 && !bytes.HasPrefix(key, opts.Prefix)
+}
+
+// prefixEnd 获取大于所有以prefix为前缀的key的最小值，不存在时返回nil
+func prefixEnd(prefix []byte) []byte {
+	end := make([]byte, len(prefix))
+	copy(end, prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
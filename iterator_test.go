@@ -1,8 +1,10 @@
 package skv_go
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"os"
+	"skv-go/index"
 	"skv-go/utils"
 	"testing"
 )
@@ -96,3 +98,103 @@ func TestDB_Iterator_Multi_Values(t *testing.T) {
 	}
 	iter3.Close()
 }
+
+func TestDB_Iterator_Prefix(t *testing.T) {
+	for _, indexType := range []index.IndexType{index.BTreeIndex, index.ART} {
+		opts := DefaultOptions
+		dir, _ := os.MkdirTemp("", "test-prefix")
+		opts.DirPath = dir
+		opts.IndexType = indexType
+		db, err := Open(opts)
+		assert.Nil(t, err)
+
+		for _, key := range []string{"a", "b", "b1", "b2", "b\xff", "c", "\xff", "\xff\xff"} {
+			assert.Nil(t, db.Put([]byte(key), []byte(key)))
+		}
+		collect := func(prefix string, reverse bool) []string {
+			iterator := db.NewIterator(IteratorOptions{Prefix: []byte(prefix), Reverse: reverse})
+			defer iterator.Close()
+			var keys []string
+			for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+				keys = append(keys, string(iterator.Key()))
+			}
+			return keys
+		}
+		assert.Equal(t, []string{"b", "b1", "b2", "b\xff"}, collect("b", false))
+		assert.Equal(t, []string{"b\xff", "b2", "b1", "b"}, collect("b", true))
+		assert.Equal(t, []string{"\xff\xff", "\xff"}, collect("\xff", true))
+		assert.Empty(t, collect("d", false))
+		assert.Empty(t, collect("0", true))
+		destroyDB(db)
+	}
+}
+
+func TestDB_Iterator_Bounds(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "test-bounds")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		key := []byte{'k', byte('0' + i)}
+		assert.Nil(t, db.Put(key, key))
+	}
+
+	collect := func(opts IteratorOptions, seek []byte) []string {
+		iterator := db.NewIterator(opts)
+		defer iterator.Close()
+		var keys []string
+		if seek != nil {
+			iterator.Seek(seek)
+		}
+		for ; iterator.Valid(); iterator.Next() {
+			keys = append(keys, string(iterator.Key()))
+		}
+		return keys
+	}
+	bounds := IteratorOptions{LowerBound: []byte("k3"), UpperBound: []byte("k6")}
+	assert.Equal(t, []string{"k3", "k4", "k5"}, collect(bounds, nil))
+	assert.Equal(t, []string{"k3", "k4", "k5"}, collect(bounds, []byte("a")))
+	assert.Equal(t, []string{"k5"}, collect(bounds, []byte("k5")))
+	assert.Empty(t, collect(bounds, []byte("k6")))
+
+	bounds.Reverse = true
+	assert.Equal(t, []string{"k5", "k4", "k3"}, collect(bounds, nil))
+	assert.Equal(t, []string{"k5", "k4", "k3"}, collect(bounds, []byte("z")))
+	assert.Equal(t, []string{"k4", "k3"}, collect(bounds, []byte("k4")))
+	assert.Empty(t, collect(bounds, []byte("k2")))
+
+	// Bounds combine with a prefix
+	assert.Equal(t, []string{"k8", "k9"}, collect(IteratorOptions{Prefix: []byte("k"), LowerBound: []byte("k8")}, nil))
+	assert.Equal(t, []string{"k1", "k0"}, collect(IteratorOptions{Prefix: []byte("k"), UpperBound: []byte("k2"), Reverse: true}, nil))
+}
+
+func TestDB_Scan(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "test-scan")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for i := 100; i < 300; i++ {
+		key := []byte(fmt.Sprintf("user:%d", i))
+		assert.Nil(t, db.Put(key, key))
+	}
+
+	pairs, err := db.Scan([]byte("user:100"), []byte("user:200"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(pairs))
+	assert.Equal(t, []byte("user:100"), pairs[0].Key)
+	assert.Equal(t, []byte("user:199"), pairs[99].Value)
+
+	// Paginate with the last key of the previous page
+	pairs, err = db.Scan([]byte("user:150"), nil, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(pairs))
+	assert.Equal(t, []byte("user:159"), pairs[9].Key)
+
+	pairs, err = db.Scan([]byte("z"), nil, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, pairs)
+}
@@ -0,0 +1,330 @@
+package skv_go
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"skv-go/data"
+	"skv-go/index"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// merge过程中使用的临时目录，位于数据目录下
+	mergeDirName = "merge"
+	// merge完成文件中记录的key
+	mergeFinishedKey  = "merge.finished"
+	mergeFileCountKey = "merge.file.count"
+)
+
+// Merge 清理无效数据，将旧数据文件中仍然有效的记录重写到新的数据文件中
+// merge完成后会替换掉旧的数据文件并更新内存索引
+func (db *DB) Merge() error {
+	//副本的数据文件需要和主节点保持一致
+	if db.readOnly {
+		return ErrReadOnlyReplica
+	}
+	//数据库为空则直接返回
+	if db.activeFile == nil {
+		return nil
+	}
+	db.rw.Lock()
+	//同一时刻只能有一个merge在进行
+	if db.isMerging {
+		db.rw.Unlock()
+		return ErrMergeIsProgress
+	}
+	db.isMerging = true
+	defer func() {
+		db.rw.Lock()
+		db.isMerging = false
+		db.rw.Unlock()
+	}()
+
+	//持久化当前活跃文件，并将其转换为旧文件，之后的写入都会进入新的活跃文件中
+	if err := db.rotateActiveFile(); err != nil {
+		db.rw.Unlock()
+		return err
+	}
+	//记录最近一个没有参与merge的文件id
+	nonMergeFileId := db.activeFile.FileId
+	//参与merge的文件中的无效数据会被清理掉
+	mergedReclaimSize := db.reclaimSize
+
+	//取出所有需要merge的文件
+	var mergeFiles []*data.DataFile
+	for _, file := range db.olderFiles {
+		mergeFiles = append(mergeFiles, file)
+	}
+	db.rw.Unlock()
+
+	//从小到大依次merge
+	sort.Slice(mergeFiles, func(i, j int) bool {
+		return mergeFiles[i].FileId < mergeFiles[j].FileId
+	})
+
+	mergePath := db.getMergePath()
+	//如果目录存在，说明之前发生过merge，将其删除
+	if _, err := os.Stat(mergePath); err == nil {
+		if err := os.RemoveAll(mergePath); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(mergePath, os.ModePerm); err != nil {
+		return err
+	}
+
+	//打开一个新的临时实例用于写入merge后的数据
+	mergeOptions := db.options
+	mergeOptions.DirPath = mergePath
+	mergeOptions.SyncWrite = false
+	mergeOptions.IndexType = index.BTreeIndex
+	mergeOptions.ExpireSweepInterval = 0
+	mergeDB, err := Open(mergeOptions)
+	if err != nil {
+		return err
+	}
+
+	//已经过期的数据不再重写，merge完成后从索引中删除
+	now := time.Now().UnixNano()
+	expiredKeys := make(map[string]*data.LogRecordPos)
+	//遍历处理每个数据文件
+	for _, dataFile := range mergeFiles {
+		offset := dataFile.HeaderSize
+		for {
+			logRecord, size, err := dataFile.Read(offset)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				_ = mergeDB.Close()
+				return err
+			}
+			//和内存中的索引位置进行比较，如果一致则说明是有效的数据，进行重写
+			logRecordPos := db.index.Get(logRecord.Key)
+			if logRecord.Type == data.LogRecordNormal && logRecordPos != nil &&
+				logRecordPos.Fid == dataFile.FileId && logRecordPos.Offset == offset {
+				if logRecordPos.IsExpired(now) {
+					expiredKeys[string(logRecord.Key)] = logRecordPos
+					offset += size
+					continue
+				}
+				//事务已经提交，重写时不再需要事务序列号
+				logRecord.SeqNo = nonTransactionSeqNo
+				if _, err := mergeDB.appendLogRecordWithLock(logRecord); err != nil {
+					_ = mergeDB.Close()
+					return err
+				}
+			}
+			offset += size
+		}
+	}
+
+	//持久化merge后的数据文件，并为最后一个文件写入hint文件
+	var mergeFileCount uint32 = 0
+	if mergeDB.activeFile != nil {
+		if err := mergeDB.activeFile.Sync(); err != nil {
+			_ = mergeDB.Close()
+			return err
+		}
+		if err := mergeDB.writeActiveHintFile(); err != nil {
+			_ = mergeDB.Close()
+			return err
+		}
+		mergeFileCount = mergeDB.activeFile.FileId + 1
+	}
+	if err := mergeDB.Close(); err != nil {
+		return err
+	}
+	//merge后的文件使用0开始的id，数量超过被替换的文件时会覆盖没有参与merge的文件，
+	//开启加密、关闭压缩或者为旧文件加上头部都可能使数据变大
+	if mergeFileCount > nonMergeFileId {
+		if err := os.RemoveAll(mergePath); err != nil {
+			return err
+		}
+		return ErrMergeTooLarge
+	}
+
+	//写入标识merge完成的文件，有了这个文件才说明merge的数据是完整的
+	if err := writeMergeFinishedFile(mergePath, nonMergeFileId, mergeFileCount); err != nil {
+		return err
+	}
+
+	//用merge后的文件替换掉旧的数据文件
+	db.rw.Lock()
+	defer db.rw.Unlock()
+	db.mergeCount++
+	db.notifyAppend()
+	for _, dataFile := range mergeFiles {
+		delete(db.olderFiles, dataFile.FileId)
+		if err := db.retireDataFile(dataFile); err != nil {
+			return err
+		}
+	}
+	if _, _, err := db.applyMergeFiles(); err != nil {
+		return err
+	}
+	for fileId := uint32(0); fileId < mergeFileCount; fileId++ {
+		dataFile, err := db.openDataFile(fileId, db.olderFilesIOType())
+		if err != nil {
+			return err
+		}
+		db.olderFiles[fileId] = dataFile
+	}
+	//过期的key没有被重写，索引仍然指向被替换的文件时将其删除
+	for key, expiredPos := range expiredKeys {
+		pos := db.index.Get([]byte(key))
+		if pos != nil && pos.Fid == expiredPos.Fid && pos.Offset == expiredPos.Offset {
+			db.index.Delete([]byte(key))
+		}
+	}
+	//更新内存索引，只有索引仍然指向参与merge的文件时才需要更新
+	if err := db.loadIndexFromMergedFiles(nonMergeFileId, mergeFileCount); err != nil {
+		return err
+	}
+	db.reclaimSize -= mergedReclaimSize
+	//磁盘索引持久化之后才能删除merge目录，否则崩溃后无法再修正索引
+	if persistentIndex, ok := db.index.(index.PersistentIndexer); ok {
+		if err := persistentIndex.Sync(); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(mergePath)
+}
+
+// getMergePath 获取merge临时目录的路径
+func (db *DB) getMergePath() string {
+	return filepath.Join(db.options.DirPath, mergeDirName)
+}
+
+// applyMergeFiles 将merge目录中的数据文件移动到数据目录中，并删除被替换掉的旧数据文件，
+// 返回merge时第一个没有参与merge的文件id以及merge后的文件数量，没有完成的merge返回的文件数量为-1。
+// 该操作是幂等的，中途崩溃后再次执行可以继续完成，merge目录需要在索引更新完成后由调用方删除
+func (db *DB) applyMergeFiles() (uint32, int, error) {
+	mergePath := db.getMergePath()
+	if _, err := os.Stat(mergePath); os.IsNotExist(err) {
+		return 0, -1, nil
+	}
+	nonMergeFileId, mergeFileCount, err := readMergeFinishedFile(mergePath)
+	if err != nil {
+		return 0, -1, err
+	}
+	//没有merge完成的标识，说明merge没有完成，直接丢弃；文件数量过多的merge会覆盖没有参与merge的文件，同样丢弃
+	if mergeFileCount < 0 || uint32(mergeFileCount) > nonMergeFileId {
+		return 0, -1, os.RemoveAll(mergePath)
+	}
+
+	//先删除旧文件的hint文件，避免数据文件被替换后与hint文件不一致
+	for fileId := uint32(0); fileId < nonMergeFileId; fileId++ {
+		fileName := data.GetHintFileName(db.options.DirPath, fileId)
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return 0, -1, err
+		}
+	}
+
+	dirEntries, err := os.ReadDir(mergePath)
+	if err != nil {
+		return 0, -1, err
+	}
+	//将merge后的数据文件和hint文件移动到数据目录中，覆盖同名的旧文件，数据文件总是先于hint文件移动
+	for _, entry := range dirEntries {
+		if !strings.HasSuffix(entry.Name(), data.DataFileSuffix) &&
+			!strings.HasSuffix(entry.Name(), data.HintFileSuffix) {
+			continue
+		}
+		srcPath := filepath.Join(mergePath, entry.Name())
+		destPath := filepath.Join(db.options.DirPath, entry.Name())
+		if err := os.Rename(srcPath, destPath); err != nil {
+			return 0, -1, err
+		}
+	}
+	//删除剩余的已经merge过的旧数据文件
+	for fileId := uint32(mergeFileCount); fileId < nonMergeFileId; fileId++ {
+		fileName := data.GetDataFileName(db.options.DirPath, fileId)
+		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+			return 0, -1, err
+		}
+	}
+	return nonMergeFileId, mergeFileCount, nil
+}
+
+// loadIndexFromMergedFiles 根据merge后的hint文件更新内存索引
+func (db *DB) loadIndexFromMergedFiles(nonMergeFileId uint32, mergeFileCount uint32) error {
+	for fileId := uint32(0); fileId < mergeFileCount; fileId++ {
+		err := db.readIndexRecords(db.olderFiles[fileId], func(logRecord *data.LogRecord, pos *data.LogRecordPos) {
+			//索引已经指向更新的文件，说明merge期间有新的写入或删除，不需要更新
+			oldPos := db.index.Get(logRecord.Key)
+			if oldPos != nil && oldPos.Fid < nonMergeFileId {
+				db.index.Put(logRecord.Key, pos)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMergeFinishedFile 写入merge完成的标识文件
+func writeMergeFinishedFile(mergePath string, nonMergeFileId uint32, mergeFileCount uint32) error {
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(mergePath)
+	if err != nil {
+		return err
+	}
+	records := []*data.LogRecord{
+		{Key: []byte(mergeFinishedKey), Value: []byte(strconv.Itoa(int(nonMergeFileId)))},
+		{Key: []byte(mergeFileCountKey), Value: []byte(strconv.Itoa(int(mergeFileCount)))},
+	}
+	for _, record := range records {
+		encRecord, _ := data.EncodeLogRecord(record)
+		if err := mergeFinishedFile.Write(encRecord); err != nil {
+			_ = mergeFinishedFile.Close()
+			return err
+		}
+	}
+	if err := mergeFinishedFile.Sync(); err != nil {
+		_ = mergeFinishedFile.Close()
+		return err
+	}
+	return mergeFinishedFile.Close()
+}
+
+// readMergeFinishedFile 读取merge完成的标识文件，没有完成时返回的文件数量为-1
+func readMergeFinishedFile(mergePath string) (uint32, int, error) {
+	if _, err := os.Stat(filepath.Join(mergePath, data.MergeFinishedFileName)); os.IsNotExist(err) {
+		return 0, -1, nil
+	}
+	mergeFinishedFile, err := data.OpenMergeFinishedFile(mergePath)
+	if err != nil {
+		return 0, -1, err
+	}
+	defer mergeFinishedFile.Close()
+
+	values := make(map[string]int)
+	var offset int64 = 0
+	for {
+		logRecord, size, err := mergeFinishedFile.Read(offset)
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			//标识文件不完整，同样认为merge没有完成
+			return 0, -1, nil
+		}
+		value, err := strconv.Atoi(string(logRecord.Value))
+		if err != nil {
+			return 0, -1, err
+		}
+		values[string(logRecord.Key)] = value
+		offset += size
+	}
+	nonMergeFileId, ok1 := values[mergeFinishedKey]
+	mergeFileCount, ok2 := values[mergeFileCountKey]
+	if !ok1 || !ok2 {
+		return 0, -1, nil
+	}
+	return uint32(nonMergeFileId), mergeFileCount, nil
+}
@@ -0,0 +1,260 @@
+package skv_go
+
+import (
+	"os"
+	"path/filepath"
+	"skv-go/data"
+	"skv-go/fio"
+	"skv-go/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Merge_Empty(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	// Merge an empty db
+	err = db.Merge()
+	assert.NoError(t, err)
+}
+
+func TestDB_Merge_StaleData(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 5000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	// Overwrite and delete some of the records
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), []byte("new-value")))
+	}
+	for i := 4000; i < 5000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+	sizeBefore := dirSize(t, dir)
+
+	err = db.Merge()
+	assert.NoError(t, err)
+	assert.Less(t, dirSize(t, dir), sizeBefore)
+	_, err = os.Stat(filepath.Join(dir, mergeDirName))
+	assert.True(t, os.IsNotExist(err))
+
+	// Check the data after merge
+	assert.Equal(t, 4000, len(db.ListKeys()))
+	for i := 0; i < 2000; i++ {
+		value, err := db.Get(utils.GetTestKey(i))
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("new-value"), value)
+	}
+	for i := 4000; i < 5000; i++ {
+		_, err := db.Get(utils.GetTestKey(i))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+
+	// Write after merge and restart
+	assert.NoError(t, db.Put(utils.GetTestKey(4500), []byte("after-merge")))
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 4001, len(db.ListKeys()))
+	value, err := db.Get(utils.GetTestKey(4500))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("after-merge"), value)
+	value, err = db.Get(utils.GetTestKey(1))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new-value"), value)
+}
+
+func TestDB_Merge_AllDeleted(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.NoError(t, db.Merge())
+	assert.Equal(t, 0, len(db.ListKeys()))
+
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(db.ListKeys()))
+}
+
+func TestDB_Merge_Expired(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.PutWithTTL(utils.GetTestKey(i), utils.RandomValue(20), time.Millisecond))
+	}
+	for i := 1000; i < 1100; i++ {
+		assert.NoError(t, db.PutWithTTL(utils.GetTestKey(i), utils.RandomValue(20), time.Hour))
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.NoError(t, db.Merge())
+	assert.Equal(t, 100, db.index.Size())
+
+	// Expired records are not rewritten
+	var records int
+	db.rw.RLock()
+	for fileId, dataFile := range db.olderFiles {
+		_, err := db.readDataFile(dataFile, func(logRecord *data.LogRecord, _ *data.LogRecordPos) {
+			records++
+		})
+		assert.NoError(t, err, fileId)
+	}
+	db.rw.RUnlock()
+	assert.Equal(t, 100, records)
+
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, len(db.ListKeys()))
+	_, err = db.Get(utils.GetTestKey(0))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_Merge_Unfinished(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+
+	db, err := Open(options)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("Hello"), []byte("world")))
+	assert.NoError(t, db.Close())
+
+	// Simulate a crash during merge, the merge dir has no finished file
+	mergePath := filepath.Join(dir, mergeDirName)
+	assert.NoError(t, os.MkdirAll(mergePath, os.ModePerm))
+	dataFile, err := data.OpenDataFile(mergePath, 0, fio.StandardFIO)
+	assert.NoError(t, err)
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: []byte("Hello"), Value: []byte("stale")})
+	assert.NoError(t, dataFile.Write(encRecord))
+	assert.NoError(t, dataFile.Close())
+
+	db, err = Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	_, err = os.Stat(mergePath)
+	assert.True(t, os.IsNotExist(err))
+	value, err := db.Get([]byte("Hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), value)
+}
+
+func TestDB_Merge_FinishedBeforeSwap(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+
+	db, err := Open(options)
+	assert.NoError(t, err)
+	for i := 0; i < 3000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.RandomValue(20)))
+	}
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+	assert.NoError(t, db.Close())
+
+	// Simulate a crash after the merge finished file was written but before the swap
+	mergePath := filepath.Join(dir, mergeDirName)
+	assert.NoError(t, os.MkdirAll(mergePath, os.ModePerm))
+	dataFile, err := data.OpenDataFile(mergePath, 0, fio.StandardFIO)
+	assert.NoError(t, err)
+	for i := 1000; i < 3000; i++ {
+		encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: utils.GetTestKey(i), Value: []byte("merged")})
+		assert.NoError(t, dataFile.Write(encRecord))
+	}
+	assert.NoError(t, dataFile.Close())
+	assert.NoError(t, writeMergeFinishedFile(mergePath, db.activeFile.FileId+1, 1))
+
+	db, err = Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	_, err = os.Stat(mergePath)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 2000, len(db.ListKeys()))
+	value, err := db.Get(utils.GetTestKey(2000))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("merged"), value)
+}
+
+func dirSize(t *testing.T, dir string) int64 {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return size
+}
+
+func TestDB_Merge_TooLarge(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 1024
+
+	db, err := Open(options)
+	assert.NoError(t, err)
+	for i := 0; i < 200; i++ {
+		assert.NoError(t, db.Put([]byte{'k', byte(i)}, []byte("value")))
+	}
+	assert.NoError(t, db.Close())
+
+	// Encrypting the plain records during merge makes every record larger
+	options.EncryptionKey = []byte("0123456789abcdef")
+	db, err = Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrMergeTooLarge, db.Merge())
+	_, err = os.Stat(filepath.Join(dir, mergeDirName))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, len(db.ListKeys()))
+	value, err := db.Get([]byte{'k', 199})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
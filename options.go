@@ -2,7 +2,9 @@ package skv_go
 
 import (
 	"os"
+	"skv-go/data"
 	"skv-go/index"
+	"time"
 )
 
 type Options struct {
@@ -14,6 +16,22 @@ type Options struct {
 	SyncWrite bool
 	//索引类型
 	IndexType index.IndexType
+	//启动时是否使用内存文件映射加载数据文件
+	MMapAtStartup bool
+	//旧数据文件是否使用内存文件映射读取
+	MMapOlderFiles bool
+	//后台清理过期key的间隔，为0表示不进行后台清理，过期的key仍然会被视为不存在
+	ExpireSweepInterval time.Duration
+	//启动时活跃文件末尾的记录损坏是否直接截断，为false时打开数据库会返回错误，文件中间的记录损坏时总是返回错误
+	TruncateCorruptedTail bool
+	//value的压缩算法，只影响之后写入的数据，已有的数据在merge时使用新的算法重写
+	Compression data.CompressionType
+	//加密key和value使用的AES密钥，长度为16，24或32字节，为空表示不加密。
+	//打开已经加密的数据时必须提供相同的密钥，未加密的旧数据仍然可以读取。
+	//B+树索引会以明文在磁盘上保存key，不能和加密一起使用
+	EncryptionKey []byte
+	//轮换之前使用过的密钥，只用于解密，merge会使用当前密钥重新加密所有数据
+	PreviousEncryptionKeys [][]byte
 }
 
 // IteratorOptions 迭代器配置项
@@ -22,16 +40,63 @@ type IteratorOptions struct {
 	Prefix []byte
 	//是否反向遍历，默认false为正向的
 	Reverse bool
+	//遍历范围的下界，包含该key，为nil表示没有下界
+	LowerBound []byte
+	//遍历范围的上界，不包含该key，为nil表示没有上界
+	UpperBound []byte
+}
+
+// WriteBatchOptions 批量写配置项
+type WriteBatchOptions struct {
+	//一个批次中最大的数据量
+	MaxBatchNum uint
+	//提交时是否持久化
+	SyncWrites bool
+}
+
+// WatchOptions 监听配置项
+type WatchOptions struct {
+	//尚未发送给消费者的事件数量上限，超过之后监听会被关闭
+	BufferSize int
+	//从该位置之后的记录开始重放数据文件，再继续发送新的事件，为nil表示只接收新的事件。
+	//Size为0时从Offset处开始读取，Offset为0表示从文件的第一条记录开始
+	From *data.LogRecordPos
+}
+
+// ReplicaOptions 副本配置项
+type ReplicaOptions struct {
+	//主节点复制服务的地址
+	PrimaryAddr string
+	//连接断开之后重新连接的间隔
+	ReconnectInterval time.Duration
 }
 
 var DefaultOptions = Options{
-	DirPath:      os.TempDir(),
-	DataFileSize: 256 * 1024 * 1024,
-	SyncWrite:    false,
-	IndexType:    index.BTreeIndex,
+	DirPath:               os.TempDir(),
+	DataFileSize:          256 * 1024 * 1024,
+	SyncWrite:             false,
+	IndexType:             index.BTreeIndex,
+	MMapAtStartup:         false,
+	MMapOlderFiles:        false,
+	ExpireSweepInterval:   time.Second,
+	TruncateCorruptedTail: true,
+	Compression:           data.NoCompression,
 }
 
 var DefaultIteratorOptions = IteratorOptions{
 	Prefix:  nil,
 	Reverse: false,
 }
+
+var DefaultWatchOptions = WatchOptions{
+	BufferSize: 1024,
+}
+
+var DefaultReplicaOptions = ReplicaOptions{
+	ReconnectInterval: time.Second,
+}
+
+var DefaultWriteBatchOptions = WriteBatchOptions{
+	MaxBatchNum: 10000,
+	SyncWrites:  true,
+}
@@ -0,0 +1,80 @@
+package skv_go
+
+import (
+	"bytes"
+	"skv-go/data"
+)
+
+// DeleteRange 删除[start, end)范围内的所有key，end为nil表示直到末尾。
+// 无论范围内有多少key，都只会写入一条范围删除记录
+func (db *DB) DeleteRange(start, end []byte) error {
+	if len(start) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if end != nil && bytes.Compare(start, end) >= 0 {
+		return nil
+	}
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	//范围内没有数据时不需要写入
+	keys := db.indexKeysInRange(start, end)
+	if len(keys) == 0 {
+		return nil
+	}
+	logRecord := &data.LogRecord{
+		Key:   start,
+		Value: end,
+		Type:  data.LogRecordRangeDelete,
+	}
+	pos, err := db.appendLogRecord(logRecord)
+	if err != nil {
+		return err
+	}
+	db.reclaimSize += int64(pos.Size)
+	db.deleteIndexKeys(keys)
+	db.emitEvent(logRecord, pos)
+	return nil
+}
+
+// DeletePrefix 删除所有以prefix为前缀的key
+func (db *DB) DeletePrefix(prefix []byte) error {
+	if len(prefix) == 0 {
+		return ErrKeyIsEmpty
+	}
+	return db.DeleteRange(prefix, prefixEnd(prefix))
+}
+
+// deleteIndexRange 从索引中删除[start, end)范围内的所有key，end为空表示直到末尾，
+// 用于重放范围删除记录，使用该方法需要加锁
+func (db *DB) deleteIndexRange(start, end []byte) {
+	if len(end) == 0 {
+		end = nil
+	}
+	db.deleteIndexKeys(db.indexKeysInRange(start, end))
+}
+
+// indexKeysInRange 获取索引中[start, end)范围内的所有key，包括已经过期的key
+func (db *DB) indexKeysInRange(start, end []byte) [][]byte {
+	iterator := db.index.Iterator(false)
+	defer iterator.Close()
+	var keys [][]byte
+	for iterator.Seek(start); iterator.Valid(); iterator.Next() {
+		key := iterator.Key()
+		if end != nil && bytes.Compare(key, end) >= 0 {
+			break
+		}
+		keys = append(keys, append([]byte(nil), key...))
+	}
+	return keys
+}
+
+// deleteIndexKeys 从索引中删除key，被删除的数据都是无效数据
+func (db *DB) deleteIndexKeys(keys [][]byte) {
+	for _, key := range keys {
+		if oldPos := db.index.Get(key); oldPos != nil {
+			db.reclaimSize += int64(oldPos.Size)
+		}
+		db.index.Delete(key)
+	}
+}
@@ -0,0 +1,88 @@
+package skv_go
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_DeleteRange(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-delete-range")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for _, key := range []string{"a", "b", "b1", "c", "tenant:1:x", "tenant:1:y", "tenant:2:x", "z"} {
+		assert.NoError(t, db.Put([]byte(key), []byte(key)))
+	}
+	assert.Equal(t, ErrKeyIsEmpty, db.DeleteRange(nil, []byte("b")))
+	assert.Equal(t, ErrKeyIsEmpty, db.DeletePrefix(nil))
+
+	assert.NoError(t, db.DeleteRange([]byte("b"), []byte("c")))
+	assert.NoError(t, db.DeletePrefix([]byte("tenant:1:")))
+	// Empty and reversed ranges do nothing
+	assert.NoError(t, db.DeleteRange([]byte("c"), []byte("a")))
+	assert.NoError(t, db.DeletePrefix([]byte("none")))
+	// Writes after the range delete stay visible
+	assert.NoError(t, db.Put([]byte("b1"), []byte("again")))
+
+	expected := [][]byte{[]byte("a"), []byte("b1"), []byte("c"), []byte("tenant:2:x"), []byte("z")}
+	assert.Equal(t, expected, db.ListKeys())
+
+	// Replaying the data files gives the same result
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, db.ListKeys())
+	value, err := db.Get([]byte("b1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("again"), value)
+
+	// An open ended range
+	assert.NoError(t, db.DeleteRange([]byte("tenant:"), nil))
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b1"), []byte("c")}, db.ListKeys())
+}
+
+func TestDB_DeleteRange_HintFile(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-delete-range-hint")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 1024
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		key := []byte{'k', byte(i)}
+		assert.NoError(t, db.Put(key, key))
+	}
+	assert.NoError(t, db.DeletePrefix([]byte("k")))
+	assert.NoError(t, db.Put([]byte{'k', 1}, []byte("new")))
+	// Fill the active file so the range delete ends up in an older file with a hint file
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, db.Put([]byte{'z', byte(i)}, []byte("value")))
+	}
+	stat, err := db.Stat()
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 101, len(db.ListKeys()))
+	value, err := db.Get([]byte{'k', 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), value)
+	reopenStat, err := db.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, stat.ReclaimableSize, reopenStat.ReclaimableSize)
+
+	// Merge drops the covered records and the range delete itself
+	assert.NoError(t, db.Merge())
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 101, len(db.ListKeys()))
+}
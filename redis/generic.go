@@ -0,0 +1,125 @@
+package redis
+
+import (
+	skv "skv-go"
+	"time"
+)
+
+// Del 删除一个数据结构，只删除元数据，旧的子key会在Reclaim时清理
+func (ds *DataStructure) Del(key []byte) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	return ds.db.Delete(encodeMetaKey(key))
+}
+
+// Type 获取数据结构的类型，key不存在时返回ErrKeyNotFound
+func (ds *DataStructure) Type(key []byte) (DataType, error) {
+	md, err := ds.getMetadata(key)
+	if err != nil {
+		return 0, err
+	}
+	if md == nil {
+		return 0, skv.ErrKeyNotFound
+	}
+	return md.dataType, nil
+}
+
+// Expire 设置数据结构的过期时间，ttl为0表示取消过期时间
+func (ds *DataStructure) Expire(key []byte, ttl time.Duration) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	md, err := ds.getMetadata(key)
+	if err != nil {
+		return err
+	}
+	if md == nil {
+		return skv.ErrKeyNotFound
+	}
+	md.expire = 0
+	if ttl > 0 {
+		md.expire = time.Now().Add(ttl).UnixNano()
+	}
+	return ds.db.Put(encodeMetaKey(key), md.encode())
+}
+
+// Reclaim 清理已经删除或者过期的数据结构留下的子key以及过期的元数据，返回清理的key数量
+func (ds *DataStructure) Reclaim() (int, error) {
+	//记录每个key当前有效的版本号，0表示已经不存在
+	versions := make(map[string]uint64)
+	var staleKeys [][]byte
+	err := ds.scanSubKeys([]byte{subKeyPrefix}, func(subKey []byte, _ []byte) (bool, error) {
+		key, version, ok := decodeSubKey(subKey)
+		if !ok {
+			return true, nil
+		}
+		currentVersion, ok := versions[string(key)]
+		if !ok {
+			md, err := ds.getMetadata(key)
+			if err != nil {
+				return false, err
+			}
+			if md != nil {
+				currentVersion = md.version
+			}
+			versions[string(key)] = currentVersion
+		}
+		if version != currentVersion {
+			staleKeys = append(staleKeys, subKey)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	//过期的元数据
+	now := time.Now().UnixNano()
+	err = ds.scanSubKeys([]byte{metaKeyPrefix}, func(metaKey []byte, value []byte) (bool, error) {
+		if decodeMetadata(value).isExpired(now) {
+			staleKeys = append(staleKeys, metaKey)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	var reclaimed int
+	for _, staleKey := range staleKeys {
+		//扫描之后数据结构可能被重新创建，删除前需要再次确认
+		stale, err := ds.isStale(staleKey, now)
+		if err != nil {
+			return reclaimed, err
+		}
+		if !stale {
+			continue
+		}
+		if err := ds.db.Delete(staleKey); err != nil {
+			return reclaimed, err
+		}
+		reclaimed++
+	}
+	return reclaimed, nil
+}
+
+// isStale 判断子key或者元数据是否已经失效
+func (ds *DataStructure) isStale(staleKey []byte, now int64) (bool, error) {
+	if staleKey[0] == metaKeyPrefix {
+		value, err := ds.db.Get(staleKey)
+		if err == skv.ErrKeyNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return decodeMetadata(value).isExpired(now), nil
+	}
+	key, version, _ := decodeSubKey(staleKey)
+	md, err := ds.getMetadata(key)
+	if err != nil {
+		return false, err
+	}
+	return md == nil || md.version != version, nil
+}
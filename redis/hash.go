@@ -0,0 +1,101 @@
+package redis
+
+import skv "skv-go"
+
+// HSet 设置哈希表中字段的值，返回字段是否是新增的
+func (ds *DataStructure) HSet(key, field, value []byte) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findOrNewMetadata(key, Hash)
+	if err != nil {
+		return false, err
+	}
+	subKey := encodeSubKey(key, md.version, field)
+	exist, err := ds.subKeyExists(md, subKey)
+	if err != nil {
+		return false, err
+	}
+
+	wb := ds.db.NewWriteBatch(ds.batchOptions)
+	//新增字段时需要更新元数据中的数量
+	if !exist {
+		md.size++
+		_ = wb.Put(encodeMetaKey(key), md.encode())
+	}
+	_ = wb.Put(subKey, value)
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return !exist, nil
+}
+
+// HGet 获取哈希表中字段的值，字段不存在时返回ErrKeyNotFound
+func (ds *DataStructure) HGet(key, field []byte) ([]byte, error) {
+	md, err := ds.findMetadata(key, Hash)
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		return nil, skv.ErrKeyNotFound
+	}
+	return ds.db.Get(encodeSubKey(key, md.version, field))
+}
+
+// HDel 删除哈希表中的字段，返回字段是否存在
+func (ds *DataStructure) HDel(key, field []byte) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findMetadata(key, Hash)
+	if err != nil || md == nil {
+		return false, err
+	}
+	subKey := encodeSubKey(key, md.version, field)
+	exist, err := ds.subKeyExists(md, subKey)
+	if err != nil || !exist {
+		return false, err
+	}
+	return true, ds.removeSubKeys(key, md, subKey)
+}
+
+// HLen 获取哈希表中字段的数量
+func (ds *DataStructure) HLen(key []byte) (uint64, error) {
+	return ds.size(key, Hash)
+}
+
+// subKeyExists 判断子key是否存在
+func (ds *DataStructure) subKeyExists(md *metadata, subKey []byte) (bool, error) {
+	if md.size == 0 {
+		return false, nil
+	}
+	_, err := ds.db.Get(subKey)
+	if err == skv.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// removeSubKeys 删除一个元素对应的子key并更新元数据，元素全部删除后同时删除元数据
+func (ds *DataStructure) removeSubKeys(key []byte, md *metadata, subKeys ...[]byte) error {
+	wb := ds.db.NewWriteBatch(ds.batchOptions)
+	md.size--
+	if md.size == 0 {
+		_ = wb.Delete(encodeMetaKey(key))
+	} else {
+		_ = wb.Put(encodeMetaKey(key), md.encode())
+	}
+	for _, subKey := range subKeys {
+		_ = wb.Delete(subKey)
+	}
+	return wb.Commit()
+}
+
+// size 获取数据结构中元素的数量，key不存在时返回0
+func (ds *DataStructure) size(key []byte, dataType DataType) (uint64, error) {
+	md, err := ds.findMetadata(key, dataType)
+	if err != nil || md == nil {
+		return 0, err
+	}
+	return md.size, nil
+}
@@ -0,0 +1,46 @@
+package redis
+
+import (
+	skv "skv-go"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataStructure_Hash(t *testing.T) {
+	ds, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	added, err := ds.HSet([]byte("hash"), []byte("f1"), []byte("v1"))
+	assert.NoError(t, err)
+	assert.True(t, added)
+	added, err = ds.HSet([]byte("hash"), []byte("f1"), []byte("v2"))
+	assert.NoError(t, err)
+	assert.False(t, added)
+	added, err = ds.HSet([]byte("hash"), []byte("f2"), []byte("v3"))
+	assert.NoError(t, err)
+	assert.True(t, added)
+
+	value, err := ds.HGet([]byte("hash"), []byte("f1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	_, err = ds.HGet([]byte("hash"), []byte("missing"))
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+	size, err := ds.HLen([]byte("hash"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), size)
+
+	deleted, err := ds.HDel([]byte("hash"), []byte("f1"))
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = ds.HDel([]byte("hash"), []byte("f1"))
+	assert.NoError(t, err)
+	assert.False(t, deleted)
+
+	// The hash disappears with its last field
+	deleted, err = ds.HDel([]byte("hash"), []byte("f2"))
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	_, err = ds.Type([]byte("hash"))
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+}
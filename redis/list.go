@@ -0,0 +1,93 @@
+package redis
+
+import (
+	"encoding/binary"
+	skv "skv-go"
+)
+
+// LPush 在列表头部插入元素，返回插入后列表的长度
+func (ds *DataStructure) LPush(key, element []byte) (uint64, error) {
+	return ds.push(key, element, true)
+}
+
+// RPush 在列表尾部插入元素，返回插入后列表的长度
+func (ds *DataStructure) RPush(key, element []byte) (uint64, error) {
+	return ds.push(key, element, false)
+}
+
+// LPop 弹出列表头部的元素，列表为空时返回ErrKeyNotFound
+func (ds *DataStructure) LPop(key []byte) ([]byte, error) {
+	return ds.pop(key, true)
+}
+
+// RPop 弹出列表尾部的元素，列表为空时返回ErrKeyNotFound
+func (ds *DataStructure) RPop(key []byte) ([]byte, error) {
+	return ds.pop(key, false)
+}
+
+// LLen 获取列表的长度
+func (ds *DataStructure) LLen(key []byte) (uint64, error) {
+	return ds.size(key, List)
+}
+
+func (ds *DataStructure) push(key, element []byte, isLeft bool) (uint64, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findOrNewMetadata(key, List)
+	if err != nil {
+		return 0, err
+	}
+	var index uint64
+	if isLeft {
+		md.head--
+		index = md.head
+	} else {
+		index = md.tail
+		md.tail++
+	}
+	md.size++
+
+	wb := ds.db.NewWriteBatch(ds.batchOptions)
+	_ = wb.Put(encodeMetaKey(key), md.encode())
+	_ = wb.Put(encodeListSubKey(key, md.version, index), element)
+	if err := wb.Commit(); err != nil {
+		return 0, err
+	}
+	return md.size, nil
+}
+
+func (ds *DataStructure) pop(key []byte, isLeft bool) ([]byte, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findMetadata(key, List)
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		return nil, skv.ErrKeyNotFound
+	}
+	var index uint64
+	if isLeft {
+		index = md.head
+		md.head++
+	} else {
+		md.tail--
+		index = md.tail
+	}
+	subKey := encodeListSubKey(key, md.version, index)
+	element, err := ds.db.Get(subKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := ds.removeSubKeys(key, md, subKey); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+// encodeListSubKey 编码列表元素的子key，使用元素的位置作为字段
+func encodeListSubKey(key []byte, version uint64, index uint64) []byte {
+	return binary.BigEndian.AppendUint64(encodeSubKeyPrefix(key, version), index)
+}
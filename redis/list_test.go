@@ -0,0 +1,41 @@
+package redis
+
+import (
+	skv "skv-go"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataStructure_List(t *testing.T) {
+	ds, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	_, err := ds.LPop([]byte("list"))
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+
+	size, err := ds.LPush([]byte("list"), []byte("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), size)
+	_, err = ds.LPush([]byte("list"), []byte("a"))
+	assert.NoError(t, err)
+	size, err = ds.RPush([]byte("list"), []byte("c"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), size)
+
+	element, err := ds.LPop([]byte("list"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), element)
+	element, err = ds.RPop([]byte("list"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("c"), element)
+	size, err = ds.LLen([]byte("list"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), size)
+	element, err = ds.RPop([]byte("list"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), element)
+
+	_, err = ds.RPop([]byte("list"))
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+}
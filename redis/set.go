@@ -0,0 +1,69 @@
+package redis
+
+// SAdd 向集合中添加成员，返回成员是否是新增的
+func (ds *DataStructure) SAdd(key, member []byte) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findOrNewMetadata(key, Set)
+	if err != nil {
+		return false, err
+	}
+	subKey := encodeSubKey(key, md.version, member)
+	exist, err := ds.subKeyExists(md, subKey)
+	if err != nil || exist {
+		return false, err
+	}
+
+	md.size++
+	wb := ds.db.NewWriteBatch(ds.batchOptions)
+	_ = wb.Put(encodeMetaKey(key), md.encode())
+	_ = wb.Put(subKey, nil)
+	return true, wb.Commit()
+}
+
+// SIsMember 判断成员是否在集合中
+func (ds *DataStructure) SIsMember(key, member []byte) (bool, error) {
+	md, err := ds.findMetadata(key, Set)
+	if err != nil || md == nil {
+		return false, err
+	}
+	return ds.subKeyExists(md, encodeSubKey(key, md.version, member))
+}
+
+// SRem 从集合中删除成员，返回成员是否存在
+func (ds *DataStructure) SRem(key, member []byte) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findMetadata(key, Set)
+	if err != nil || md == nil {
+		return false, err
+	}
+	subKey := encodeSubKey(key, md.version, member)
+	exist, err := ds.subKeyExists(md, subKey)
+	if err != nil || !exist {
+		return false, err
+	}
+	return true, ds.removeSubKeys(key, md, subKey)
+}
+
+// SMembers 获取集合中的所有成员，按字节序排列
+func (ds *DataStructure) SMembers(key []byte) ([][]byte, error) {
+	md, err := ds.findMetadata(key, Set)
+	if err != nil || md == nil {
+		return nil, err
+	}
+	prefix := encodeSubKeyPrefix(key, md.version)
+	members := make([][]byte, 0, md.size)
+	err = ds.scanSubKeys(prefix, func(subKey []byte, _ []byte) (bool, error) {
+		members = append(members, subKey[len(prefix):])
+		return true, nil
+	})
+	return members, err
+}
+
+// SCard 获取集合中成员的数量
+func (ds *DataStructure) SCard(key []byte) (uint64, error) {
+	return ds.size(key, Set)
+}
@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataStructure_Set(t *testing.T) {
+	ds, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	for _, member := range []string{"b", "a", "c", "a"} {
+		_, err := ds.SAdd([]byte("set"), []byte(member))
+		assert.NoError(t, err)
+	}
+	card, err := ds.SCard([]byte("set"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), card)
+	members, err := ds.SMembers([]byte("set"))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c")}, members)
+
+	ok, err := ds.SIsMember([]byte("set"), []byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	removed, err := ds.SRem([]byte("set"), []byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	ok, err = ds.SIsMember([]byte("set"), []byte("a"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	removed, err = ds.SRem([]byte("set"), []byte("a"))
+	assert.NoError(t, err)
+	assert.False(t, removed)
+
+	members, err = ds.SMembers([]byte("missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+}
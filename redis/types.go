@@ -0,0 +1,209 @@
+package redis
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	skv "skv-go"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrWrongTypeOperation = errors.New("WRONGTYPE operation against a key holding the wrong kind of value")
+
+type DataType = byte
+
+const (
+	Hash DataType = iota + 1
+	Set
+	List
+	ZSet
+)
+
+const (
+	// 元数据的key前缀
+	metaKeyPrefix = 'm'
+	// 数据结构中各个元素的key前缀
+	subKeyPrefix = 's'
+	// 列表的初始位置，位于uint64的中间，保证两端都可以插入
+	initialListIndex = math.MaxUint64 / 2
+)
+
+// DataStructure 基于DB实现的redis数据结构
+// 每个数据结构都有一条元数据，元素保存在带有版本号的子key中，
+// 删除数据结构时只需要删除元数据，旧版本的子key在Reclaim时清理。
+// 使用的DB中所有的key都需要由DataStructure管理，不能和普通的key混用
+type DataStructure struct {
+	db *skv.DB
+	//写操作需要先读取元数据再写入，加锁保证并发安全
+	mu *sync.Mutex
+	//最近分配的版本号
+	version *atomic.Uint64
+	//写入元数据和子key时使用的批量写配置
+	batchOptions skv.WriteBatchOptions
+}
+
+// NewDataStructure 创建redis数据结构
+func NewDataStructure(db *skv.DB) *DataStructure {
+	version := new(atomic.Uint64)
+	//使用当前时间初始化，重启之后分配的版本号仍然比之前的大
+	version.Store(uint64(time.Now().UnixNano()))
+	batchOptions := skv.DefaultWriteBatchOptions
+	batchOptions.SyncWrites = false
+	return &DataStructure{
+		db:           db,
+		mu:           new(sync.Mutex),
+		version:      version,
+		batchOptions: batchOptions,
+	}
+}
+
+// metadata 数据结构的元数据
+type metadata struct {
+	dataType DataType
+	//过期时间，单位为纳秒的unix时间戳，为0表示永不过期
+	expire  int64
+	version uint64
+	size    uint64
+	//列表的头尾位置，元素位于[head, tail)中
+	head uint64
+	tail uint64
+}
+
+// encode 编码元数据，由type，expire，version，size以及列表特有的head，tail组成
+func (md *metadata) encode() []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64*5)
+	buf[0] = md.dataType
+	buf = binary.AppendVarint(buf, md.expire)
+	buf = binary.AppendUvarint(buf, md.version)
+	buf = binary.AppendUvarint(buf, md.size)
+	if md.dataType == List {
+		buf = binary.AppendUvarint(buf, md.head)
+		buf = binary.AppendUvarint(buf, md.tail)
+	}
+	return buf
+}
+
+// decodeMetadata 解码元数据
+func decodeMetadata(buf []byte) *metadata {
+	md := &metadata{dataType: buf[0]}
+	var index = 1
+	var n int
+	md.expire, n = binary.Varint(buf[index:])
+	index += n
+	md.version, n = binary.Uvarint(buf[index:])
+	index += n
+	md.size, n = binary.Uvarint(buf[index:])
+	index += n
+	if md.dataType == List {
+		md.head, n = binary.Uvarint(buf[index:])
+		index += n
+		md.tail, _ = binary.Uvarint(buf[index:])
+	}
+	return md
+}
+
+// isExpired 判断元数据是否已经过期
+func (md *metadata) isExpired(now int64) bool {
+	return md.expire != 0 && md.expire <= now
+}
+
+// encodeMetaKey 编码元数据的key
+func encodeMetaKey(key []byte) []byte {
+	buf := make([]byte, 1+len(key))
+	buf[0] = metaKeyPrefix
+	copy(buf[1:], key)
+	return buf
+}
+
+// encodeSubKeyPrefix 编码子key的前缀，由前缀标识，key的长度，key以及版本号组成，
+// 同一个版本的数据结构中所有元素的子key都具有相同的前缀
+func encodeSubKeyPrefix(key []byte, version uint64) []byte {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen32+len(key)+8)
+	buf = append(buf, subKeyPrefix)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	return binary.BigEndian.AppendUint64(buf, version)
+}
+
+// encodeSubKey 编码子key
+func encodeSubKey(key []byte, version uint64, field []byte) []byte {
+	return append(encodeSubKeyPrefix(key, version), field...)
+}
+
+// decodeSubKey 从子key中解析出key和版本号
+func decodeSubKey(subKey []byte) ([]byte, uint64, bool) {
+	if len(subKey) == 0 || subKey[0] != subKeyPrefix {
+		return nil, 0, false
+	}
+	keySize, n := binary.Uvarint(subKey[1:])
+	index := 1 + n
+	if n <= 0 || uint64(len(subKey)-index) < keySize+8 {
+		return nil, 0, false
+	}
+	key := subKey[index : index+int(keySize)]
+	index += int(keySize)
+	return key, binary.BigEndian.Uint64(subKey[index:]), true
+}
+
+// getMetadata 获取key对应的元数据，不存在或者已经过期时返回nil
+func (ds *DataStructure) getMetadata(key []byte) (*metadata, error) {
+	value, err := ds.db.Get(encodeMetaKey(key))
+	if err == skv.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	md := decodeMetadata(value)
+	if md.isExpired(time.Now().UnixNano()) {
+		return nil, nil
+	}
+	return md, nil
+}
+
+// findMetadata 获取key对应的元数据并校验类型，不存在时返回nil
+func (ds *DataStructure) findMetadata(key []byte, dataType DataType) (*metadata, error) {
+	md, err := ds.getMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+	if md != nil && md.dataType != dataType {
+		return nil, ErrWrongTypeOperation
+	}
+	return md, nil
+}
+
+// findOrNewMetadata 获取key对应的元数据，不存在时使用新的版本号创建
+func (ds *DataStructure) findOrNewMetadata(key []byte, dataType DataType) (*metadata, error) {
+	md, err := ds.findMetadata(key, dataType)
+	if err != nil || md != nil {
+		return md, err
+	}
+	md = &metadata{dataType: dataType, version: ds.version.Add(1)}
+	if dataType == List {
+		md.head = initialListIndex
+		md.tail = initialListIndex
+	}
+	return md, nil
+}
+
+// scanSubKeys 按顺序遍历指定前缀的子key，fn返回false时停止遍历
+func (ds *DataStructure) scanSubKeys(prefix []byte, fn func(subKey []byte, value []byte) (bool, error)) error {
+	options := skv.DefaultIteratorOptions
+	options.Prefix = prefix
+	iter := ds.db.NewIterator(options)
+	defer iter.Close()
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		next, err := fn(iter.Key(), value)
+		if err != nil || !next {
+			return err
+		}
+	}
+	return nil
+}
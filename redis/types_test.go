@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"bytes"
+	"math"
+	"os"
+	skv "skv-go"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDataStructure(t *testing.T) (*DataStructure, func()) {
+	dir, _ := os.MkdirTemp("", "test-redis")
+	options := skv.DefaultOptions
+	options.DirPath = dir
+	db, err := skv.Open(options)
+	assert.NoError(t, err)
+	return NewDataStructure(db), func() {
+		assert.NoError(t, db.Close())
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestMetadata_EncodeDecode(t *testing.T) {
+	md := &metadata{dataType: Hash, expire: time.Now().UnixNano(), version: 10, size: 3}
+	assert.Equal(t, md, decodeMetadata(md.encode()))
+
+	md = &metadata{dataType: List, version: 11, size: 2, head: initialListIndex - 1, tail: initialListIndex + 1}
+	assert.Equal(t, md, decodeMetadata(md.encode()))
+}
+
+func TestSubKey_EncodeDecode(t *testing.T) {
+	subKey := encodeSubKey([]byte("key"), 42, []byte("field"))
+	key, version, ok := decodeSubKey(subKey)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("key"), key)
+	assert.Equal(t, uint64(42), version)
+
+	// The key length is encoded, so a key can not be a prefix of another one
+	assert.False(t, bytes.HasPrefix(encodeSubKey([]byte("key2"), 42, nil), encodeSubKeyPrefix([]byte("key"), 42)))
+
+	_, _, ok = decodeSubKey([]byte("mkey"))
+	assert.False(t, ok)
+	_, _, ok = decodeSubKey([]byte{subKeyPrefix, 10, 'a'})
+	assert.False(t, ok)
+}
+
+func TestScore_Order(t *testing.T) {
+	scores := []float64{3.5, -1, 0, math.Inf(1), -100.25, 1e10, math.Inf(-1), 2}
+	encoded := make([][]byte, len(scores))
+	for i, score := range scores {
+		encoded[i] = encodeScore(score)
+		assert.Equal(t, score, decodeScore(encoded[i]))
+	}
+	sort.Float64s(scores)
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	for i, score := range scores {
+		assert.Equal(t, score, decodeScore(encoded[i]))
+	}
+}
+
+func TestDataStructure_DelAndType(t *testing.T) {
+	ds, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	_, err := ds.Type([]byte("hash"))
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+	_, err = ds.HSet([]byte("hash"), []byte("f1"), []byte("v1"))
+	assert.NoError(t, err)
+	dataType, err := ds.Type([]byte("hash"))
+	assert.NoError(t, err)
+	assert.Equal(t, Hash, dataType)
+
+	// Operations on the wrong type are rejected
+	_, err = ds.SAdd([]byte("hash"), []byte("m1"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+
+	// Deleting is a single metadata delete, recreating starts from an empty structure
+	assert.NoError(t, ds.Del([]byte("hash")))
+	_, err = ds.HGet([]byte("hash"), []byte("f1"))
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+	added, err := ds.SAdd([]byte("hash"), []byte("m1"))
+	assert.NoError(t, err)
+	assert.True(t, added)
+}
+
+func TestDataStructure_Expire(t *testing.T) {
+	ds, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	assert.Equal(t, skv.ErrKeyNotFound, ds.Expire([]byte("set"), time.Second))
+	_, err := ds.SAdd([]byte("set"), []byte("m1"))
+	assert.NoError(t, err)
+	assert.NoError(t, ds.Expire([]byte("set"), 20*time.Millisecond))
+	time.Sleep(40 * time.Millisecond)
+
+	ok, err := ds.SIsMember([]byte("set"), []byte("m1"))
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	card, err := ds.SCard([]byte("set"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0), card)
+}
+
+func TestDataStructure_Reclaim(t *testing.T) {
+	ds, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	for i := 0; i < 100; i++ {
+		_, err := ds.RPush([]byte("list"), []byte("element"))
+		assert.NoError(t, err)
+	}
+	_, err := ds.HSet([]byte("hash"), []byte("f1"), []byte("v1"))
+	assert.NoError(t, err)
+	_, err = ds.ZAdd([]byte("zset"), 1, []byte("m1"))
+	assert.NoError(t, err)
+	assert.NoError(t, ds.Expire([]byte("zset"), time.Millisecond))
+	assert.NoError(t, ds.Del([]byte("list")))
+	time.Sleep(5 * time.Millisecond)
+
+	// 100 list elements, 2 zset sub keys and the expired zset metadata
+	reclaimed, err := ds.Reclaim()
+	assert.NoError(t, err)
+	assert.Equal(t, 103, reclaimed)
+	assert.Equal(t, 2, len(ds.db.ListKeys()))
+	value, err := ds.HGet([]byte("hash"), []byte("f1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v1"), value)
+
+	reclaimed, err = ds.Reclaim()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, reclaimed)
+}
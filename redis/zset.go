@@ -0,0 +1,173 @@
+package redis
+
+import (
+	"encoding/binary"
+	"math"
+	skv "skv-go"
+)
+
+// 有序集合中的两类子key：成员到分数的映射，以及按分数排序的索引
+const (
+	zsetMemberTag byte = iota
+	zsetScoreTag
+)
+
+// ZAdd 向有序集合中添加成员或者更新成员的分数，返回成员是否是新增的
+func (ds *DataStructure) ZAdd(key []byte, score float64, member []byte) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findOrNewMetadata(key, ZSet)
+	if err != nil {
+		return false, err
+	}
+	memberKey := encodeZSetMemberKey(key, md.version, member)
+	oldScore, exist, err := ds.zscore(md, memberKey)
+	if err != nil {
+		return false, err
+	}
+	if exist && oldScore == score {
+		return false, nil
+	}
+
+	wb := ds.db.NewWriteBatch(ds.batchOptions)
+	if exist {
+		_ = wb.Delete(encodeZSetScoreKey(key, md.version, oldScore, member))
+	} else {
+		md.size++
+		_ = wb.Put(encodeMetaKey(key), md.encode())
+	}
+	_ = wb.Put(memberKey, encodeScore(score))
+	_ = wb.Put(encodeZSetScoreKey(key, md.version, score, member), nil)
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	return !exist, nil
+}
+
+// ZScore 获取成员的分数，成员不存在时返回ErrKeyNotFound
+func (ds *DataStructure) ZScore(key []byte, member []byte) (float64, error) {
+	md, err := ds.findMetadata(key, ZSet)
+	if err != nil {
+		return 0, err
+	}
+	if md == nil {
+		return 0, skv.ErrKeyNotFound
+	}
+	score, exist, err := ds.zscore(md, encodeZSetMemberKey(key, md.version, member))
+	if err != nil {
+		return 0, err
+	}
+	if !exist {
+		return 0, skv.ErrKeyNotFound
+	}
+	return score, nil
+}
+
+// ZRem 从有序集合中删除成员，返回成员是否存在
+func (ds *DataStructure) ZRem(key []byte, member []byte) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	md, err := ds.findMetadata(key, ZSet)
+	if err != nil || md == nil {
+		return false, err
+	}
+	memberKey := encodeZSetMemberKey(key, md.version, member)
+	score, exist, err := ds.zscore(md, memberKey)
+	if err != nil || !exist {
+		return false, err
+	}
+	return true, ds.removeSubKeys(key, md, memberKey, encodeZSetScoreKey(key, md.version, score, member))
+}
+
+// ZRange 按分数从小到大获取排名在[start, stop]之间的成员，负数表示从末尾开始计算的排名
+func (ds *DataStructure) ZRange(key []byte, start, stop int) ([][]byte, error) {
+	md, err := ds.findMetadata(key, ZSet)
+	if err != nil || md == nil {
+		return nil, err
+	}
+	size := int(md.size)
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop {
+		return nil, nil
+	}
+
+	prefix := append(encodeSubKeyPrefix(key, md.version), zsetScoreTag)
+	members := make([][]byte, 0, stop-start+1)
+	var rank int
+	err = ds.scanSubKeys(prefix, func(subKey []byte, _ []byte) (bool, error) {
+		if rank >= start {
+			members = append(members, subKey[len(prefix)+8:])
+		}
+		rank++
+		return rank <= stop, nil
+	})
+	return members, err
+}
+
+// ZCard 获取有序集合中成员的数量
+func (ds *DataStructure) ZCard(key []byte) (uint64, error) {
+	return ds.size(key, ZSet)
+}
+
+// zscore 读取成员的分数
+func (ds *DataStructure) zscore(md *metadata, memberKey []byte) (float64, bool, error) {
+	if md.size == 0 {
+		return 0, false, nil
+	}
+	value, err := ds.db.Get(memberKey)
+	if err == skv.ErrKeyNotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return decodeScore(value), true, nil
+}
+
+// encodeZSetMemberKey 编码成员到分数的子key
+func encodeZSetMemberKey(key []byte, version uint64, member []byte) []byte {
+	subKey := append(encodeSubKeyPrefix(key, version), zsetMemberTag)
+	return append(subKey, member...)
+}
+
+// encodeZSetScoreKey 编码按分数排序的子key，分数在前，保证按字节序遍历时就是按分数排序
+func encodeZSetScoreKey(key []byte, version uint64, score float64, member []byte) []byte {
+	subKey := append(encodeSubKeyPrefix(key, version), zsetScoreTag)
+	subKey = append(subKey, encodeScore(score)...)
+	return append(subKey, member...)
+}
+
+// encodeScore 将分数编码为字节序与数值大小一致的8个字节
+func encodeScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return binary.BigEndian.AppendUint64(nil, bits)
+}
+
+// decodeScore 解码分数
+func decodeScore(buf []byte) float64 {
+	bits := binary.BigEndian.Uint64(buf)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	skv "skv-go"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataStructure_ZSet(t *testing.T) {
+	ds, cleanup := newTestDataStructure(t)
+	defer cleanup()
+
+	added, err := ds.ZAdd([]byte("zset"), 3, []byte("c"))
+	assert.NoError(t, err)
+	assert.True(t, added)
+	_, err = ds.ZAdd([]byte("zset"), -1.5, []byte("a"))
+	assert.NoError(t, err)
+	_, err = ds.ZAdd([]byte("zset"), 2, []byte("b"))
+	assert.NoError(t, err)
+	// Updating the score moves the member
+	added, err = ds.ZAdd([]byte("zset"), 10, []byte("a"))
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	score, err := ds.ZScore([]byte("zset"), []byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, float64(10), score)
+	_, err = ds.ZScore([]byte("zset"), []byte("missing"))
+	assert.Equal(t, skv.ErrKeyNotFound, err)
+	card, err := ds.ZCard([]byte("zset"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), card)
+
+	members, err := ds.ZRange([]byte("zset"), 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c"), []byte("a")}, members)
+	members, err = ds.ZRange([]byte("zset"), 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("c")}, members)
+	members, err = ds.ZRange([]byte("zset"), -2, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("a")}, members)
+	members, err = ds.ZRange([]byte("zset"), 2, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, members)
+
+	removed, err := ds.ZRem([]byte("zset"), []byte("c"))
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	members, err = ds.ZRange([]byte("zset"), 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("a")}, members)
+}
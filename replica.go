@@ -0,0 +1,309 @@
+package skv_go
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"skv-go/data"
+	"skv-go/fio"
+	"skv-go/index"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Replica 只读副本，从主节点复制数据文件并持续应用新追加的记录，连接断开后会从最后应用的位置重新连接
+type Replica struct {
+	db      *DB
+	options ReplicaOptions
+
+	mu     *sync.Mutex
+	conn   net.Conn
+	status ReplicaStatus
+	closed bool
+	done   chan struct{}
+	wg     *sync.WaitGroup
+}
+
+// ReplicaStatus 副本的复制状态
+type ReplicaStatus struct {
+	//是否连接到了主节点
+	Connected bool
+	//最后应用的位置，也就是活跃文件的id和写入偏移量
+	Fid    uint32
+	Offset int64
+	//最近一次从主节点收到数据时落后的字节数和记录数
+	LagBytes   int64
+	LagRecords int64
+}
+
+// OpenReplica 打开一个副本，副本的数据库拒绝所有写入，数据目录中已有的数据会和主节点比较，不一致时重新同步
+func OpenReplica(options Options, replicaOptions ReplicaOptions) (*Replica, error) {
+	if replicaOptions.PrimaryAddr == "" {
+		return nil, ErrPrimaryAddrIsEmpty
+	}
+	if replicaOptions.ReconnectInterval <= 0 {
+		replicaOptions.ReconnectInterval = DefaultReplicaOptions.ReconnectInterval
+	}
+	db, err := open(options, true)
+	if err != nil {
+		return nil, err
+	}
+	if db.replicaTxnRecords == nil {
+		db.replicaTxnRecords = make(map[uint64][]*txnRecord)
+	}
+	r := &Replica{
+		db:      db,
+		options: replicaOptions,
+		mu:      new(sync.Mutex),
+		done:    make(chan struct{}),
+		wg:      new(sync.WaitGroup),
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+// DB 获取副本的数据库，可以正常读取，写入会返回ErrReadOnlyReplica
+func (r *Replica) DB() *DB {
+	return r.db
+}
+
+// Status 获取副本的复制状态
+func (r *Replica) Status() ReplicaStatus {
+	r.mu.Lock()
+	status := r.status
+	r.mu.Unlock()
+
+	r.db.rw.RLock()
+	defer r.db.rw.RUnlock()
+	end := r.db.replicationEnd()
+	status.Fid, status.Offset = end.Fid, end.Offset
+	return status
+}
+
+// Close 停止复制并关闭副本的数据库
+func (r *Replica) Close() error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.done)
+		if r.conn != nil {
+			_ = r.conn.Close()
+		}
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return r.db.Close()
+}
+
+// run 连接主节点进行复制，连接断开后等待一段时间再重新连接
+func (r *Replica) run() {
+	defer r.wg.Done()
+	for {
+		err := r.replicate()
+		r.mu.Lock()
+		r.conn = nil
+		r.status.Connected = false
+		closed := r.closed
+		r.mu.Unlock()
+		if closed {
+			return
+		}
+		log.Printf("replica: replication from %s stopped: %v", r.options.PrimaryAddr, err)
+		select {
+		case <-r.done:
+			return
+		case <-time.After(r.options.ReconnectInterval):
+		}
+	}
+}
+
+// replicate 连接主节点并应用收到的数据，直到连接断开
+func (r *Replica) replicate() error {
+	conn, err := net.DialTimeout("tcp", r.options.PrimaryAddr, r.options.ReconnectInterval)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return net.ErrClosed
+	}
+	r.conn = conn
+	r.mu.Unlock()
+
+	manifest, err := r.db.replicaManifest()
+	if err != nil {
+		return err
+	}
+	if err := writeReplicaManifest(conn, manifest); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.status.Connected = true
+	r.mu.Unlock()
+
+	reader := bufio.NewReader(conn)
+	for {
+		//主节点空闲时会定期发送心跳，长时间没有收到数据说明连接已经失效
+		if err := conn.SetReadDeadline(time.Now().Add(3 * replicationHeartbeatInterval)); err != nil {
+			return err
+		}
+		frame, err := readReplicationFrame(reader)
+		if err != nil {
+			return err
+		}
+		switch frame.typ {
+		case frameReset:
+			err = r.db.resetReplica()
+		case frameFile:
+			err = r.db.applyReplicaFile(frame.fid, frame.payload)
+		case frameData:
+			err = r.db.applyReplicaData(frame.fid, frame.offset, frame.payload)
+		}
+		if err != nil {
+			return err
+		}
+		r.mu.Lock()
+		r.status.LagBytes = frame.lagBytes
+		r.status.LagRecords = frame.lagRecords
+		r.mu.Unlock()
+	}
+}
+
+// replicaManifest 获取副本中所有数据文件的信息，按文件id从小到大排列
+func (db *DB) replicaManifest() ([]replicaFileInfo, error) {
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+	var manifest []replicaFileInfo
+	for _, dataFile := range db.dataFiles() {
+		size, err := db.dataFileSize(dataFile)
+		if err != nil {
+			return nil, err
+		}
+		manifest = append(manifest, replicaFileInfo{fid: dataFile.FileId, createdAt: dataFile.CreatedAt, size: size})
+	}
+	sort.Slice(manifest, func(i, j int) bool { return manifest[i].fid < manifest[j].fid })
+	return manifest, nil
+}
+
+// resetReplica 删除副本中所有的数据文件和索引，之后从头开始复制
+func (db *DB) resetReplica() error {
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	for _, dataFile := range db.dataFiles() {
+		if err := db.retireDataFile(dataFile); err != nil {
+			return err
+		}
+	}
+	db.activeFile = nil
+	db.olderFiles = make(map[uint32]*data.DataFile)
+	fileIds, err := getDataFileIds(db.options.DirPath)
+	if err != nil {
+		return err
+	}
+	for _, fileId := range fileIds {
+		if err := os.Remove(data.GetDataFileName(db.options.DirPath, fileId)); err != nil {
+			return err
+		}
+		if err := os.Remove(data.GetHintFileName(db.options.DirPath, fileId)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	//重新创建一个空的索引
+	if err := db.index.Close(); err != nil {
+		return err
+	}
+	for _, name := range []string{index.BPlusTreeIndexFileName, seqNoFileName} {
+		if err := os.Remove(filepath.Join(db.options.DirPath, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	indexer, err := index.NewIndexer(db.options.IndexType, db.options.DirPath, db.options.SyncWrite)
+	if err != nil {
+		return err
+	}
+	db.index = indexer
+	db.activeHints = nil
+	db.seqNo = nonTransactionSeqNo
+	db.reclaimSize = 0
+	db.expireKeys = newExpireKeys()
+	db.replicaTxnRecords = make(map[uint64][]*txnRecord)
+	return nil
+}
+
+// applyReplicaFile 创建主节点的下一个数据文件，原来的活跃文件转换为旧文件
+func (db *DB) applyReplicaFile(fid uint32, header []byte) error {
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	if db.activeFile != nil {
+		if fid <= db.activeFile.FileId {
+			return ErrReplicationProtocol
+		}
+		if err := db.retireActiveFile(); err != nil {
+			return err
+		}
+		db.activeFile = nil
+	}
+	//使用主节点的文件头部，保证两边文件中记录的偏移量一致
+	fileName := data.GetDataFileName(db.options.DirPath, fid)
+	if err := os.WriteFile(fileName, header, fio.DataFilePerm); err != nil {
+		return err
+	}
+	dataFile, err := db.openDataFile(fid, fio.StandardFIO)
+	if err != nil {
+		return err
+	}
+	if dataFile.HeaderSize != int64(len(header)) {
+		_ = dataFile.Close()
+		return ErrReplicationProtocol
+	}
+	db.activeFile = dataFile
+	return nil
+}
+
+// applyReplicaData 将主节点发送的记录追加到活跃文件中，并更新索引
+func (db *DB) applyReplicaData(fid uint32, offset int64, payload []byte) error {
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	if db.activeFile == nil || db.activeFile.FileId != fid || db.activeFile.WriteOff != offset {
+		return ErrReplicationProtocol
+	}
+	if err := db.activeFile.Write(payload); err != nil {
+		return err
+	}
+	//先校验所有的记录，有损坏的记录时丢弃整帧数据，重新连接后从原来的位置继续复制
+	var logRecords []*data.LogRecord
+	var positions []*data.LogRecordPos
+	for off := offset; off < db.activeFile.WriteOff; {
+		logRecord, size, err := db.activeFile.Read(off)
+		if err != nil {
+			if truncateErr := db.activeFile.Truncate(offset); truncateErr != nil {
+				return truncateErr
+			}
+			return errors.Join(ErrReplicationProtocol, err)
+		}
+		logRecords = append(logRecords, logRecord)
+		positions = append(positions, &data.LogRecordPos{Fid: fid, Offset: off, Size: uint32(size), Expire: logRecord.Expire})
+		off += size
+	}
+	if db.options.SyncWrite {
+		if err := db.activeFile.Sync(); err != nil {
+			return err
+		}
+	}
+	for i, logRecord := range logRecords {
+		db.replayLogRecord(logRecord, positions[i], db.replicaTxnRecords)
+		db.activeHints = append(db.activeHints, data.EncodeHintRecord(logRecord, positions[i], db.cipher)...)
+	}
+	return nil
+}
@@ -0,0 +1,572 @@
+package skv_go
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"skv-go/data"
+	"skv-go/fio"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 复制协议，副本连接主节点后先发送自己已有的数据文件：
+// magic count 然后是count个 fid createdAt size
+// 4 + 4 + count * (4 + 8 + 8)
+// 主节点根据这些信息决定从哪里继续复制，之后持续发送帧：
+// type fid offset records lagBytes lagRecords length payload
+// 1 + 4 + 8 + 4 + 8 + 8 + 4 + length
+const (
+	replicationMagic         = "SKVR"
+	replicationFrameHeadSize = 1 + 4 + 8 + 4 + 8 + 8 + 4
+	// 每一帧中记录的大小上限，单条记录超过上限时单独作为一帧
+	maxReplicationBatchSize = 1 << 20
+	// 主节点没有新数据时发送心跳的间隔，副本超过三个间隔没有收到帧时会重新连接
+	replicationHeartbeatInterval = time.Second
+	maxReplicationManifestSize   = 1 << 20
+	maxReplicationPayloadSize    = 1 << 30
+)
+
+type replicationFrameType = byte
+
+const (
+	// 副本的数据文件和主节点不一致，需要删除所有数据重新同步
+	frameReset replicationFrameType = iota
+	// 创建一个新的数据文件，payload为主节点数据文件的头部
+	frameFile
+	// 追加到数据文件中的完整记录
+	frameData
+	// 没有新数据时的心跳
+	frameHeartbeat
+)
+
+type replicationFrame struct {
+	typ     replicationFrameType
+	fid     uint32
+	offset  int64
+	records uint32
+	//发送该帧之后副本仍然落后的字节数和记录数
+	lagBytes   int64
+	lagRecords int64
+	payload    []byte
+}
+
+func writeReplicationFrame(w io.Writer, frame *replicationFrame) error {
+	buf := make([]byte, replicationFrameHeadSize)
+	buf[0] = frame.typ
+	binary.LittleEndian.PutUint32(buf[1:], frame.fid)
+	binary.LittleEndian.PutUint64(buf[5:], uint64(frame.offset))
+	binary.LittleEndian.PutUint32(buf[13:], frame.records)
+	binary.LittleEndian.PutUint64(buf[17:], uint64(frame.lagBytes))
+	binary.LittleEndian.PutUint64(buf[25:], uint64(frame.lagRecords))
+	binary.LittleEndian.PutUint32(buf[33:], uint32(len(frame.payload)))
+	if _, err := w.Write(buf); err != nil {
+		return err
+	}
+	_, err := w.Write(frame.payload)
+	return err
+}
+
+func readReplicationFrame(r io.Reader) (*replicationFrame, error) {
+	buf := make([]byte, replicationFrameHeadSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	frame := &replicationFrame{
+		typ:        buf[0],
+		fid:        binary.LittleEndian.Uint32(buf[1:]),
+		offset:     int64(binary.LittleEndian.Uint64(buf[5:])),
+		records:    binary.LittleEndian.Uint32(buf[13:]),
+		lagBytes:   int64(binary.LittleEndian.Uint64(buf[17:])),
+		lagRecords: int64(binary.LittleEndian.Uint64(buf[25:])),
+	}
+	length := binary.LittleEndian.Uint32(buf[33:])
+	if frame.typ > frameHeartbeat || length > maxReplicationPayloadSize {
+		return nil, ErrReplicationProtocol
+	}
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// replicaFileInfo 副本中的一个数据文件
+type replicaFileInfo struct {
+	fid       uint32
+	createdAt int64
+	size      int64
+}
+
+func writeReplicaManifest(w io.Writer, files []replicaFileInfo) error {
+	buf := make([]byte, 8+len(files)*20)
+	copy(buf, replicationMagic)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(files)))
+	for i, file := range files {
+		entry := buf[8+i*20:]
+		binary.LittleEndian.PutUint32(entry, file.fid)
+		binary.LittleEndian.PutUint64(entry[4:], uint64(file.createdAt))
+		binary.LittleEndian.PutUint64(entry[12:], uint64(file.size))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readReplicaManifest(r io.Reader) ([]replicaFileInfo, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	count := binary.LittleEndian.Uint32(buf[4:])
+	if string(buf[:4]) != replicationMagic || count > maxReplicationManifestSize {
+		return nil, ErrReplicationProtocol
+	}
+	buf = make([]byte, count*20)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	files := make([]replicaFileInfo, count)
+	for i := range files {
+		entry := buf[i*20:]
+		files[i] = replicaFileInfo{
+			fid:       binary.LittleEndian.Uint32(entry),
+			createdAt: int64(binary.LittleEndian.Uint64(entry[4:])),
+			size:      int64(binary.LittleEndian.Uint64(entry[12:])),
+		}
+	}
+	return files, nil
+}
+
+// ReplicationServer 主节点的复制服务，将数据文件发送给连接上来的副本，之后持续发送新追加的记录。
+// 数据文件按字节原样复制，副本需要使用相同的密钥，没有头部的旧数据文件需要先升级。
+// 主节点merge之后正在复制的连接会断开，副本重新连接时会完整地重新同步
+type ReplicationServer struct {
+	db *DB
+
+	mu        *sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	done      chan struct{}
+	wg        *sync.WaitGroup
+}
+
+// NewReplicationServer 创建一个复制服务，需要在关闭数据库之前关闭
+func NewReplicationServer(db *DB) *ReplicationServer {
+	return &ReplicationServer{
+		db:        db,
+		mu:        new(sync.Mutex),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		done:      make(chan struct{}),
+		wg:        new(sync.WaitGroup),
+	}
+}
+
+// ListenAndServe 监听指定地址并处理副本的连接
+func (s *ReplicationServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve 在指定的listener上接受副本的连接，每个连接使用单独的协程处理，直到listener关闭
+func (s *ReplicationServer) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return ErrReplicationClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, listener)
+			s.mu.Unlock()
+			if closed {
+				return ErrReplicationClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrReplicationClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+// Close 关闭所有的listener和连接，并等待正在处理的连接退出
+func (s *ReplicationServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	for listener := range s.listeners {
+		_ = listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *ReplicationServer) handleConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+		s.wg.Done()
+	}()
+
+	manifest, err := readReplicaManifest(bufio.NewReader(conn))
+	if err != nil {
+		if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+			log.Printf("replication: failed to read handshake from %s: %v", conn.RemoteAddr(), err)
+		}
+		return
+	}
+	stream := &replicationStream{db: s.db, w: bufio.NewWriter(conn), done: s.done}
+	if err := stream.run(manifest); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("replication: stopped streaming to %s: %v", conn.RemoteAddr(), err)
+	}
+}
+
+// replicationStream 向一个副本发送数据文件
+type replicationStream struct {
+	db   *DB
+	w    *bufio.Writer
+	done chan struct{}
+	//下一个要发送的位置，opened为false表示副本还没有创建文件id不小于fid的下一个数据文件
+	fid    uint32
+	offset int64
+	opened bool
+	//连接时的merge次数，merge之后需要断开连接
+	mergeCount uint64
+	//连接时尚未发送的记录数，连接时已经追加的记录数，以及已经发送的记录数
+	backlog     int64
+	appendCount int64
+	sent        int64
+}
+
+var errPrimaryMerged = errors.New("the primary has merged its data files")
+
+func (st *replicationStream) run(manifest []replicaFileInfo) error {
+	db := st.db
+	db.rw.RLock()
+	reset := st.start(manifest)
+	end := db.replicationEnd()
+	st.mergeCount = db.mergeCount
+	st.appendCount = db.appendCount
+	db.rw.RUnlock()
+
+	if reset {
+		if err := st.send(&replicationFrame{typ: frameReset}); err != nil {
+			return err
+		}
+	}
+	backlog, err := st.countBacklog(end)
+	if err != nil {
+		return err
+	}
+	st.backlog = backlog
+
+	heartbeat := time.NewTicker(replicationHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		frame, err := st.nextFrame()
+		if err != nil {
+			return err
+		}
+		if frame != nil {
+			if err := st.send(frame); err != nil {
+				return err
+			}
+			continue
+		}
+		//已经发送了所有的数据，等待新的记录追加
+		db.rw.Lock()
+		var notify <-chan struct{}
+		if db.mergeCount == st.mergeCount && st.caughtUp() {
+			if db.appendNotify == nil {
+				db.appendNotify = make(chan struct{})
+			}
+			notify = db.appendNotify
+		}
+		db.rw.Unlock()
+		if notify == nil {
+			continue
+		}
+		select {
+		case <-notify:
+		case <-heartbeat.C:
+			if err := st.send(&replicationFrame{typ: frameHeartbeat}); err != nil {
+				return err
+			}
+		case <-st.done:
+			return nil
+		}
+	}
+}
+
+// start 比较副本中的数据文件，确定开始复制的位置，返回副本是否需要重新同步，使用该方法需要加锁
+func (st *replicationStream) start(manifest []replicaFileInfo) bool {
+	if len(manifest) == 0 {
+		return false
+	}
+	dataFiles := st.db.dataFiles()
+	exists := make(map[uint32]bool, len(manifest))
+	last := manifest[len(manifest)-1]
+	for i, info := range manifest {
+		dataFile := dataFiles[info.fid]
+		if dataFile == nil || dataFile.HeaderSize == 0 || dataFile.CreatedAt != info.createdAt {
+			return true
+		}
+		size, err := st.db.dataFileSize(dataFile)
+		//副本的旧文件必须完整，活跃文件不能比主节点的更长
+		if err != nil || size < info.size || (i < len(manifest)-1 && size != info.size) {
+			return true
+		}
+		exists[info.fid] = true
+	}
+	for fid := range dataFiles {
+		if fid < last.fid && !exists[fid] {
+			return true
+		}
+	}
+	st.fid, st.offset, st.opened = last.fid, last.size, true
+	return false
+}
+
+// countBacklog 统计从开始复制的位置到连接时数据末尾之间的记录数，
+// 只解析记录的头部，并且读取的是单独打开的文件，统计时不需要持有数据库的锁
+func (st *replicationStream) countBacklog(end data.LogRecordPos) (int64, error) {
+	dataFiles, err := st.openBacklogFiles(end)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		for _, dataFile := range dataFiles {
+			_ = dataFile.Close()
+		}
+	}()
+
+	var count int64
+	for _, dataFile := range dataFiles {
+		offset := dataFile.HeaderSize
+		if st.opened && dataFile.FileId == st.fid {
+			offset = st.offset
+		}
+		for dataFile.FileId != end.Fid || offset < end.Offset {
+			size, err := dataFile.ReadRecordSize(offset)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, err
+			}
+			offset += size
+			count++
+		}
+	}
+	return count, nil
+}
+
+// openBacklogFiles 重新打开开始复制的位置到连接时数据末尾之间的数据文件，按文件id从小到大排列。
+// 打开之后merge删除或者替换原来的文件，已经打开的文件仍然可以读取
+func (st *replicationStream) openBacklogFiles(end data.LogRecordPos) ([]*data.DataFile, error) {
+	db := st.db
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+	if db.mergeCount != st.mergeCount {
+		return nil, errPrimaryMerged
+	}
+	var fileIds []uint32
+	for fileId := range db.dataFiles() {
+		if fileId >= st.fid && fileId <= end.Fid {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	sort.Slice(fileIds, func(i, j int) bool { return fileIds[i] < fileIds[j] })
+
+	var dataFiles []*data.DataFile
+	for _, fileId := range fileIds {
+		dataFile, err := data.OpenDataFile(db.options.DirPath, fileId, fio.StandardFIO)
+		if err != nil {
+			for _, opened := range dataFiles {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		dataFiles = append(dataFiles, dataFile)
+	}
+	return dataFiles, nil
+}
+
+// nextFrame 读取下一帧要发送的数据，已经发送了所有数据时返回nil
+func (st *replicationStream) nextFrame() (*replicationFrame, error) {
+	db := st.db
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+	if db.mergeCount != st.mergeCount {
+		return nil, errPrimaryMerged
+	}
+	for {
+		if !st.opened {
+			dataFile := db.nextDataFile(st.fid)
+			if dataFile == nil {
+				return nil, nil
+			}
+			if dataFile.HeaderSize == 0 {
+				return nil, ErrLegacyDataFile
+			}
+			header := make([]byte, dataFile.HeaderSize)
+			if _, err := dataFile.IOManager.Read(header, 0); err != nil {
+				return nil, err
+			}
+			st.fid, st.offset, st.opened = dataFile.FileId, dataFile.HeaderSize, true
+			return st.withLag(&replicationFrame{typ: frameFile, fid: st.fid, payload: header})
+		}
+
+		dataFile := db.dataFiles()[st.fid]
+		if dataFile == nil {
+			return nil, ErrReplicationProtocol
+		}
+		size, err := db.dataFileSize(dataFile)
+		if err != nil {
+			return nil, err
+		}
+		if st.offset >= size {
+			if dataFile == db.activeFile {
+				return nil, nil
+			}
+			st.fid, st.opened = st.fid+1, false
+			continue
+		}
+
+		//只发送完整的记录，副本收到后可以直接更新索引
+		offset := st.offset
+		var records uint32
+		for offset < size && (records == 0 || offset-st.offset < maxReplicationBatchSize) {
+			recordSize, err := dataFile.ReadRecordSize(offset)
+			if err != nil {
+				return nil, err
+			}
+			offset += recordSize
+			records++
+		}
+		payload := make([]byte, offset-st.offset)
+		if _, err := dataFile.IOManager.Read(payload, st.offset); err != nil {
+			return nil, err
+		}
+		frame := &replicationFrame{typ: frameData, fid: st.fid, offset: st.offset, records: records, payload: payload}
+		st.offset = offset
+		st.sent += int64(records)
+		return st.withLag(frame)
+	}
+}
+
+// withLag 计算发送该帧之后副本仍然落后的数据量，使用该方法需要加锁
+func (st *replicationStream) withLag(frame *replicationFrame) (*replicationFrame, error) {
+	db := st.db
+	for fid, dataFile := range db.dataFiles() {
+		if fid < st.fid {
+			continue
+		}
+		size, err := db.dataFileSize(dataFile)
+		if err != nil {
+			return nil, err
+		}
+		if fid == st.fid && st.opened {
+			size -= st.offset
+		}
+		frame.lagBytes += size
+	}
+	frame.lagRecords = max(st.backlog+db.appendCount-st.appendCount-st.sent, 0)
+	return frame, nil
+}
+
+// caughtUp 是否已经发送了活跃文件末尾之前的所有数据，使用该方法需要加锁
+func (st *replicationStream) caughtUp() bool {
+	end := st.db.replicationEnd()
+	if !st.opened {
+		return st.db.activeFile == nil || st.fid > end.Fid
+	}
+	return st.fid == end.Fid && st.offset >= end.Offset
+}
+
+func (st *replicationStream) send(frame *replicationFrame) error {
+	if err := writeReplicationFrame(st.w, frame); err != nil {
+		return err
+	}
+	return st.w.Flush()
+}
+
+// notifyAppend 唤醒等待新数据的复制连接，使用该方法需要加锁
+func (db *DB) notifyAppend() {
+	if db.appendNotify != nil {
+		close(db.appendNotify)
+		db.appendNotify = nil
+	}
+}
+
+// replicationEnd 获取当前数据的末尾位置，使用该方法需要加锁
+func (db *DB) replicationEnd() data.LogRecordPos {
+	if db.activeFile == nil {
+		return data.LogRecordPos{}
+	}
+	return data.LogRecordPos{Fid: db.activeFile.FileId, Offset: db.activeFile.WriteOff}
+}
+
+// dataFiles 获取所有的数据文件，使用该方法需要加锁
+func (db *DB) dataFiles() map[uint32]*data.DataFile {
+	dataFiles := make(map[uint32]*data.DataFile, len(db.olderFiles)+1)
+	for fileId, dataFile := range db.olderFiles {
+		dataFiles[fileId] = dataFile
+	}
+	if db.activeFile != nil {
+		dataFiles[db.activeFile.FileId] = db.activeFile
+	}
+	return dataFiles
+}
+
+// nextDataFile 获取文件id不小于fid的第一个数据文件，使用该方法需要加锁
+func (db *DB) nextDataFile(fid uint32) *data.DataFile {
+	var next *data.DataFile
+	for fileId, dataFile := range db.dataFiles() {
+		if fileId >= fid && (next == nil || fileId < next.FileId) {
+			next = dataFile
+		}
+	}
+	return next
+}
+
+// dataFileSize 获取数据文件中已经写入的大小，使用该方法需要加锁
+func (db *DB) dataFileSize(dataFile *data.DataFile) (int64, error) {
+	if dataFile == db.activeFile {
+		return dataFile.WriteOff, nil
+	}
+	return dataFile.IOManager.Size()
+}
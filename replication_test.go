@@ -0,0 +1,216 @@
+package skv_go
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"skv-go/data"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// waitFor 等待条件成立，超时返回false
+func waitFor(cond func() bool) bool {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+func startReplicationServer(t *testing.T, db *DB, addr string) (*ReplicationServer, string) {
+	listener, err := net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	server := NewReplicationServer(db)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return server, listener.Addr().String()
+}
+
+// sameKeyValues 判断副本中的数据是否和主节点一致
+func sameKeyValues(primary, replica *DB) bool {
+	expected, err := primary.Scan(nil, nil, 0)
+	if err != nil {
+		return false
+	}
+	actual, err := replica.Scan(nil, nil, 0)
+	if err != nil {
+		return false
+	}
+	return assert.ObjectsAreEqual(expected, actual)
+}
+
+func TestReplica(t *testing.T) {
+	primaryDir, _ := os.MkdirTemp("", "test-replication-primary")
+	options := DefaultOptions
+	options.DirPath = primaryDir
+	options.DataFileSize = 1024
+	primary, err := Open(options)
+	defer destroyDB(primary)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, primary.Put([]byte{'k', byte(i)}, []byte("value")))
+	}
+	wb := primary.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put([]byte("batch"), []byte("value")))
+	assert.NoError(t, wb.Delete([]byte{'k', 1}))
+	assert.NoError(t, wb.Commit())
+	assert.NoError(t, primary.DeleteRange([]byte{'k', 50}, []byte{'k', 60}))
+
+	server, addr := startReplicationServer(t, primary, "127.0.0.1:0")
+	defer server.Close()
+
+	replicaDir, _ := os.MkdirTemp("", "test-replication-replica")
+	replicaOptions := DefaultOptions
+	replicaOptions.DirPath = replicaDir
+	_, err = OpenReplica(replicaOptions, DefaultReplicaOptions)
+	assert.Equal(t, ErrPrimaryAddrIsEmpty, err)
+	opts := DefaultReplicaOptions
+	opts.PrimaryAddr = addr
+	replica, err := OpenReplica(replicaOptions, opts)
+	assert.NoError(t, err)
+	defer func() {
+		_ = replica.Close()
+		_ = os.RemoveAll(replicaDir)
+	}()
+
+	// The existing data files are copied first
+	assert.True(t, waitFor(func() bool { return sameKeyValues(primary, replica.DB()) }))
+
+	// New records are tailed
+	assert.NoError(t, primary.Put([]byte("live"), []byte("value")))
+	assert.NoError(t, primary.Delete([]byte{'k', 2}))
+	assert.True(t, waitFor(func() bool { return sameKeyValues(primary, replica.DB()) }))
+	value, err := replica.DB().Get([]byte("live"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	assert.True(t, waitFor(func() bool {
+		status := replica.Status()
+		return status.Connected && status.LagBytes == 0 && status.LagRecords == 0
+	}))
+	primary.rw.RLock()
+	end := primary.replicationEnd()
+	primary.rw.RUnlock()
+	status := replica.Status()
+	assert.Equal(t, end.Fid, status.Fid)
+	assert.Equal(t, end.Offset, status.Offset)
+
+	// Replicas refuse writes
+	assert.Equal(t, ErrReadOnlyReplica, replica.DB().Put([]byte("key"), []byte("value")))
+	assert.Equal(t, ErrReadOnlyReplica, replica.DB().Delete([]byte("live")))
+	assert.Equal(t, ErrReadOnlyReplica, replica.DB().DeletePrefix([]byte("k")))
+	wb = replica.DB().NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put([]byte("key"), []byte("value")))
+	assert.Equal(t, ErrReadOnlyReplica, wb.Commit())
+	assert.Equal(t, ErrReadOnlyReplica, replica.DB().Merge())
+}
+
+func TestReplica_Reconnect(t *testing.T) {
+	primaryDir, _ := os.MkdirTemp("", "test-replication-primary")
+	options := DefaultOptions
+	options.DirPath = primaryDir
+	options.DataFileSize = 1024
+	primary, err := Open(options)
+	defer destroyDB(primary)
+	assert.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, primary.Put([]byte{'a', byte(i)}, []byte("value")))
+	}
+
+	server, addr := startReplicationServer(t, primary, "127.0.0.1:0")
+	replicaDir, _ := os.MkdirTemp("", "test-replication-replica")
+	defer os.RemoveAll(replicaDir)
+	replicaOptions := DefaultOptions
+	replicaOptions.DirPath = replicaDir
+	opts := DefaultReplicaOptions
+	opts.PrimaryAddr = addr
+	opts.ReconnectInterval = 20 * time.Millisecond
+	replica, err := OpenReplica(replicaOptions, opts)
+	assert.NoError(t, err)
+	assert.True(t, waitFor(func() bool { return sameKeyValues(primary, replica.DB()) }))
+	fileInfo, err := os.Stat(data.GetDataFileName(replicaDir, 0))
+	assert.NoError(t, err)
+
+	// The primary goes away and comes back on the same address
+	assert.NoError(t, server.Close())
+	assert.True(t, waitFor(func() bool { return !replica.Status().Connected }))
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, primary.Put([]byte{'b', byte(i)}, []byte("value")))
+	}
+	server, _ = startReplicationServer(t, primary, addr)
+	assert.True(t, waitFor(func() bool { return sameKeyValues(primary, replica.DB()) }))
+
+	// The replica restarts and resumes from its last applied position
+	assert.NoError(t, replica.Close())
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, primary.Put([]byte{'c', byte(i)}, []byte("value")))
+	}
+	replica, err = OpenReplica(replicaOptions, opts)
+	assert.NoError(t, err)
+	assert.True(t, waitFor(func() bool { return sameKeyValues(primary, replica.DB()) }))
+	// The files that were already replicated are kept
+	reopenFileInfo, err := os.Stat(data.GetDataFileName(replicaDir, 0))
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(fileInfo, reopenFileInfo))
+
+	// After a merge on the primary the replica syncs again from scratch
+	assert.NoError(t, primary.Delete([]byte{'a', 0}))
+	assert.NoError(t, primary.Merge())
+	assert.NoError(t, primary.Put([]byte("after-merge"), []byte("value")))
+	assert.True(t, waitFor(func() bool { return sameKeyValues(primary, replica.DB()) }))
+
+	assert.NoError(t, replica.Close())
+	assert.NoError(t, server.Close())
+}
+
+func TestReplicationServer_Lag(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-replication-lag")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 1024
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, db.Put([]byte{'k', byte(i)}, []byte("value")))
+	}
+	stat, err := db.Stat()
+	assert.NoError(t, err)
+	assert.True(t, stat.DataFileNum > 1)
+
+	server, addr := startReplicationServer(t, db, "127.0.0.1:0")
+	defer server.Close()
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, writeReplicaManifest(conn, nil))
+	reader := bufio.NewReader(conn)
+
+	var totalBytes int64
+	db.rw.RLock()
+	for _, dataFile := range db.dataFiles() {
+		size, err := db.dataFileSize(dataFile)
+		assert.NoError(t, err)
+		totalBytes += size
+	}
+	db.rw.RUnlock()
+
+	// The lag shrinks with every frame until the replica has everything
+	var received, records int64
+	for records < 100 {
+		frame, err := readReplicationFrame(reader)
+		assert.NoError(t, err)
+		received += int64(len(frame.payload))
+		records += int64(frame.records)
+		assert.Equal(t, totalBytes-received, frame.lagBytes)
+		assert.Equal(t, 100-records, frame.lagRecords)
+	}
+	assert.Equal(t, int64(100), records)
+}
@@ -0,0 +1,219 @@
+package resp
+
+import (
+	"fmt"
+	skv "skv-go"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCAN默认每次返回的key数量
+const defaultScanCount = 10
+
+type commandFunc func(s *Server, w *Writer, args [][]byte)
+
+// commandTable 命令名称与处理函数以及参数数量的对应关系，arity为负数表示最少需要的参数数量
+var commandTable = map[string]struct {
+	fn    commandFunc
+	arity int
+}{
+	"ping":    {ping, -1},
+	"get":     {get, 2},
+	"set":     {set, -3},
+	"del":     {del, -2},
+	"exists":  {exists, -2},
+	"keys":    {keys, 2},
+	"scan":    {scan, -2},
+	"command": {command, -1},
+}
+
+// execute 执行一个命令，并将回复写入到writer中
+func (s *Server) execute(w *Writer, args [][]byte) {
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commandTable[name]
+	if !ok {
+		w.WriteError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return
+	}
+	cmd.fn(s, w, args)
+}
+
+func ping(_ *Server, w *Writer, args [][]byte) {
+	switch len(args) {
+	case 1:
+		w.WriteSimpleString("PONG")
+	case 2:
+		w.WriteBulk(args[1])
+	default:
+		w.WriteError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func get(s *Server, w *Writer, args [][]byte) {
+	value, err := s.db.Get(args[1])
+	if err == skv.ErrKeyNotFound {
+		w.WriteNull()
+		return
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteBulk(value)
+}
+
+// set 支持EX和PX参数设置过期时间
+func set(s *Server, w *Writer, args [][]byte) {
+	var ttl time.Duration
+	for i := 3; i < len(args); i++ {
+		opt := strings.ToLower(string(args[i]))
+		if (opt != "ex" && opt != "px") || i+1 >= len(args) || ttl != 0 {
+			w.WriteError("ERR syntax error")
+			return
+		}
+		n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil || n <= 0 {
+			w.WriteError("ERR invalid expire time in 'set' command")
+			return
+		}
+		if opt == "ex" {
+			ttl = time.Duration(n) * time.Second
+		} else {
+			ttl = time.Duration(n) * time.Millisecond
+		}
+		i++
+	}
+	var err error
+	if ttl > 0 {
+		err = s.db.PutWithTTL(args[1], args[2], ttl)
+	} else {
+		err = s.db.Put(args[1], args[2])
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteSimpleString("OK")
+}
+
+func del(s *Server, w *Writer, args [][]byte) {
+	var count int64
+	for _, key := range args[1:] {
+		exists, err := s.db.DeleteIfExists(key)
+		if err == skv.ErrKeyIsEmpty {
+			continue
+		}
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if exists {
+			count++
+		}
+	}
+	w.WriteInteger(count)
+}
+
+func exists(s *Server, w *Writer, args [][]byte) {
+	var count int64
+	for _, key := range args[1:] {
+		if _, err := s.db.Get(key); err == nil {
+			count++
+		}
+	}
+	w.WriteInteger(count)
+}
+
+func keys(s *Server, w *Writer, args [][]byte) {
+	pattern := args[1]
+	options := skv.DefaultIteratorOptions
+	options.Prefix = globPrefix(pattern)
+	iter := s.db.NewIterator(options)
+	defer iter.Close()
+
+	var result [][]byte
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		if globMatch(pattern, iter.Key()) {
+			result = append(result, iter.Key())
+		}
+	}
+	w.WriteBulkArray(result)
+}
+
+// scan 游标为0表示从头开始遍历，返回的游标为0表示遍历结束
+func scan(s *Server, w *Writer, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		w.WriteError("ERR invalid cursor")
+		return
+	}
+	var pattern []byte
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			w.WriteError("ERR syntax error")
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = args[i+1]
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count <= 0 {
+				w.WriteError("ERR syntax error")
+				return
+			}
+		default:
+			w.WriteError("ERR syntax error")
+			return
+		}
+	}
+	//从头开始时直接定位到模式的固定前缀，不需要逐个跳过前缀之前的key
+	start := globPrefix(pattern)
+	if cursor != 0 {
+		var ok bool
+		if start, ok = s.loadCursor(cursor); !ok {
+			w.WriteError("ERR invalid cursor")
+			return
+		}
+	}
+
+	options := skv.DefaultIteratorOptions
+	if pattern != nil {
+		options.Prefix = globPrefix(pattern)
+	}
+	iter := s.db.NewIterator(options)
+	defer iter.Close()
+
+	var result [][]byte
+	var nextCursor uint64
+	var scanned int
+	for iter.Seek(start); iter.Valid(); iter.Next() {
+		//达到数量限制，记录下一次开始的key
+		if scanned == count {
+			nextCursor = s.saveCursor(iter.Key())
+			break
+		}
+		scanned++
+		if pattern == nil || globMatch(pattern, iter.Key()) {
+			result = append(result, iter.Key())
+		}
+	}
+	w.WriteArrayHeader(2)
+	w.WriteBulk([]byte(strconv.FormatUint(nextCursor, 10)))
+	w.WriteBulkArray(result)
+}
+
+// command 客户端连接时可能会发送COMMAND获取命令信息，这里只返回空数组
+func command(_ *Server, w *Writer, _ [][]byte) {
+	w.WriteArrayHeader(0)
+}
+
+func writeDBError(w *Writer, err error) {
+	w.WriteError("ERR " + err.Error())
+}
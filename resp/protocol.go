@@ -0,0 +1,193 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+)
+
+const (
+	// 单个命令最多包含的参数数量
+	maxArgs = 1024 * 1024
+	// 单个参数的最大长度，与redis保持一致
+	maxBulkLen = 512 * 1024 * 1024
+	// 内联命令单行的最大长度
+	maxInlineLen = 64 * 1024
+)
+
+var ErrProtocol = errors.New("protocol error")
+
+// Reader 从连接中读取客户端发送的命令
+type Reader struct {
+	rd *bufio.Reader
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{rd: bufio.NewReader(rd)}
+}
+
+// Buffered 缓冲区中还没有读取的字节数，大于0说明客户端使用了pipeline
+func (r *Reader) Buffered() int {
+	return r.rd.Buffered()
+}
+
+// ReadCommand 读取一个命令，支持多条批量字符串组成的数组以及以空格分隔的内联命令
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return parseInline(line), nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, ErrProtocol
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		if args[i], err = r.readBulk(); err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+// readBulk 读取一个批量字符串
+func (r *Reader) readBulk() ([]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, ErrProtocol
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxBulkLen {
+		return nil, ErrProtocol
+	}
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		return nil, err
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, ErrProtocol
+	}
+	return buf[:n], nil
+}
+
+// readLine 读取一行数据，去掉末尾的\r\n
+func (r *Reader) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		b, err := r.rd.ReadSlice('\n')
+		line = append(line, b...)
+		if err == nil {
+			break
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+		if len(line) > maxInlineLen {
+			return nil, ErrProtocol
+		}
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// parseInline 解析内联命令，参数之间使用空格分隔
+func parseInline(line []byte) [][]byte {
+	var args [][]byte
+	start := -1
+	for i, c := range line {
+		if c == ' ' || c == '\t' {
+			if start >= 0 {
+				args = append(args, line[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		args = append(args, line[start:])
+	}
+	return args
+}
+
+// Writer 向连接中写入回复，调用Flush后才会真正发送
+type Writer struct {
+	wr *bufio.Writer
+}
+
+func NewWriter(wr io.Writer) *Writer {
+	return &Writer{wr: bufio.NewWriter(wr)}
+}
+
+// WriteSimpleString 写入简单字符串，如+OK
+func (w *Writer) WriteSimpleString(s string) {
+	w.wr.WriteByte('+')
+	w.wr.WriteString(s)
+	w.wr.WriteString("\r\n")
+}
+
+// WriteError 写入错误信息
+func (w *Writer) WriteError(msg string) {
+	w.wr.WriteByte('-')
+	w.wr.WriteString(msg)
+	w.wr.WriteString("\r\n")
+}
+
+// WriteInteger 写入整数
+func (w *Writer) WriteInteger(n int64) {
+	w.wr.WriteByte(':')
+	w.wr.WriteString(strconv.FormatInt(n, 10))
+	w.wr.WriteString("\r\n")
+}
+
+// WriteBulk 写入批量字符串
+func (w *Writer) WriteBulk(b []byte) {
+	w.wr.WriteByte('$')
+	w.wr.WriteString(strconv.Itoa(len(b)))
+	w.wr.WriteString("\r\n")
+	w.wr.Write(b)
+	w.wr.WriteString("\r\n")
+}
+
+// WriteNull 写入空的批量字符串，表示数据不存在
+func (w *Writer) WriteNull() {
+	w.wr.WriteString("$-1\r\n")
+}
+
+// WriteArrayHeader 写入数组的长度，之后需要依次写入数组中的每个元素
+func (w *Writer) WriteArrayHeader(n int) {
+	w.wr.WriteByte('*')
+	w.wr.WriteString(strconv.Itoa(n))
+	w.wr.WriteString("\r\n")
+}
+
+// WriteBulkArray 写入由批量字符串组成的数组
+func (w *Writer) WriteBulkArray(items [][]byte) {
+	w.WriteArrayHeader(len(items))
+	for _, item := range items {
+		w.WriteBulk(item)
+	}
+}
+
+// Flush 将缓冲区中的回复发送出去
+func (w *Writer) Flush() error {
+	return w.wr.Flush()
+}
@@ -0,0 +1,74 @@
+package resp
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReader_ReadCommand(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nva\r\nl\r\n" + "PING hello  world\r\n" + "*1\r\n$4\r\nPING\r\n"
+	reader := NewReader(strings.NewReader(input))
+
+	args, err := reader.ReadCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("SET"), []byte("key"), []byte("va\r\nl")}, args)
+
+	// Inline commands
+	args, err = reader.ReadCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("PING"), []byte("hello"), []byte("world")}, args)
+
+	args, err = reader.ReadCommand()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("PING")}, args)
+	assert.Equal(t, 0, reader.Buffered())
+}
+
+func TestReader_ProtocolError(t *testing.T) {
+	for _, input := range []string{"*1\r\n:1\r\n", "*1\r\n$-5\r\n", "*1\r\n$3\r\nabcde\r\n", "*x\r\n"} {
+		_, err := NewReader(strings.NewReader(input)).ReadCommand()
+		assert.Equal(t, ErrProtocol, err, input)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	writer.WriteSimpleString("OK")
+	writer.WriteError("ERR bad")
+	writer.WriteInteger(42)
+	writer.WriteBulk([]byte("value"))
+	writer.WriteNull()
+	writer.WriteBulkArray([][]byte{[]byte("a"), []byte("")})
+	assert.Equal(t, 0, buf.Len())
+	assert.NoError(t, writer.Flush())
+	assert.Equal(t, "+OK\r\n-ERR bad\r\n:42\r\n$5\r\nvalue\r\n$-1\r\n*2\r\n$1\r\na\r\n$0\r\n\r\n", buf.String())
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		matched bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"a*b*c", "a/x/b/y/c", true},
+		{"a\\*", "a*", true},
+		{"a\\*", "ab", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.matched, globMatch([]byte(c.pattern), []byte(c.key)), c.pattern+" "+c.key)
+	}
+	assert.Equal(t, []byte("user:"), globPrefix([]byte("user:*")))
+	assert.Equal(t, []byte("a"), globPrefix([]byte("a\\*")))
+}
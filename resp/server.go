@@ -0,0 +1,175 @@
+package resp
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	skv "skv-go"
+	"strings"
+	"sync"
+)
+
+var ErrServerClosed = errors.New("resp: server closed")
+
+// 服务端最多保存的SCAN游标数量，超过后丢弃最早的游标
+const maxScanCursors = 10000
+
+// Server 使用redis协议对外提供DB的读写服务
+type Server struct {
+	db *skv.DB
+
+	mu        *sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        *sync.WaitGroup
+
+	//SCAN游标对应的下一个key
+	cursorMu    *sync.Mutex
+	cursors     map[uint64][]byte
+	cursorOrder []uint64
+	nextCursor  uint64
+}
+
+// NewServer 创建一个服务端
+func NewServer(db *skv.DB) *Server {
+	return &Server{
+		db:         db,
+		mu:         new(sync.Mutex),
+		listeners:  make(map[net.Listener]struct{}),
+		conns:      make(map[net.Conn]struct{}),
+		wg:         new(sync.WaitGroup),
+		cursorMu:   new(sync.Mutex),
+		cursors:    make(map[uint64][]byte),
+		nextCursor: 1,
+	}
+}
+
+// ListenAndServe 监听指定地址并处理连接
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve 在指定的listener上接受连接，每个连接使用单独的协程处理，直到listener关闭
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, listener)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+// Close 关闭所有的listener和连接，并等待正在处理的连接退出
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	for listener := range s.listeners {
+		_ = listener.Close()
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// handleConn 处理一个客户端连接，依次执行收到的命令
+// 客户端使用pipeline时，缓冲区中的命令全部执行完之后再统一发送回复
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+		s.wg.Done()
+	}()
+
+	reader := NewReader(conn)
+	writer := NewWriter(conn)
+	for {
+		args, err := reader.ReadCommand()
+		if err != nil {
+			if err == ErrProtocol {
+				writer.WriteError("ERR Protocol error")
+				_ = writer.Flush()
+			} else if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("resp: failed to read command from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := strings.EqualFold(string(args[0]), "quit")
+		if quit {
+			writer.WriteSimpleString("OK")
+		} else {
+			s.execute(writer, args)
+		}
+		if quit || reader.Buffered() == 0 {
+			if err := writer.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// saveCursor 保存SCAN下一次开始的key，返回对应的游标
+func (s *Server) saveCursor(key []byte) uint64 {
+	s.cursorMu.Lock()
+	defer s.cursorMu.Unlock()
+	cursor := s.nextCursor
+	s.nextCursor++
+	s.cursors[cursor] = key
+	s.cursorOrder = append(s.cursorOrder, cursor)
+	if len(s.cursorOrder) > maxScanCursors {
+		delete(s.cursors, s.cursorOrder[0])
+		s.cursorOrder = s.cursorOrder[1:]
+	}
+	return cursor
+}
+
+// loadCursor 获取游标对应的key，游标不存在时返回false
+func (s *Server) loadCursor(cursor uint64) ([]byte, bool) {
+	s.cursorMu.Lock()
+	defer s.cursorMu.Unlock()
+	key, ok := s.cursors[cursor]
+	return key, ok
+}
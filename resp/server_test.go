@@ -0,0 +1,187 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	skv "skv-go"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startTestServer(t *testing.T) (*Server, string, func()) {
+	dir, _ := os.MkdirTemp("", "test-resp")
+	options := skv.DefaultOptions
+	options.DirPath = dir
+	db, err := skv.Open(options)
+	assert.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := NewServer(db)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	return server, listener.Addr().String(), func() {
+		assert.NoError(t, server.Close())
+		assert.NoError(t, db.Close())
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// testClient 测试用的简单客户端
+type testClient struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func newTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	return &testClient{conn: conn, rd: bufio.NewReader(conn)}
+}
+
+func (c *testClient) send(args ...string) {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		sb.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg))
+	}
+	_, _ = c.conn.Write([]byte(sb.String()))
+}
+
+// reply 读取一个回复，数组会被展开为以空格分隔的字符串
+func (c *testClient) reply(t *testing.T) string {
+	line, err := c.rd.ReadString('\n')
+	assert.NoError(t, err)
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+		buf := make([]byte, n+2)
+		_, err := io.ReadFull(c.rd, buf)
+		assert.NoError(t, err)
+		return string(buf[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]string, n)
+		for i := range items {
+			items[i] = c.reply(t)
+		}
+		return "[" + strings.Join(items, " ") + "]"
+	default:
+		return line
+	}
+}
+
+func (c *testClient) do(t *testing.T, args ...string) string {
+	c.send(args...)
+	return c.reply(t)
+}
+
+func TestServer_Commands(t *testing.T) {
+	_, addr, stop := startTestServer(t)
+	defer stop()
+	client := newTestClient(t, addr)
+	defer client.conn.Close()
+
+	assert.Equal(t, "+PONG", client.do(t, "PING"))
+	assert.Equal(t, "hello", client.do(t, "ping", "hello"))
+	assert.Equal(t, "(nil)", client.do(t, "GET", "key"))
+	assert.Equal(t, "+OK", client.do(t, "SET", "key", "value"))
+	assert.Equal(t, "value", client.do(t, "GET", "key"))
+	assert.Equal(t, "+OK", client.do(t, "SET", "binary", "a\r\nb"))
+	assert.Equal(t, "a\r\nb", client.do(t, "GET", "binary"))
+	assert.Equal(t, "+OK", client.do(t, "SET", "ttl", "value", "EX", "100"))
+	assert.Equal(t, "-ERR syntax error", client.do(t, "SET", "ttl", "value", "NX"))
+	assert.Equal(t, ":2", client.do(t, "EXISTS", "key", "binary", "missing"))
+	assert.Equal(t, "[binary key ttl]", client.do(t, "KEYS", "*"))
+	assert.Equal(t, "[key]", client.do(t, "KEYS", "k?y"))
+	assert.Equal(t, ":1", client.do(t, "DEL", "key", "missing"))
+	assert.Equal(t, "(nil)", client.do(t, "GET", "key"))
+	assert.Equal(t, "-ERR wrong number of arguments for 'get' command", client.do(t, "GET"))
+	assert.Equal(t, "-ERR unknown command 'FOO'", client.do(t, "FOO"))
+	assert.Equal(t, "+OK", client.do(t, "QUIT"))
+}
+
+func TestServer_Scan(t *testing.T) {
+	_, addr, stop := startTestServer(t)
+	defer stop()
+	client := newTestClient(t, addr)
+	defer client.conn.Close()
+
+	for i := 0; i < 25; i++ {
+		assert.Equal(t, "+OK", client.do(t, "SET", fmt.Sprintf("user:%02d", i), "v"))
+	}
+	assert.Equal(t, "+OK", client.do(t, "SET", "other", "v"))
+
+	var keys []string
+	cursor := "0"
+	for {
+		client.send("SCAN", cursor, "MATCH", "user:*", "COUNT", "10")
+		line, _ := client.rd.ReadString('\n')
+		assert.Equal(t, "*2\r\n", line)
+		cursor = client.reply(t)
+		page := strings.Trim(client.reply(t), "[]")
+		if page != "" {
+			keys = append(keys, strings.Split(page, " ")...)
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	assert.Equal(t, 25, len(keys))
+	assert.Equal(t, "user:00", keys[0])
+	assert.Equal(t, "user:24", keys[24])
+	assert.Equal(t, "-ERR invalid cursor", client.do(t, "SCAN", "12345"))
+}
+
+func TestServer_Pipelining(t *testing.T) {
+	_, addr, stop := startTestServer(t)
+	defer stop()
+	client := newTestClient(t, addr)
+	defer client.conn.Close()
+
+	// Send all the commands before reading any reply
+	_, err := client.conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\na\r\n" +
+		"PING\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "+OK", client.reply(t))
+	assert.Equal(t, "1", client.reply(t))
+	assert.Equal(t, "+PONG", client.reply(t))
+}
+
+func TestServer_ConcurrentClients(t *testing.T) {
+	_, addr, stop := startTestServer(t)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for c := 0; c < 10; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			client := newTestClient(t, addr)
+			defer client.conn.Close()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("client-%d-%d", c, i)
+				assert.Equal(t, "+OK", client.do(t, "SET", key, key))
+				assert.Equal(t, key, client.do(t, "GET", key))
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	client := newTestClient(t, addr)
+	defer client.conn.Close()
+	assert.Equal(t, strings.Count(client.do(t, "KEYS", "client-*"), " ")+1, 1000)
+}
@@ -0,0 +1,159 @@
+package skv_go
+
+import (
+	"skv-go/data"
+	"skv-go/index"
+	"sync"
+	"time"
+)
+
+// Snapshot 数据库在某一时刻的只读快照，之后的写入、删除和merge对快照都不可见，
+// 使用完毕后需要调用Release释放，否则被merge替换掉的数据文件不会被关闭
+type Snapshot struct {
+	db *DB
+	//快照创建时的索引，和数据库的索引互不影响
+	index index.Indexer
+	//快照创建时的数据文件，读取时只从这些文件中查找
+	dataFiles map[uint32]*data.DataFile
+	//快照创建时的事务序列号
+	seqNo uint64
+	mu    *sync.RWMutex
+	//是否已经释放
+	released bool
+}
+
+// Snapshot 创建一个快照，索引使用写时复制，创建快照的开销很小
+func (db *DB) Snapshot() *Snapshot {
+	db.rw.Lock()
+	defer db.rw.Unlock()
+	s := &Snapshot{
+		db:        db,
+		dataFiles: db.pinDataFiles(),
+		seqNo:     db.seqNo,
+		mu:        new(sync.RWMutex),
+	}
+	if cloner, ok := db.index.(index.Cloner); ok {
+		s.index = cloner.Clone()
+	} else {
+		//不支持复制的索引需要在锁内复制所有的条目
+		s.index = copyIndex(db.index.Iterator(false))
+	}
+	return s
+}
+
+// copyIndex 将迭代器中的条目复制到一个新的B树索引中
+func copyIndex(iterator index.Iterator) index.Indexer {
+	bt := index.NewBTree()
+	defer iterator.Close()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		key := make([]byte, len(iterator.Key()))
+		copy(key, iterator.Key())
+		bt.Put(key, iterator.Value())
+	}
+	return bt
+}
+
+// SeqNo 获取快照创建时最后提交的事务序列号，只有WriteBatch和事务提交时才会增加，
+// 普通的Put和Delete不会改变它，不能用来判断两个快照之间是否有写入
+func (s *Snapshot) SeqNo() uint64 {
+	return s.seqNo
+}
+
+// Get 根据key读取快照中的数据
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.released {
+		return nil, ErrSnapshotReleased
+	}
+	pos := s.index.Get(key)
+	if pos == nil || pos.IsExpired(time.Now().UnixNano()) {
+		return nil, ErrKeyNotFound
+	}
+	return s.getValueByPosition(pos)
+}
+
+// NewIterator 创建一个遍历快照的迭代器，快照释放后不能再读取value
+func (s *Snapshot) NewIterator(opts IteratorOptions) *Iterator {
+	it := &Iterator{
+		indexIter: s.index.Iterator(opts.Reverse),
+		db:        s.db,
+		snapshot:  s,
+		options:   opts,
+	}
+	it.Rewind()
+	return it
+}
+
+// Release 释放快照，释放最后一个快照时会关闭merge替换掉的数据文件
+func (s *Snapshot) Release() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.released {
+		return nil
+	}
+	s.released = true
+	s.dataFiles = nil
+	_ = s.index.Close()
+
+	s.db.rw.Lock()
+	defer s.db.rw.Unlock()
+	return s.db.unpinDataFiles()
+}
+
+func (s *Snapshot) getValue(pos *data.LogRecordPos) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.released {
+		return nil, ErrSnapshotReleased
+	}
+	return s.getValueByPosition(pos)
+}
+
+// getValueByPosition 从快照的数据文件中读取value，需要持有快照的读锁
+func (s *Snapshot) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
+	//文件转换为mmap读取时会替换IOManager，需要持有数据库的读锁
+	s.db.rw.RLock()
+	defer s.db.rw.RUnlock()
+	return readValueFromFile(s.dataFiles[pos.Fid], pos)
+}
+
+// pinDataFiles 获取当前所有的数据文件，调用unpinDataFiles之前merge不会关闭这些文件，使用该方法需要加锁
+func (db *DB) pinDataFiles() map[uint32]*data.DataFile {
+	db.fileRefs++
+	return db.dataFiles()
+}
+
+// unpinDataFiles 释放pinDataFiles获取的数据文件，全部释放之后关闭merge替换掉的数据文件，使用该方法需要加锁
+func (db *DB) unpinDataFiles() error {
+	db.fileRefs--
+	if db.fileRefs > 0 {
+		return nil
+	}
+	return db.closeRetiredFiles()
+}
+
+// retireDataFile 关闭不再使用的数据文件，使用该方法需要加锁。
+// 还有快照或监听时不能关闭，文件被删除后已经打开的句柄仍然可以读取，全部释放之后再关闭
+func (db *DB) retireDataFile(dataFile *data.DataFile) error {
+	if db.fileRefs > 0 {
+		db.retiredFiles = append(db.retiredFiles, dataFile)
+		return nil
+	}
+	return dataFile.Close()
+}
+
+// closeRetiredFiles 关闭merge替换掉的数据文件，使用该方法需要加锁
+func (db *DB) closeRetiredFiles() error {
+	for i, dataFile := range db.retiredFiles {
+		if err := dataFile.Close(); err != nil {
+			db.retiredFiles = db.retiredFiles[i+1:]
+			return err
+		}
+	}
+	db.retiredFiles = nil
+	return nil
+}
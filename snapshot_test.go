@@ -0,0 +1,136 @@
+package skv_go
+
+import (
+	"os"
+	"skv-go/index"
+	"skv-go/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Snapshot(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-snapshot")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Put([]byte("a"), []byte("a1")))
+	assert.NoError(t, db.Put([]byte("b"), []byte("b1")))
+	snapshot := db.Snapshot()
+
+	// Writes after the snapshot is taken are invisible to it
+	assert.NoError(t, db.Put([]byte("a"), []byte("a2")))
+	assert.NoError(t, db.Delete([]byte("b")))
+	assert.NoError(t, db.Put([]byte("c"), []byte("c1")))
+
+	value, err := snapshot.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a1"), value)
+	value, err = snapshot.Get([]byte("b"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b1"), value)
+	_, err = snapshot.Get([]byte("c"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	value, err = db.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a2"), value)
+
+	iterator := snapshot.NewIterator(DefaultIteratorOptions)
+	var keys []string
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+		value, err := iterator.Value()
+		assert.NoError(t, err)
+		assert.Equal(t, string(iterator.Key())+"1", string(value))
+	}
+	iterator.Close()
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	assert.NoError(t, snapshot.Release())
+	assert.NoError(t, snapshot.Release())
+	_, err = snapshot.Get([]byte("a"))
+	assert.Equal(t, ErrSnapshotReleased, err)
+}
+
+func TestDB_Snapshot_Merge(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-snapshot-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, db.Put(utils.GetTestKey(i), utils.GetTestKey(i)))
+	}
+	snapshot := db.Snapshot()
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, db.Delete(utils.GetTestKey(i)))
+	}
+
+	// The files read by the snapshot stay open after merge removes them
+	assert.NoError(t, db.Merge())
+	assert.NotEmpty(t, db.retiredFiles)
+	for i := 0; i < 2000; i++ {
+		value, err := snapshot.Get(utils.GetTestKey(i))
+		assert.NoError(t, err)
+		assert.Equal(t, utils.GetTestKey(i), value)
+	}
+	assert.Equal(t, 0, len(db.ListKeys()))
+
+	assert.NoError(t, snapshot.Release())
+	assert.Empty(t, db.retiredFiles)
+}
+
+func TestDB_Snapshot_ART(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-snapshot-art")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.IndexType = index.ART
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Put([]byte("a"), []byte("a1")))
+	snapshot := db.Snapshot()
+	defer snapshot.Release()
+	assert.NoError(t, db.Put([]byte("a"), []byte("a2")))
+
+	value, err := snapshot.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a1"), value)
+}
+
+func TestDB_Snapshot_BPlusTree(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-snapshot-bptree")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.IndexType = index.BPlusTreeIndex
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.Put([]byte("a"), []byte("a1")))
+	assert.NoError(t, db.Put([]byte("b"), []byte("b1")))
+	snapshot := db.Snapshot()
+	defer snapshot.Release()
+	assert.NoError(t, db.Put([]byte("a"), []byte("a2")))
+	assert.NoError(t, db.Delete([]byte("b")))
+	assert.NoError(t, db.Put([]byte("c"), []byte("c1")))
+
+	value, err := snapshot.Get([]byte("a"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a1"), value)
+	iterator := snapshot.NewIterator(DefaultIteratorOptions)
+	defer iterator.Close()
+	var keys []string
+	for ; iterator.Valid(); iterator.Next() {
+		keys = append(keys, string(iterator.Key()))
+	}
+	assert.Equal(t, []string{"a", "b"}, keys)
+}
@@ -0,0 +1,172 @@
+package skv_go
+
+import (
+	"container/heap"
+	"log"
+	"skv-go/data"
+	"sync"
+	"time"
+)
+
+// 后台清理时每次加锁最多处理的过期key数量
+const expireSweepBatchSize = 1000
+
+// PutWithTTL 写入Key/Value数据并设置过期时间，过期后的数据视为不存在
+func (db *DB) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return ErrTTLIsInvalid
+	}
+	return db.put(key, value, time.Now().Add(ttl).UnixNano())
+}
+
+// TTL 获取Key剩余的存活时间，没有设置过期时间的Key返回0
+func (db *DB) TTL(key []byte) (time.Duration, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	db.rw.RLock()
+	defer db.rw.RUnlock()
+
+	now := time.Now().UnixNano()
+	pos := db.index.Get(key)
+	if pos == nil || pos.IsExpired(now) {
+		return 0, ErrKeyNotFound
+	}
+	if pos.Expire == 0 {
+		return 0, nil
+	}
+	return time.Duration(pos.Expire - now), nil
+}
+
+// expireEntry 等待过期的key
+type expireEntry struct {
+	key    []byte
+	expire int64
+}
+
+// expireHeap 按过期时间排序的小顶堆
+type expireHeap []*expireEntry
+
+func (h expireHeap) Len() int           { return len(h) }
+func (h expireHeap) Less(i, j int) bool { return h[i].expire < h[j].expire }
+func (h expireHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *expireHeap) Push(x any) {
+	*h = append(*h, x.(*expireEntry))
+}
+
+func (h *expireHeap) Pop() any {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
+
+// expireKeys 记录所有设置了过期时间的key，供后台清理使用
+// 堆中的记录可能已经被覆盖或删除，清理时需要和索引中的过期时间进行比较
+type expireKeys struct {
+	mu   *sync.Mutex
+	heap expireHeap
+}
+
+func newExpireKeys() *expireKeys {
+	return &expireKeys{mu: new(sync.Mutex)}
+}
+
+// add 添加一个等待过期的key，永不过期的key直接忽略
+func (ek *expireKeys) add(key []byte, expire int64) {
+	if expire == 0 {
+		return
+	}
+	ek.mu.Lock()
+	defer ek.mu.Unlock()
+	heap.Push(&ek.heap, &expireEntry{key: key, expire: expire})
+}
+
+// popExpired 取出一个在指定时间已经过期的key，没有则返回nil
+func (ek *expireKeys) popExpired(now int64) *expireEntry {
+	ek.mu.Lock()
+	defer ek.mu.Unlock()
+	if len(ek.heap) == 0 || ek.heap[0].expire > now {
+		return nil
+	}
+	return heap.Pop(&ek.heap).(*expireEntry)
+}
+
+// startExpireSweeper 启动后台清理过期key的协程
+func (db *DB) startExpireSweeper() {
+	if db.options.ExpireSweepInterval <= 0 {
+		return
+	}
+	db.sweepStop = make(chan struct{})
+	db.sweepDone = new(sync.WaitGroup)
+	db.sweepDone.Add(1)
+	go func() {
+		defer db.sweepDone.Done()
+		ticker := time.NewTicker(db.options.ExpireSweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := db.sweepExpiredKeys(); err != nil {
+					log.Printf("failed to sweep expired keys: %v", err)
+				}
+			case <-db.sweepStop:
+				return
+			}
+		}
+	}()
+}
+
+// stopExpireSweeper 停止后台清理协程并等待其退出
+func (db *DB) stopExpireSweeper() {
+	if db.sweepStop == nil {
+		return
+	}
+	close(db.sweepStop)
+	db.sweepDone.Wait()
+	db.sweepStop = nil
+}
+
+// sweepExpiredKeys 为已经过期的key写入删除记录，并将其从索引中删除。
+// 每次加锁最多处理expireSweepBatchSize个key，批次之间释放锁，避免长时间阻塞读写
+func (db *DB) sweepExpiredKeys() error {
+	now := time.Now().UnixNano()
+	for {
+		done, err := db.sweepExpiredBatch(now)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// sweepExpiredBatch 清理一批过期的key，返回是否已经没有需要清理的key
+func (db *DB) sweepExpiredBatch(now int64) (bool, error) {
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	for i := 0; i < expireSweepBatchSize; i++ {
+		entry := db.expireKeys.popExpired(now)
+		if entry == nil {
+			return true, nil
+		}
+		//key已经被覆盖或者删除
+		pos := db.index.Get(entry.key)
+		if pos == nil || pos.Expire != entry.expire {
+			continue
+		}
+		logRecord := &data.LogRecord{Key: entry.key, Type: data.LogRecordDelete}
+		tombstonePos, err := db.appendLogRecord(logRecord)
+		if err != nil {
+			//写入失败时放回堆中，下次再进行清理
+			db.expireKeys.add(entry.key, entry.expire)
+			return false, err
+		}
+		db.reclaimSize += int64(tombstonePos.Size) + int64(pos.Size)
+		db.index.Delete(entry.key)
+		db.emitEvent(logRecord, tombstonePos)
+	}
+	return false, nil
+}
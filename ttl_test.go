@@ -0,0 +1,158 @@
+package skv_go
+
+import (
+	"os"
+	"skv-go/data"
+	"skv-go/utils"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_PutWithTTL(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-ttl")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.ExpireSweepInterval = 0
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrTTLIsInvalid, db.PutWithTTL([]byte("key"), []byte("value"), 0))
+	assert.Equal(t, ErrKeyIsEmpty, db.PutWithTTL(nil, []byte("value"), time.Second))
+
+	assert.NoError(t, db.PutWithTTL([]byte("short"), []byte("value"), 50*time.Millisecond))
+	assert.NoError(t, db.PutWithTTL([]byte("long"), []byte("value"), time.Hour))
+	assert.NoError(t, db.Put([]byte("forever"), []byte("value")))
+
+	ttl, err := db.TTL([]byte("long"))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+	ttl, err = db.TTL([]byte("forever"))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+	value, err := db.Get([]byte("short"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Expired keys are treated as missing everywhere
+	_, err = db.Get([]byte("short"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.TTL([]byte("short"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, [][]byte{[]byte("forever"), []byte("long")}, db.ListKeys())
+	var folded int
+	assert.NoError(t, db.Fold(func(key []byte, value []byte) bool {
+		folded++
+		return true
+	}))
+	assert.Equal(t, 2, folded)
+	iter := db.NewIterator(DefaultIteratorOptions)
+	var iterated int
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		assert.NotEqual(t, []byte("short"), iter.Key())
+		iterated++
+	}
+	iter.Close()
+	assert.Equal(t, 2, iterated)
+
+	// Overwriting without a TTL clears the expiration
+	assert.NoError(t, db.Put([]byte("long"), []byte("value")))
+	ttl, err = db.TTL([]byte("long"))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), ttl)
+}
+
+func TestDB_PutWithTTL_Restart(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-ttl")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 32 * 1024
+	options.ExpireSweepInterval = 0
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2000; i++ {
+		assert.NoError(t, db.PutWithTTL(utils.GetTestKey(i), utils.RandomValue(10), time.Hour))
+	}
+	assert.NoError(t, db.PutWithTTL([]byte("short"), []byte("value"), 50*time.Millisecond))
+	assert.NoError(t, db.Close())
+	time.Sleep(100 * time.Millisecond)
+
+	// Expiration is restored from both hint files and data files
+	db, err = Open(options)
+	assert.NoError(t, err)
+	assert.Equal(t, 2000, len(db.ListKeys()))
+	ttl, err := db.TTL(utils.GetTestKey(0))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 59*time.Minute)
+	_, err = db.Get([]byte("short"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_ExpireSweeper(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-ttl")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.ExpireSweepInterval = 20 * time.Millisecond
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	assert.NoError(t, db.PutWithTTL([]byte("expired"), []byte("value"), 10*time.Millisecond))
+	assert.NoError(t, db.PutWithTTL([]byte("overwritten"), []byte("value"), 10*time.Millisecond))
+	assert.NoError(t, db.Put([]byte("overwritten"), []byte("new-value")))
+	time.Sleep(100 * time.Millisecond)
+
+	// The sweeper removes the key from the index and writes a tombstone
+	db.rw.RLock()
+	assert.Equal(t, 1, db.index.Size())
+	var tombstones int
+	_, err = db.readDataFile(db.activeFile, func(logRecord *data.LogRecord, _ *data.LogRecordPos) {
+		if logRecord.Type == data.LogRecordDelete {
+			assert.Equal(t, []byte("expired"), logRecord.Key)
+			tombstones++
+		}
+	})
+	db.rw.RUnlock()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, tombstones)
+	value, err := db.Get([]byte("overwritten"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new-value"), value)
+}
+
+func TestDB_ExpireSweeper_Batches(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-ttl")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.ExpireSweepInterval = 0
+
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	// More keys than one batch expire at once
+	for i := 0; i < 2*expireSweepBatchSize+10; i++ {
+		assert.NoError(t, db.PutWithTTL(utils.GetTestKey(i), []byte("value"), time.Millisecond))
+	}
+	assert.NoError(t, db.Put([]byte("live"), []byte("value")))
+	time.Sleep(10 * time.Millisecond)
+
+	done, err := db.sweepExpiredBatch(time.Now().UnixNano())
+	assert.NoError(t, err)
+	assert.False(t, done)
+	assert.Equal(t, expireSweepBatchSize+11, db.index.Size())
+
+	assert.NoError(t, db.sweepExpiredKeys())
+	assert.Equal(t, 1, db.index.Size())
+	_, err = db.Get([]byte("live"))
+	assert.NoError(t, err)
+}
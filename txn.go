@@ -0,0 +1,142 @@
+package skv_go
+
+import (
+	"skv-go/data"
+	"sync"
+	"time"
+)
+
+// Txn 乐观事务，写入的数据在提交前暂存在内存中，提交时如果读取过的key已经被其他写入修改，
+// 则提交失败并返回ErrTxnConflict，事务中的记录和批量写一样使用序列号保证原子性
+type Txn struct {
+	mu *sync.Mutex
+	db *DB
+	//读取过的key以及读取时的位置，key不存在时位置为nil
+	readSet map[string]*data.LogRecordPos
+	//暂存用户写入的数据
+	pendingWrites map[string]*data.LogRecord
+	//是否已经提交或回滚
+	finished bool
+	//开启事务时数据库完成的merge次数
+	mergeCount uint64
+}
+
+// Begin 开启一个事务
+func (db *DB) Begin() *Txn {
+	db.rw.RLock()
+	mergeCount := db.mergeCount
+	db.rw.RUnlock()
+	return &Txn{
+		mu:            new(sync.Mutex),
+		db:            db,
+		readSet:       make(map[string]*data.LogRecordPos),
+		pendingWrites: make(map[string]*data.LogRecord),
+		mergeCount:    mergeCount,
+	}
+}
+
+// Get 读取数据，可以读到事务中尚未提交的写入
+func (txn *Txn) Get(key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return nil, ErrTxnFinished
+	}
+
+	if record, ok := txn.pendingWrites[string(key)]; ok {
+		if record.Type == data.LogRecordDelete {
+			return nil, ErrKeyNotFound
+		}
+		return record.Value, nil
+	}
+
+	txn.db.rw.RLock()
+	defer txn.db.rw.RUnlock()
+	pos := txn.db.index.Get(key)
+	//只记录第一次读取时的位置，提交时和最新的位置进行比较
+	if _, ok := txn.readSet[string(key)]; !ok {
+		txn.readSet[string(key)] = pos
+	}
+	if pos == nil || pos.IsExpired(time.Now().UnixNano()) {
+		return nil, ErrKeyNotFound
+	}
+	return txn.db.getValueByPosition(pos)
+}
+
+// Put 在事务中写入数据
+func (txn *Txn) Put(key []byte, value []byte) error {
+	return txn.stage(&data.LogRecord{Key: key, Value: value, Type: data.LogRecordNormal})
+}
+
+// Delete 在事务中删除数据
+func (txn *Txn) Delete(key []byte) error {
+	return txn.stage(&data.LogRecord{Key: key, Type: data.LogRecordDelete})
+}
+
+func (txn *Txn) stage(logRecord *data.LogRecord) error {
+	if len(logRecord.Key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	txn.pendingWrites[string(logRecord.Key)] = logRecord
+	return nil
+}
+
+// Commit 提交事务，读取过的key在读取之后被修改过则返回ErrTxnConflict，事务中的写入全部丢弃。
+// merge会重用旧的文件id和偏移量，其他写入被merge重写后可能和读取时的位置相同，
+// 因此事务开启后完成过merge时，读取过数据的事务总是提交失败，需要重试
+func (txn *Txn) Commit() error {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	txn.finished = true
+
+	//加锁保证冲突检测和写入之间没有其他写入
+	txn.db.rw.Lock()
+	defer txn.db.rw.Unlock()
+	if len(txn.readSet) > 0 && txn.db.mergeCount != txn.mergeCount {
+		return ErrTxnConflict
+	}
+	for key, readPos := range txn.readSet {
+		if !samePosition(readPos, txn.db.index.Get([]byte(key))) {
+			return ErrTxnConflict
+		}
+	}
+
+	//删除不存在的数据不需要写入
+	for key, record := range txn.pendingWrites {
+		if record.Type == data.LogRecordDelete && txn.db.index.Get(record.Key) == nil {
+			delete(txn.pendingWrites, key)
+		}
+	}
+	if len(txn.pendingWrites) == 0 {
+		return nil
+	}
+	return txn.db.commitRecords(txn.pendingWrites, txn.db.options.SyncWrite)
+}
+
+// Rollback 回滚事务，丢弃所有暂存的写入
+func (txn *Txn) Rollback() {
+	txn.mu.Lock()
+	defer txn.mu.Unlock()
+	txn.finished = true
+	txn.readSet = nil
+	txn.pendingWrites = nil
+}
+
+// samePosition 判断两个位置是否指向同一条记录
+func samePosition(a, b *data.LogRecordPos) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Fid == b.Fid && a.Offset == b.Offset
+}
@@ -0,0 +1,136 @@
+package skv_go
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxn_Commit(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-txn")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("balance"), []byte("100")))
+	assert.NoError(t, db.Put([]byte("old"), []byte("value")))
+
+	txn := db.Begin()
+	value, err := txn.Get([]byte("balance"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("100"), value)
+	assert.NoError(t, txn.Put([]byte("balance"), []byte("50")))
+	assert.NoError(t, txn.Delete([]byte("old")))
+	assert.NoError(t, txn.Delete([]byte("missing")))
+
+	// The transaction reads its own writes, others do not see them yet
+	value, err = txn.Get([]byte("balance"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("50"), value)
+	_, err = txn.Get([]byte("old"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err = db.Get([]byte("balance"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("100"), value)
+
+	assert.NoError(t, txn.Commit())
+	assert.Equal(t, ErrTxnFinished, txn.Commit())
+	assert.Equal(t, ErrTxnFinished, txn.Put([]byte("balance"), []byte("0")))
+
+	// Committed writes survive a restart
+	assert.NoError(t, db.Close())
+	db, err = Open(options)
+	assert.NoError(t, err)
+	value, err = db.Get([]byte("balance"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("50"), value)
+	_, err = db.Get([]byte("old"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestTxn_Conflict(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-txn-conflict")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("counter"), []byte("1")))
+
+	// The key read is changed after the read
+	txn1 := db.Begin()
+	_, err = txn1.Get([]byte("counter"))
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("counter"), []byte("2")))
+	assert.NoError(t, txn1.Put([]byte("counter"), []byte("10")))
+	assert.Equal(t, ErrTxnConflict, txn1.Commit())
+	value, _ := db.Get([]byte("counter"))
+	assert.Equal(t, []byte("2"), value)
+
+	// A key that did not exist when read is created by someone else
+	txn2 := db.Begin()
+	_, err = txn2.Get([]byte("new"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	txn3 := db.Begin()
+	assert.NoError(t, txn3.Put([]byte("new"), []byte("txn3")))
+	assert.NoError(t, txn3.Commit())
+	assert.NoError(t, txn2.Put([]byte("new"), []byte("txn2")))
+	assert.Equal(t, ErrTxnConflict, txn2.Commit())
+
+	// Writes to keys that were not read never conflict
+	txn4 := db.Begin()
+	assert.NoError(t, txn4.Put([]byte("counter"), []byte("4")))
+	assert.NoError(t, db.Put([]byte("counter"), []byte("3")))
+	assert.NoError(t, txn4.Commit())
+	value, _ = db.Get([]byte("counter"))
+	assert.Equal(t, []byte("4"), value)
+}
+
+func TestTxn_Conflict_Merge(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-txn-conflict-merge")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("counter"), []byte("1")))
+
+	// The merge rewrites the overwritten key to a position that may equal the one read
+	txn1 := db.Begin()
+	_, err = txn1.Get([]byte("counter"))
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("counter"), []byte("2")))
+	assert.NoError(t, db.Merge())
+	assert.NoError(t, txn1.Put([]byte("counter"), []byte("10")))
+	assert.Equal(t, ErrTxnConflict, txn1.Commit())
+	value, _ := db.Get([]byte("counter"))
+	assert.Equal(t, []byte("2"), value)
+
+	// Transactions that only write are not affected
+	txn2 := db.Begin()
+	assert.NoError(t, txn2.Put([]byte("counter"), []byte("3")))
+	assert.NoError(t, db.Merge())
+	assert.NoError(t, txn2.Commit())
+	value, _ = db.Get([]byte("counter"))
+	assert.Equal(t, []byte("3"), value)
+}
+
+func TestTxn_Rollback(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-txn-rollback")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	txn := db.Begin()
+	assert.NoError(t, txn.Put([]byte("key"), []byte("value")))
+	txn.Rollback()
+	assert.Equal(t, ErrTxnFinished, txn.Commit())
+	_, err = txn.Get([]byte("key"))
+	assert.Equal(t, ErrTxnFinished, err)
+	_, err = db.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
@@ -0,0 +1,71 @@
+package skv_go
+
+import (
+	"os"
+	"path/filepath"
+	"skv-go/data"
+	"skv-go/index"
+	"strings"
+)
+
+// UpgradeDataFiles 为数据目录中没有文件头部的旧数据文件加上头部，返回升级的文件数量。
+// 没有升级的旧文件仍然可以正常读写，merge重写的文件也会带上头部。
+// 升级前会先打开一次数据库，完成中断的merge并截断损坏的活跃文件末尾，升级时数据库不能被打开
+func UpgradeDataFiles(options Options) (int, error) {
+	db, err := Open(options)
+	if err != nil {
+		return 0, err
+	}
+	if err := db.Close(); err != nil {
+		return 0, err
+	}
+
+	fileLock, err := LockDataDir(options.DirPath)
+	if err != nil {
+		return 0, err
+	}
+	defer fileLock.Unlock()
+
+	//删除上次升级中断时留下的临时文件
+	dirEntries, err := os.ReadDir(options.DirPath)
+	if err != nil {
+		return 0, err
+	}
+	for _, dirEntry := range dirEntries {
+		if strings.HasSuffix(dirEntry.Name(), data.DataFileSuffix+data.UpgradeFileSuffix) {
+			if err := os.Remove(filepath.Join(options.DirPath, dirEntry.Name())); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	fileIds, err := getDataFileIds(options.DirPath)
+	if err != nil {
+		return 0, err
+	}
+	var upgraded int
+	for _, fileId := range fileIds {
+		legacy, err := data.IsLegacyDataFile(options.DirPath, fileId)
+		if err != nil {
+			return upgraded, err
+		}
+		if !legacy {
+			continue
+		}
+		//升级后记录的偏移量会发生变化，先删除hint文件和磁盘索引，升级中断时也不会留下指向错误位置的索引，
+		//hint文件会在下次转换为旧文件或merge时重新生成，磁盘索引会在打开数据库时从数据文件中重建
+		hintFileName := data.GetHintFileName(options.DirPath, fileId)
+		if err := os.Remove(hintFileName); err != nil && !os.IsNotExist(err) {
+			return upgraded, err
+		}
+		indexFileName := filepath.Join(options.DirPath, index.BPlusTreeIndexFileName)
+		if err := os.Remove(indexFileName); err != nil && !os.IsNotExist(err) {
+			return upgraded, err
+		}
+		if _, err := data.UpgradeDataFile(options.DirPath, fileId); err != nil {
+			return upgraded, err
+		}
+		upgraded++
+	}
+	return upgraded, nil
+}
@@ -0,0 +1,64 @@
+package skv_go
+
+import (
+	"os"
+	"skv-go/data"
+	"skv-go/fio"
+	"skv-go/index"
+	"skv-go/utils"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeLegacyDataFile 写入一个没有文件头部的旧数据文件
+func writeLegacyDataFile(t *testing.T, dir string, fileId uint32, from, to int) {
+	var content []byte
+	for i := from; i < to; i++ {
+		encRecord, _ := data.EncodeLogRecord(&data.LogRecord{Key: utils.GetTestKey(i), Value: utils.GetTestKey(i)})
+		content = append(content, encRecord...)
+	}
+	assert.NoError(t, os.WriteFile(data.GetDataFileName(dir, fileId), content, fio.DataFilePerm))
+}
+
+func TestUpgradeDataFiles(t *testing.T) {
+	for _, indexType := range []index.IndexType{index.BTreeIndex, index.BPlusTreeIndex} {
+		dir, _ := os.MkdirTemp("", "test-upgrade")
+		options := DefaultOptions
+		options.DirPath = dir
+		options.IndexType = indexType
+		writeLegacyDataFile(t, dir, 0, 0, 100)
+		writeLegacyDataFile(t, dir, 1, 100, 200)
+
+		// Legacy files are readable and writable without upgrading
+		db, err := Open(options)
+		assert.NoError(t, err)
+		assert.NoError(t, db.Put(utils.GetTestKey(200), utils.GetTestKey(200)))
+		assert.NoError(t, db.Close())
+
+		// A temp file left behind by an interrupted upgrade
+		tmpFileName := data.GetDataFileName(dir, 1) + data.UpgradeFileSuffix
+		assert.NoError(t, os.WriteFile(tmpFileName, []byte("partial"), fio.DataFilePerm))
+
+		upgraded, err := UpgradeDataFiles(options)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, upgraded)
+		_, err = os.Stat(tmpFileName)
+		assert.True(t, os.IsNotExist(err))
+		upgraded, err = UpgradeDataFiles(options)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, upgraded)
+
+		db, err = Open(options)
+		assert.NoError(t, err)
+		for _, dataFile := range append([]*data.DataFile{db.activeFile}, db.olderFiles[0]) {
+			assert.Equal(t, data.DataFileVersion, dataFile.Version)
+		}
+		for i := 0; i <= 200; i++ {
+			value, err := db.Get(utils.GetTestKey(i))
+			assert.NoError(t, err)
+			assert.Equal(t, utils.GetTestKey(i), value)
+		}
+		destroyDB(db)
+	}
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"io/fs"
+	"path/filepath"
+)
+
+// DirSize 获取目录中所有文件的总大小
+func DirSize(dirPath string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dirPath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
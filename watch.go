@@ -0,0 +1,337 @@
+package skv_go
+
+import (
+	"bytes"
+	"io"
+	"skv-go/data"
+	"sort"
+	"sync"
+)
+
+type WatchEventType = byte
+
+const (
+	// WatchPut 写入了一条数据
+	WatchPut WatchEventType = iota
+	// WatchDelete 删除了一条数据，包括后台清理过期key时写入的删除记录
+	WatchDelete
+	// WatchDeleteRange 删除了[Key, Value)范围内的所有数据，Value为空表示直到末尾
+	WatchDeleteRange
+)
+
+// WatchEvent 数据变更事件，多个监听者会收到同一个事件，不能修改其中的数据
+type WatchEvent struct {
+	Type  WatchEventType
+	Key   []byte
+	Value []byte
+	//变更记录在数据文件中的位置，可以作为WatchOptions.From恢复监听
+	Pos data.LogRecordPos
+}
+
+// Watcher 监听一个前缀下的数据变更，事件在写入数据文件并更新索引之后按照写入顺序发送。
+// 未发送的事件超过BufferSize时监听会被关闭，Err返回ErrWatcherOverflow，写入不会因为消费者过慢而阻塞。
+// merge会重写旧的数据文件，merge之前获取的位置不能再用于恢复监听
+type Watcher struct {
+	db     *DB
+	prefix []byte
+	//发送给消费者的事件，监听关闭后该channel会被关闭
+	events     chan *WatchEvent
+	bufferSize int
+	mu         *sync.Mutex
+	//等待发送的事件
+	queue []*WatchEvent
+	//有新的事件加入队列时发送通知
+	notify chan struct{}
+	done   chan struct{}
+	exited chan struct{}
+	once   *sync.Once
+	err    error
+	//需要重放的数据文件，重放结束后释放
+	dataFiles map[uint32]*data.DataFile
+	//重放的起始位置和结束位置，结束位置为创建监听时活跃文件的末尾
+	start data.LogRecordPos
+	end   data.LogRecordPos
+}
+
+// Watch 监听key以prefix为前缀的数据变更，prefix为空时监听所有的数据
+func (db *DB) Watch(prefix []byte, opts WatchOptions) (*Watcher, error) {
+	if opts.BufferSize <= 0 {
+		return nil, ErrWatchBufferSize
+	}
+	db.rw.Lock()
+	defer db.rw.Unlock()
+
+	w := &Watcher{
+		db:         db,
+		prefix:     append([]byte(nil), prefix...),
+		events:     make(chan *WatchEvent),
+		bufferSize: opts.BufferSize,
+		mu:         new(sync.Mutex),
+		notify:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		exited:     make(chan struct{}),
+		once:       new(sync.Once),
+	}
+	//数据库中还没有数据文件时没有需要重放的记录
+	if opts.From != nil && db.activeFile != nil {
+		w.dataFiles = db.pinDataFiles()
+		start, err := w.replayStart(opts.From)
+		if err != nil {
+			w.dataFiles = nil
+			_ = db.unpinDataFiles()
+			return nil, err
+		}
+		w.start = start
+		w.end = data.LogRecordPos{Fid: db.activeFile.FileId, Offset: db.activeFile.WriteOff}
+	}
+	db.watchers[w] = struct{}{}
+	db.watchDone.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// replayStart 校验恢复的位置并返回重放的起始位置，使用该方法需要加锁
+func (w *Watcher) replayStart(from *data.LogRecordPos) (data.LogRecordPos, error) {
+	dataFile := w.dataFiles[from.Fid]
+	if dataFile == nil {
+		return data.LogRecordPos{}, ErrInvalidWatchPos
+	}
+	if from.Size == 0 {
+		return data.LogRecordPos{Fid: from.Fid, Offset: max(from.Offset, dataFile.HeaderSize)}, nil
+	}
+	//位置必须指向一条完整的记录，merge之后的位置通常无法通过校验
+	_, size, err := dataFile.Read(from.Offset)
+	if err != nil || size != int64(from.Size) {
+		return data.LogRecordPos{}, ErrInvalidWatchPos
+	}
+	return data.LogRecordPos{Fid: from.Fid, Offset: from.Offset + size}, nil
+}
+
+// Events 获取接收变更事件的channel
+func (w *Watcher) Events() <-chan *WatchEvent {
+	return w.events
+}
+
+// Err 获取监听关闭的原因，正常关闭时返回nil
+func (w *Watcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// Close 关闭监听，等待发送事件的协程退出
+func (w *Watcher) Close() {
+	w.stop(nil)
+	<-w.exited
+}
+
+func (w *Watcher) stop(err error) {
+	w.once.Do(func() {
+		w.mu.Lock()
+		w.err = err
+		w.queue = nil
+		w.mu.Unlock()
+		close(w.done)
+	})
+}
+
+// run 先重放数据文件中的记录，再发送新的事件
+func (w *Watcher) run() {
+	defer w.db.watchDone.Done()
+	defer close(w.exited)
+	defer close(w.events)
+	defer func() {
+		w.db.rw.Lock()
+		defer w.db.rw.Unlock()
+		delete(w.db.watchers, w)
+		if w.dataFiles != nil {
+			w.dataFiles = nil
+			_ = w.db.unpinDataFiles()
+		}
+	}()
+
+	if w.dataFiles != nil {
+		if err := w.replay(); err != nil {
+			w.stop(err)
+			return
+		}
+		w.db.rw.Lock()
+		w.dataFiles = nil
+		err := w.db.unpinDataFiles()
+		w.db.rw.Unlock()
+		if err != nil {
+			w.stop(err)
+			return
+		}
+	}
+	for {
+		event, ok := w.next()
+		if !ok || !w.send(event) {
+			return
+		}
+	}
+}
+
+// replay 重放起始位置和结束位置之间的记录，事务中的记录在读到事务完成的标识之后才会发送
+func (w *Watcher) replay() error {
+	var fileIds []uint32
+	for fileId := range w.dataFiles {
+		if fileId >= w.start.Fid && fileId <= w.end.Fid {
+			fileIds = append(fileIds, fileId)
+		}
+	}
+	sort.Slice(fileIds, func(i, j int) bool { return fileIds[i] < fileIds[j] })
+
+	txnEvents := make(map[uint64][]*WatchEvent)
+	for _, fileId := range fileIds {
+		dataFile := w.dataFiles[fileId]
+		offset := dataFile.HeaderSize
+		if fileId == w.start.Fid {
+			offset = w.start.Offset
+		}
+		for fileId != w.end.Fid || offset < w.end.Offset {
+			//文件转换为mmap读取时会替换IOManager，需要持有数据库的读锁
+			w.db.rw.RLock()
+			logRecord, size, err := dataFile.Read(offset)
+			w.db.rw.RUnlock()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			pos := &data.LogRecordPos{Fid: fileId, Offset: offset, Size: uint32(size), Expire: logRecord.Expire}
+			offset += size
+
+			if logRecord.Type == data.LogRecordTxnFinished {
+				for _, event := range txnEvents[logRecord.SeqNo] {
+					if !w.send(event) {
+						return nil
+					}
+				}
+				delete(txnEvents, logRecord.SeqNo)
+				continue
+			}
+			event := newWatchEvent(logRecord, pos)
+			if !w.match(event) {
+				continue
+			}
+			if logRecord.SeqNo != nonTransactionSeqNo {
+				txnEvents[logRecord.SeqNo] = append(txnEvents[logRecord.SeqNo], event)
+				continue
+			}
+			if !w.send(event) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// next 从队列中取出下一个事件，监听关闭时返回false
+func (w *Watcher) next() (*WatchEvent, bool) {
+	for {
+		w.mu.Lock()
+		if len(w.queue) > 0 {
+			event := w.queue[0]
+			w.queue[0] = nil
+			w.queue = w.queue[1:]
+			w.mu.Unlock()
+			return event, true
+		}
+		w.mu.Unlock()
+		select {
+		case <-w.notify:
+		case <-w.done:
+			return nil, false
+		}
+	}
+}
+
+// send 将事件发送给消费者，监听关闭时返回false
+func (w *Watcher) send(event *WatchEvent) bool {
+	select {
+	case w.events <- event:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// push 将事件加入队列，队列已满时返回false
+func (w *Watcher) push(event *WatchEvent) bool {
+	w.mu.Lock()
+	if len(w.queue) >= w.bufferSize {
+		w.mu.Unlock()
+		return false
+	}
+	w.queue = append(w.queue, event)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// match 判断事件是否属于监听的前缀，范围删除只要和前缀的范围有交集就会发送
+func (w *Watcher) match(event *WatchEvent) bool {
+	if len(w.prefix) == 0 {
+		return true
+	}
+	if event.Type != WatchDeleteRange {
+		return bytes.HasPrefix(event.Key, w.prefix)
+	}
+	if len(event.Value) > 0 && bytes.Compare(event.Value, w.prefix) <= 0 {
+		return false
+	}
+	end := prefixEnd(w.prefix)
+	return end == nil || bytes.Compare(event.Key, end) < 0
+}
+
+func newWatchEvent(logRecord *data.LogRecord, pos *data.LogRecordPos) *WatchEvent {
+	event := &WatchEvent{
+		Key: append([]byte(nil), logRecord.Key...),
+		Pos: *pos,
+	}
+	switch logRecord.Type {
+	case data.LogRecordDelete:
+		event.Type = WatchDelete
+	case data.LogRecordRangeDelete:
+		event.Type = WatchDeleteRange
+		if len(logRecord.Value) > 0 {
+			event.Value = append([]byte(nil), logRecord.Value...)
+		}
+	default:
+		event.Type = WatchPut
+		event.Value = append([]byte(nil), logRecord.Value...)
+	}
+	return event
+}
+
+// emitEvent 将变更事件加入所有匹配的监听者的队列，队列已满的监听者会被关闭，使用该方法需要加锁
+func (db *DB) emitEvent(logRecord *data.LogRecord, pos *data.LogRecordPos) {
+	if len(db.watchers) == 0 {
+		return
+	}
+	event := newWatchEvent(logRecord, pos)
+	for w := range db.watchers {
+		if !w.match(event) {
+			continue
+		}
+		if !w.push(event) {
+			delete(db.watchers, w)
+			w.stop(ErrWatcherOverflow)
+		}
+	}
+}
+
+// closeWatchers 关闭所有的监听并等待协程退出，不能在加锁时调用
+func (db *DB) closeWatchers() {
+	db.rw.Lock()
+	for w := range db.watchers {
+		w.stop(nil)
+	}
+	db.rw.Unlock()
+	db.watchDone.Wait()
+}
@@ -0,0 +1,193 @@
+package skv_go
+
+import (
+	"os"
+	"skv-go/data"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiveEvents 从监听中读取n个事件，超时返回已经读取到的事件
+func receiveEvents(w *Watcher, n int) []*WatchEvent {
+	var events []*WatchEvent
+	timeout := time.After(time.Second)
+	for len(events) < n {
+		select {
+		case event, ok := <-w.Events():
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		case <-timeout:
+			return events
+		}
+	}
+	return events
+}
+
+func TestDB_Watch(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-watch")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	_, err = db.Watch(nil, WatchOptions{})
+	assert.Equal(t, ErrWatchBufferSize, err)
+
+	w, err := db.Watch([]byte("user:"), DefaultWatchOptions)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("user:1"), []byte("a")))
+	assert.NoError(t, db.Put([]byte("order:1"), []byte("b")))
+	assert.NoError(t, db.Delete([]byte("user:1")))
+	assert.NoError(t, db.Put([]byte("user:2"), []byte("c")))
+	assert.NoError(t, db.DeleteRange([]byte("a"), []byte("v")))
+
+	events := receiveEvents(w, 4)
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, WatchPut, events[0].Type)
+	assert.Equal(t, []byte("user:1"), events[0].Key)
+	assert.Equal(t, []byte("a"), events[0].Value)
+	assert.Equal(t, WatchDelete, events[1].Type)
+	assert.Equal(t, []byte("user:1"), events[1].Key)
+	assert.Equal(t, WatchPut, events[2].Type)
+	assert.Equal(t, []byte("c"), events[2].Value)
+	// The range covers "user:" so the watcher receives it
+	assert.Equal(t, WatchDeleteRange, events[3].Type)
+	assert.Equal(t, []byte("a"), events[3].Key)
+	assert.Equal(t, []byte("v"), events[3].Value)
+	assert.True(t, events[0].Pos.Offset < events[1].Pos.Offset)
+
+	value, err := db.getValueByPosition(&events[2].Pos)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("c"), value)
+
+	w.Close()
+	assert.NoError(t, w.Err())
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+	assert.NoError(t, db.Put([]byte("user:3"), []byte("d")))
+}
+
+func TestDB_Watch_Txn(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-watch-txn")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	w, err := db.Watch(nil, DefaultWatchOptions)
+	assert.NoError(t, err)
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	for _, key := range []string{"a", "b", "c"} {
+		assert.NoError(t, wb.Put([]byte(key), []byte(key)))
+	}
+	assert.NoError(t, wb.Commit())
+
+	events := receiveEvents(w, 3)
+	assert.Equal(t, 3, len(events))
+	for i := 1; i < len(events); i++ {
+		assert.True(t, events[i-1].Pos.Offset < events[i].Pos.Offset)
+	}
+}
+
+func TestDB_Watch_Overflow(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-watch-overflow")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	w, err := db.Watch(nil, WatchOptions{BufferSize: 4})
+	assert.NoError(t, err)
+	// The consumer never reads, writers must not block
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, db.Put([]byte{'k', byte(i)}, []byte("value")))
+	}
+	events := receiveEvents(w, 100)
+	assert.True(t, len(events) <= 5)
+	assert.Equal(t, ErrWatcherOverflow, w.Err())
+	assert.Equal(t, 0, len(db.watchers))
+}
+
+func TestDB_Watch_Resume(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-watch-resume")
+	options := DefaultOptions
+	options.DirPath = dir
+	options.DataFileSize = 1024
+	db, err := Open(options)
+	defer destroyDB(db)
+	assert.NoError(t, err)
+
+	w, err := db.Watch(nil, DefaultWatchOptions)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("first"), []byte("value")))
+	events := receiveEvents(w, 1)
+	assert.Equal(t, 1, len(events))
+	w.Close()
+	last := events[0].Pos
+
+	// Written while nobody is watching, across several data files
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, db.Put([]byte{'k', byte(i)}, []byte("value")))
+	}
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	assert.NoError(t, wb.Put([]byte("txn"), []byte("value")))
+	assert.NoError(t, wb.Commit())
+	assert.NoError(t, db.Delete([]byte("first")))
+
+	opts := DefaultWatchOptions
+	opts.From = &last
+	w, err = db.Watch(nil, opts)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("live"), []byte("value")))
+
+	events = receiveEvents(w, 53)
+	assert.Equal(t, 53, len(events))
+	assert.Equal(t, []byte{'k', 0}, events[0].Key)
+	assert.Equal(t, []byte{'k', 49}, events[49].Key)
+	assert.Equal(t, []byte("txn"), events[50].Key)
+	assert.Equal(t, WatchDelete, events[51].Type)
+	assert.Equal(t, []byte("live"), events[52].Key)
+	w.Close()
+
+	// Replay from the first record of the first data file
+	opts.From = &data.LogRecordPos{Fid: 0}
+	w, err = db.Watch([]byte("first"), opts)
+	assert.NoError(t, err)
+	events = receiveEvents(w, 2)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, WatchPut, events[0].Type)
+	assert.Equal(t, WatchDelete, events[1].Type)
+	w.Close()
+
+	opts.From = &data.LogRecordPos{Fid: 1000, Offset: 0, Size: 10}
+	_, err = db.Watch(nil, opts)
+	assert.Equal(t, ErrInvalidWatchPos, err)
+	opts.From = &data.LogRecordPos{Fid: last.Fid, Offset: last.Offset + 1, Size: last.Size}
+	_, err = db.Watch(nil, opts)
+	assert.Equal(t, ErrInvalidWatchPos, err)
+}
+
+func TestDB_Watch_Close(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "test-watch-close")
+	options := DefaultOptions
+	options.DirPath = dir
+	db, err := Open(options)
+	assert.NoError(t, err)
+
+	w, err := db.Watch(nil, DefaultWatchOptions)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Put([]byte("key"), []byte("value")))
+	// Closing the database closes the watcher even if the consumer is not reading
+	assert.NoError(t, db.Close())
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+	assert.NoError(t, w.Err())
+	_ = os.RemoveAll(dir)
+}